@@ -19,9 +19,12 @@ import (
 	tomb "gopkg.in/tomb.v2"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/fs/sftpfs"
+	"github.com/restic/restic/internal/fs/tarfs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/textfile"
@@ -35,7 +38,8 @@ var cmdBackup = &cobra.Command{
 	Short: "Create a new backup of files and/or directories",
 	Long: `
 The "backup" command creates a new snapshot and saves the files and directories
-given as the arguments.
+given as the arguments. Files on a remote host can be saved without installing
+restic there by specifying them as sftp:user@host:/path, they are read via sftp.
 
 EXIT STATUS
 ===========
@@ -46,6 +50,15 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 `,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if backupOptions.Host == "" {
+			if !backupOptions.readFromStream() {
+				// the snapshot of remote files records the remote host
+				src, err := parseSFTPSource(args)
+				if err == nil && src != nil {
+					backupOptions.Host = src.cfg.Host
+					return
+				}
+			}
+
 			hostname, err := os.Hostname()
 			if err != nil {
 				debug.Log("os.Hostname() returned err: %v", err)
@@ -71,30 +84,38 @@ Exit status is 3 if some source data could not be read (incomplete snapshot crea
 
 // BackupOptions bundles all options for the backup command.
 type BackupOptions struct {
-	Parent                  string
-	Force                   bool
-	Excludes                []string
-	InsensitiveExcludes     []string
-	ExcludeFiles            []string
-	InsensitiveExcludeFiles []string
-	ExcludeOtherFS          bool
-	ExcludeIfPresent        []string
-	ExcludeCaches           bool
-	ExcludeLargerThan       string
-	Stdin                   bool
-	StdinFilename           string
-	Tags                    restic.TagLists
-	Host                    string
-	FilesFrom               []string
-	FileReadConcurrency     uint
-	SaveBlobConcurrency     uint
-	FilesFromVerbatim       []string
-	FilesFromRaw            []string
-	TimeStamp               string
-	WithAtime               bool
-	IgnoreInode             bool
-	IgnoreCtime             bool
-	UseFsSnapshot           bool
+	Parent string
+	Force  bool
+	excludePatternOptions
+	xattrFilterOptions
+
+	ExcludeOtherFS      bool
+	ExcludeIfPresent    []string
+	ExcludeFileNames    []string
+	ExcludeCaches       bool
+	ExcludeLargerThan   string
+	ExcludeNodump       bool
+	Stdin               bool
+	StdinFilename       string
+	StdinFromCommand    bool
+	StdinCommands       []string
+	FromTar             string
+	Tags                restic.TagLists
+	Host                string
+	FilesFrom           []string
+	FileReadConcurrency uint
+	SaveBlobConcurrency uint
+	FilesFromVerbatim   []string
+	FilesFromRaw        []string
+	TimeStamp           string
+	WithAtime           bool
+	WithInodeFlags      bool
+	IgnoreInode         bool
+	IgnoreCtime         bool
+	UseFsSnapshot       bool
+	CheckpointInterval  time.Duration
+	FilesCache          bool
+	FilesCacheTTL       time.Duration
 }
 
 var backupOptions BackupOptions
@@ -121,16 +142,18 @@ func init() {
 	f := cmdBackup.Flags()
 	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent `snapshot` (default: last snapshot in the repo that has the same target files/directories)")
 	f.BoolVarP(&backupOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
-	f.StringArrayVarP(&backupOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
-	f.StringArrayVar(&backupOptions.InsensitiveExcludes, "iexclude", nil, "same as --exclude `pattern` but ignores the casing of filenames")
-	f.StringArrayVar(&backupOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
-	f.StringArrayVar(&backupOptions.InsensitiveExcludeFiles, "iexclude-file", nil, "same as --exclude-file but ignores casing of `file`names in patterns")
+	initExcludePatternOptions(f, &backupOptions.excludePatternOptions)
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems, don't cross filesystem boundaries and subvolumes")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes `filename[:header]`, exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.ExcludeFileNames, "exclude-file-name", nil, "exclude items according to the gitignore-style ignore files with this `name` in each directory, e.g. .resticignore (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See https://bford.info/cachedir/ for the Cache Directory Tagging Standard`)
 	f.StringVar(&backupOptions.ExcludeLargerThan, "exclude-larger-than", "", "max `size` of the files to be backed up (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&backupOptions.ExcludeNodump, "exclude-nodump", false, "exclude files and directories with the nodump inode flag (chattr +d) and the contents of such directories (Linux only)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
-	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin")
+	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "`filename` to use when reading from stdin or from the command given after --")
+	f.BoolVar(&backupOptions.StdinFromCommand, "stdin-from-command", false, "read backup from the standard output of the command given after --, no snapshot is saved if the command fails")
+	f.StringArrayVar(&backupOptions.StdinCommands, "stdin-command", nil, "read backup from the standard output of a command given as `name=command`, saved as file name (implies --stdin-from-command, can be specified multiple times)")
+	f.StringVar(&backupOptions.FromTar, "from-tar", "", "read backup from the uncompressed tar archive in `file` instead of the file system")
 	f.UintVar(&backupOptions.FileReadConcurrency, "file-read-concurrency", 0, "set concurrency on file reads. (default: $RESTIC_FILE_READ_CONCURRENCY or 2)")
 	f.UintVar(&backupOptions.SaveBlobConcurrency, "save-blob-concurrency", 0, "set the archiver concurrency.  Default: number of available CPUs")
 	f.Var(&backupOptions.Tags, "tag", "add `tags` for the new snapshot in the format `tag[,tag,...]` (can be specified multiple times)")
@@ -147,6 +170,8 @@ func init() {
 	f.StringArrayVar(&backupOptions.FilesFromRaw, "files-from-raw", nil, "read the files to backup from `file` (can be combined with file args; can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "`time` of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.BoolVar(&backupOptions.WithInodeFlags, "with-inode-flags", false, "store the inode flags and creation time for all files and directories (Linux only)")
+	initXattrFilterOptions(f, &backupOptions.xattrFilterOptions)
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
 
 	if backupOptions.FileReadConcurrency == 0 {
@@ -157,6 +182,9 @@ func init() {
 	}
 
 	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	f.DurationVar(&backupOptions.CheckpointInterval, "checkpoint-interval", 0, "save a checkpoint snapshot of the files backed up so far every `interval` (e.g. 1h, default: disabled)")
+	f.BoolVar(&backupOptions.FilesCache, "files-cache", false, "detect unchanged files using a files cache in the local cache directory instead of loading the trees of the parent snapshot")
+	f.DurationVar(&backupOptions.FilesCacheTTL, "files-cache-ttl", archiver.DefaultFilesCacheTTL, "remove entries of directories from the files cache which have not been backed up for `duration`")
 	if runtime.GOOS == "windows" {
 		f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "use filesystem snapshot where possible (currently only Windows VSS)")
 	}
@@ -300,46 +328,187 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if opts.readFromCommand() {
+		if opts.Stdin {
+			return errors.Fatal("--stdin and --stdin-from-command cannot be used together")
+		}
+		if len(opts.FilesFrom) > 0 {
+			return errors.Fatal("--stdin-from-command and --files-from cannot be used together")
+		}
+		if len(opts.FilesFromVerbatim) > 0 {
+			return errors.Fatal("--stdin-from-command and --files-from-verbatim cannot be used together")
+		}
+		if len(opts.FilesFromRaw) > 0 {
+			return errors.Fatal("--stdin-from-command and --files-from-raw cannot be used together")
+		}
+
+		if !opts.StdinFromCommand && len(args) > 0 {
+			return errors.Fatal("--stdin-command was specified and files/dirs were listed as arguments")
+		}
+		if len(args) == 0 && len(opts.StdinCommands) == 0 {
+			return errors.Fatal("--stdin-from-command was specified, but no command was given after --")
+		}
+	}
+
+	if opts.FromTar != "" {
+		if opts.FromTar == "-" {
+			return errors.Fatal("--from-tar cannot read the archive from stdin, as the files are not read in the order in which they are stored, pass the path of the archive file instead")
+		}
+		if opts.Stdin || opts.readFromCommand() {
+			return errors.Fatal("--from-tar cannot be used together with --stdin or --stdin-from-command")
+		}
+		if len(opts.FilesFrom) > 0 || len(opts.FilesFromVerbatim) > 0 || len(opts.FilesFromRaw) > 0 {
+			return errors.Fatal("--from-tar cannot be used together with --files-from, --files-from-verbatim or --files-from-raw")
+		}
+		if len(args) > 0 {
+			return errors.Fatal("--from-tar was specified and files/dirs were listed as arguments")
+		}
+	}
+
+	if !opts.readFromStream() {
+		src, err := parseSFTPSource(args)
+		if err != nil {
+			return err
+		}
+		if src != nil {
+			if len(opts.FilesFrom) > 0 || len(opts.FilesFromVerbatim) > 0 || len(opts.FilesFromRaw) > 0 {
+				return errors.Fatal("sftp sources cannot be used together with --files-from, --files-from-verbatim or --files-from-raw")
+			}
+			if opts.ExcludeOtherFS || opts.ExcludeNodump || opts.UseFsSnapshot {
+				return errors.Fatal("sftp sources cannot be used together with --one-file-system, --exclude-nodump or --use-fs-snapshot")
+			}
+			if opts.ExcludeCaches || len(opts.ExcludeIfPresent) > 0 || len(opts.ExcludeFileNames) > 0 {
+				return errors.Fatal("sftp sources cannot be used together with --exclude-caches, --exclude-if-present or --exclude-file-name")
+			}
+			if opts.FilesCache {
+				return errors.Fatal("--files-cache can only be used for local files")
+			}
+		}
+	}
+
+	if opts.CheckpointInterval < 0 {
+		return errors.Fatal("--checkpoint-interval must not be negative")
+	}
+
+	if opts.FilesCache {
+		if gopts.NoCache {
+			return errors.Fatal("--files-cache cannot be used together with --no-cache")
+		}
+		if opts.readFromStream() {
+			return errors.Fatal("--files-cache can only be used for local files")
+		}
+		if opts.FilesCacheTTL < 0 {
+			return errors.Fatal("--files-cache-ttl must not be negative")
+		}
+	}
+
 	return nil
 }
 
-// collectRejectByNameFuncs returns a list of all functions which may reject data
-// from being saved in a snapshot based on path only
-func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectByNameFunc, err error) {
-	// exclude restic cache
-	if repo.Cache != nil {
-		f, err := rejectResticCache(repo)
+// sftpSource describes files on a remote host which are read via sftp.
+type sftpSource struct {
+	cfg   sftp.Config
+	paths []string
+}
+
+// parseSFTPSource returns the remote files specified in args in the format
+// sftp:user@host:/path or sftp://user@host[:port]//path. If none of args
+// refers to remote files, nil is returned.
+func parseSFTPSource(args []string) (*sftpSource, error) {
+	var src *sftpSource
+	local := false
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "sftp:") {
+			local = true
+			continue
+		}
+
+		cfg, err := sftp.ParseConfig(arg)
 		if err != nil {
-			return nil, err
+			return nil, errors.Fatalf("invalid sftp source %q: %v", arg, err)
 		}
+		c := cfg.(sftp.Config)
 
-		fs = append(fs, f)
+		if src == nil {
+			src = &sftpSource{cfg: c}
+		} else if c.User != src.cfg.User || c.Host != src.cfg.Host || c.Port != src.cfg.Port {
+			return nil, errors.Fatal("all sftp sources must be located on the same host")
+		}
+		src.paths = append(src.paths, c.Path)
+	}
+
+	if src != nil && local {
+		return nil, errors.Fatal("local files and sftp sources cannot be saved in the same snapshot")
+	}
+
+	return src, nil
+}
+
+// openSFTPFS connects to the host of src and returns a file system for it,
+// together with the absolute paths of the files of src on the host.
+func openSFTPFS(gopts GlobalOptions, src *sftpSource) (*sftpfs.FS, []string, func(), error) {
+	cfg := src.cfg
+	if err := gopts.extended.Apply("sftp", &cfg); err != nil {
+		return nil, nil, nil, err
 	}
 
-	// add patterns from file
-	if len(opts.ExcludeFiles) > 0 {
-		excludes, err := readExcludePatternsFromFiles(opts.ExcludeFiles)
+	client, err := sftp.Connect(cfg)
+	if err != nil {
+		return nil, nil, nil, errors.Fatalf("unable to connect to %v: %v", cfg.Host, err)
+	}
+	closeSFTP := func() {
+		_ = client.Close()
+	}
+
+	sftpFS, err := sftpfs.New(client.Client)
+	if err != nil {
+		closeSFTP()
+		return nil, nil, nil, err
+	}
+
+	targets := make([]string, 0, len(src.paths))
+	for _, p := range src.paths {
+		target, err := sftpFS.Abs(p)
 		if err != nil {
-			return nil, err
+			closeSFTP()
+			return nil, nil, nil, err
 		}
-		opts.Excludes = append(opts.Excludes, excludes...)
+		targets = append(targets, target)
 	}
 
-	if len(opts.InsensitiveExcludeFiles) > 0 {
-		excludes, err := readExcludePatternsFromFiles(opts.InsensitiveExcludeFiles)
+	return sftpFS, targets, closeSFTP, nil
+}
+
+// readFromCommand returns true if the backup is read from the standard
+// output of commands.
+func (opts BackupOptions) readFromCommand() bool {
+	return opts.StdinFromCommand || len(opts.StdinCommands) > 0
+}
+
+// readFromStream returns true if the backup is read from stdin, from
+// commands or from a tar archive instead of from the file system.
+func (opts BackupOptions) readFromStream() bool {
+	return opts.Stdin || opts.readFromCommand() || opts.FromTar != ""
+}
+
+// collectRejectByNameFuncs returns a list of all functions which may reject data
+// from being saved in a snapshot based on path only
+func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectByNameFunc, err error) {
+	// exclude restic cache
+	if repo.Cache != nil {
+		f, err := rejectResticCache(repo)
 		if err != nil {
 			return nil, err
 		}
-		opts.InsensitiveExcludes = append(opts.InsensitiveExcludes, excludes...)
-	}
 
-	if len(opts.InsensitiveExcludes) > 0 {
-		fs = append(fs, rejectByInsensitivePattern(opts.InsensitiveExcludes))
+		fs = append(fs, f)
 	}
 
-	if len(opts.Excludes) > 0 {
-		fs = append(fs, rejectByPattern(opts.Excludes))
+	fsPatterns, err := opts.excludePatternOptions.CollectPatterns()
+	if err != nil {
+		return nil, err
 	}
+	fs = append(fs, fsPatterns...)
 
 	if opts.ExcludeCaches {
 		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55")
@@ -361,7 +530,7 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, t
 // from being saved in a snapshot based on path and file info
 func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectFunc, err error) {
 	// allowed devices
-	if opts.ExcludeOtherFS && !opts.Stdin {
+	if opts.ExcludeOtherFS && !opts.readFromStream() {
 		f, err := rejectByDevice(targets)
 		if err != nil {
 			return nil, err
@@ -369,7 +538,7 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 		fs = append(fs, f)
 	}
 
-	if len(opts.ExcludeLargerThan) != 0 && !opts.Stdin {
+	if len(opts.ExcludeLargerThan) != 0 && !opts.readFromStream() {
 		f, err := rejectBySize(opts.ExcludeLargerThan)
 		if err != nil {
 			return nil, err
@@ -377,6 +546,18 @@ func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets
 		fs = append(fs, f)
 	}
 
+	if opts.ExcludeNodump && !opts.readFromStream() {
+		fs = append(fs, rejectNodump())
+	}
+
+	if len(opts.ExcludeFileNames) > 0 && !opts.readFromStream() {
+		f, err := rejectByIgnoreFiles(opts.ExcludeFileNames, targets)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+
 	return fs, nil
 }
 
@@ -429,7 +610,7 @@ func readExcludePatternsFromFiles(excludeFiles []string) ([]string, error) {
 
 // collectTargets returns a list of target files/dirs from several sources.
 func collectTargets(opts BackupOptions, args []string) (targets []string, err error) {
-	if opts.Stdin {
+	if opts.readFromStream() {
 		return nil, nil
 	}
 
@@ -482,7 +663,7 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 	// Merge args into files-from so we can reuse the normal args checks
 	// and have the ability to use both files-from and args at the same time.
 	targets = append(targets, args...)
-	if len(targets) == 0 && !opts.Stdin {
+	if len(targets) == 0 && !opts.readFromStream() {
 		return nil, errors.Fatal("nothing to backup, please specify target files/dirs")
 	}
 
@@ -526,7 +707,36 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		return err
 	}
 
-	targets, err := collectTargets(opts, args)
+	var src *sftpSource
+	if !opts.readFromStream() {
+		src, err = parseSFTPSource(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	var targets []string
+	var sftpFS *sftpfs.FS
+	if src != nil {
+		var closeSFTP func()
+		sftpFS, targets, closeSFTP, err = openSFTPFS(gopts, src)
+		if err != nil {
+			return err
+		}
+		defer closeSFTP()
+	} else {
+		targets, err = collectTargets(opts, args)
+		if err != nil {
+			return err
+		}
+	}
+
+	stdinCommands, err := collectStdinCommands(opts, args)
+	if err != nil {
+		return err
+	}
+
+	xattrFilter, err := opts.XattrFilter()
 	if err != nil {
 		return err
 	}
@@ -605,7 +815,13 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		return err
 	}
 
-	// rejectFuncs collect functions that can reject items from the backup based on path and file info
+	// rejectFuncs collect functions that can reject items from the backup based on path and file info.
+	// Some of them keep state for the current directory, so the scanner and the archiver, which walk
+	// the targets concurrently, each use their own functions.
+	scanRejectFuncs, err := collectRejectFuncs(opts, repo, targets)
+	if err != nil {
+		return err
+	}
 	rejectFuncs, err := collectRejectFuncs(opts, repo, targets)
 	if err != nil {
 		return err
@@ -641,13 +857,15 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		return true
 	}
 
-	selectFilter := func(item string, fi os.FileInfo) bool {
-		for _, reject := range rejectFuncs {
-			if reject(item, fi) {
-				return false
+	newSelectFilter := func(rejectFuncs []RejectFunc) func(item string, fi os.FileInfo) bool {
+		return func(item string, fi os.FileInfo) bool {
+			for _, reject := range rejectFuncs {
+				if reject(item, fi) {
+					return false
+				}
 			}
+			return true
 		}
-		return true
 	}
 
 	var targetFS fs.FS = fs.Local{}
@@ -683,10 +901,43 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		}
 		targets = []string{filename}
 	}
+	if opts.readFromCommand() {
+		if !gopts.JSON {
+			p.V("read data from %d command(s)", len(stdinCommands))
+		}
+		commandFS, err := startStdinCommands(gopts.ctx, stdinCommands, timeStamp, p.Stderr())
+		if err != nil {
+			return err
+		}
+		targetFS = commandFS
+
+		targets = nil
+		for _, cmd := range stdinCommands {
+			targets = append(targets, cmd.filename)
+		}
+	}
+	if opts.FromTar != "" {
+		if !gopts.JSON {
+			p.V("read data from tar archive %v", opts.FromTar)
+		}
+		tarFS, closeTar, err := openTarFS(opts.FromTar)
+		if err != nil {
+			return err
+		}
+		defer closeTar()
+		targetFS = tarFS
+		targets = []string{"/"}
+	}
+	if sftpFS != nil {
+		if !gopts.JSON {
+			p.V("read data from %v via sftp", src.cfg.Host)
+		}
+		targetFS = sftpFS
+	}
 
 	sc := archiver.NewScanner(targetFS)
 	sc.SelectByName = selectByNameFilter
-	sc.Select = selectFilter
+	sc.Select = newSelectFilter(scanRejectFuncs)
 	sc.Error = p.ScannerError
 	sc.Result = p.ReportTotal
 
@@ -697,11 +948,18 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 
 	arch := archiver.New(repo, targetFS, archiver.Options{FileReadConcurrency: backupOptions.FileReadConcurrency, SaveBlobConcurrency: backupOptions.SaveBlobConcurrency})
 	arch.SelectByName = selectByNameFilter
-	arch.Select = selectFilter
+	arch.Select = newSelectFilter(rejectFuncs)
 	arch.WithAtime = opts.WithAtime
+	arch.WithInodeFlags = opts.WithInodeFlags
+	arch.XattrFilter = xattrFilter
 	success := true
 	arch.Error = func(item string, fi os.FileInfo, err error) error {
 		success = false
+		if opts.readFromCommand() {
+			// the output of a failed command is incomplete, abort the
+			// backup instead of saving it in a snapshot
+			return err
+		}
 		return p.Error(item, fi, err)
 	}
 	arch.CompleteItem = p.CompleteItem
@@ -717,6 +975,20 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		arch.ChangeIgnoreFlags |= archiver.ChangeIgnoreCtime
 	}
 
+	// --force rereads all files, so the files cache is not used either
+	var filesCache *archiver.FilesCache
+	if opts.FilesCache && !opts.Force {
+		if repo.Cache == nil {
+			p.E("the local cache is not available, --files-cache is ignored\n")
+		} else {
+			filesCache, err = archiver.NewFilesCache(repo.Cache.FilesDir(), repo.Key(), opts.FilesCacheTTL)
+			if err != nil {
+				return err
+			}
+			arch.FilesCache = filesCache
+		}
+	}
+
 	if parentSnapshotID == nil {
 		parentSnapshotID = &restic.ID{}
 	}
@@ -727,6 +999,8 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		Time:           timeStamp,
 		Hostname:       opts.Host,
 		ParentSnapshot: *parentSnapshotID,
+
+		CheckpointInterval: opts.CheckpointInterval,
 	}
 
 	if !gopts.JSON {
@@ -745,6 +1019,13 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		return errors.Fatalf("unable to save snapshot: %v", err)
 	}
 
+	if filesCache != nil {
+		err = filesCache.Expire()
+		if err != nil {
+			p.E("unable to remove expired entries from the files cache: %v\n", err)
+		}
+	}
+
 	// Report finished execution
 	p.Finish(id)
 	if !gopts.JSON {
@@ -757,3 +1038,20 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	// Return error if any
 	return werr
 }
+
+// openTarFS returns a file system which contains the entries of the tar
+// archive filename.
+func openTarFS(filename string) (*tarfs.FS, func(), error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, errors.Fatalf("unable to open tar archive: %v", err)
+	}
+
+	tarFS, err := tarfs.New(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, errors.Fatalf("unable to read tar archive %v: %v", filename, err)
+	}
+
+	return tarFS, func() { _ = f.Close() }, nil
+}
@@ -111,3 +111,26 @@ func TestReadFilenamesRaw(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), "zero byte"),
 		"wrong error message: %v", err.Error())
 }
+
+func TestParseSFTPSource(t *testing.T) {
+	src, err := parseSFTPSource([]string{"/home", "etc"})
+	rtest.OK(t, err)
+	rtest.Assert(t, src == nil, "local files returned sftp source %v", src)
+
+	src, err = parseSFTPSource([]string{"sftp:root@appliance:/etc", "sftp:root@appliance:var/log"})
+	rtest.OK(t, err)
+	rtest.Equals(t, "root", src.cfg.User)
+	rtest.Equals(t, "appliance", src.cfg.Host)
+	rtest.Equals(t, []string{"/etc", "var/log"}, src.paths)
+
+	for _, args := range [][]string{
+		{"/home", "sftp:root@appliance:/etc"},
+		{"sftp:root@appliance:/etc", "/home"},
+		{"sftp:root@appliance:/etc", "sftp:root@other:/etc"},
+		{"sftp:root@appliance:/etc", "sftp:admin@appliance:/etc"},
+		{"sftp:appliance"},
+	} {
+		_, err = parseSFTPSource(args)
+		rtest.Assert(t, err != nil, "parseSFTPSource(%v) returned no error", args)
+	}
+}
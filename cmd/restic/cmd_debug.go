@@ -92,10 +92,11 @@ type Pack struct {
 
 // Blob is the struct used in printPacks.
 type Blob struct {
-	Type   restic.BlobType `json:"type"`
-	Length uint            `json:"length"`
-	ID     restic.ID       `json:"id"`
-	Offset uint            `json:"offset"`
+	Type               restic.BlobType `json:"type"`
+	Length             uint            `json:"length"`
+	UncompressedLength uint            `json:"uncompressed_length,omitempty"`
+	ID                 restic.ID       `json:"id"`
+	Offset             uint            `json:"offset"`
 }
 
 func printPacks(ctx context.Context, repo *repository.Repository, wr io.Writer) error {
@@ -115,10 +116,11 @@ func printPacks(ctx context.Context, repo *repository.Repository, wr io.Writer)
 		}
 		for i, blob := range blobs {
 			p.Blobs[i] = Blob{
-				Type:   blob.Type,
-				Length: blob.Length,
-				ID:     blob.ID,
-				Offset: blob.Offset,
+				Type:               blob.Type,
+				Length:             blob.Length,
+				UncompressedLength: blob.UncompressedLength,
+				ID:                 blob.ID,
+				Offset:             blob.Offset,
 			}
 		}
 
@@ -359,6 +361,12 @@ func loadBlobs(ctx context.Context, repo restic.Repository, pack restic.ID, list
 			continue
 		}
 
+		plaintext, err = repository.DecompressBlob(blob, plaintext)
+		if err != nil {
+			Warnf("error decompressing blob: %v\n", err)
+			continue
+		}
+
 		id := restic.Hash(plaintext)
 		var prefix string
 		if !id.Equal(blob.ID) {
@@ -536,9 +544,9 @@ func checkPackSize(blobs []restic.Blob, fileSize int64) {
 	}
 
 	// compute header size, per blob: 1 byte type, 4 byte length, 32 byte id
-	size += uint64(restic.CiphertextLength(len(blobs) * (1 + 4 + 32)))
-	// length in uint32 little endian
-	size += 4
+	// and 4 byte uncompressed length for compressed blobs, plus the header
+	// length as uint32 little endian
+	size += uint64(pack.CalculateHeaderSize(blobs))
 
 	if uint64(fileSize) != size {
 		Printf("      file sizes do not match: computed %v from index, file size is %v\n", size, fileSize)
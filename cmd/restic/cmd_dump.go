@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -44,6 +45,7 @@ type DumpOptions struct {
 	Paths   []string
 	Tags    restic.TagLists
 	Archive string
+	ownerMappingOptions
 }
 
 var dumpOptions DumpOptions
@@ -56,6 +58,7 @@ func init() {
 	flags.Var(&dumpOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&dumpOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 	flags.StringVarP(&dumpOptions.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
+	initOwnerMappingOptions(flags, &dumpOptions.ownerMappingOptions)
 }
 
 func splitPath(p string) []string {
@@ -128,10 +131,17 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("no file and no snapshot ID specified")
 	}
 
+	owners, err := opts.OwnerMapping()
+	if err != nil {
+		return err
+	}
+
 	var wd dump.WriteDump
 	switch opts.Archive {
 	case "tar":
-		wd = dump.WriteTar
+		wd = func(ctx context.Context, repo restic.Repository, tree *restic.Tree, rootPath string, dst io.Writer) error {
+			return dump.WriteTar(ctx, repo, tree, rootPath, dst, owners)
+		}
 	case "zip":
 		wd = dump.WriteZip
 	default:
@@ -117,10 +117,21 @@ type statefulOutput struct {
 
 func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 	type findNode restic.Node
+	access, def := node.ACLs()
+	var acl, defaultACL string
+	if access != nil {
+		acl = access.Short()
+	}
+	if def != nil {
+		defaultACL = def.Short()
+	}
+
 	b, err := json.Marshal(struct {
 		// Add these attributes
 		Path        string `json:"path,omitempty"`
 		Permissions string `json:"permissions,omitempty"`
+		ACL         string `json:"acl,omitempty"`
+		DefaultACL  string `json:"default_acl,omitempty"`
 
 		*findNode
 
@@ -134,6 +145,8 @@ func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 	}{
 		Path:        path,
 		Permissions: node.Mode.String(),
+		ACL:         acl,
+		DefaultACL:  defaultACL,
 		findNode:    (*findNode)(node),
 	})
 	if err != nil {
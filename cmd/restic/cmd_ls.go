@@ -87,6 +87,8 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		ModTime    time.Time   `json:"mtime,omitempty"`
 		AccessTime time.Time   `json:"atime,omitempty"`
 		ChangeTime time.Time   `json:"ctime,omitempty"`
+		ACL        string      `json:"acl,omitempty"`
+		DefaultACL string      `json:"default_acl,omitempty"`
 		StructType string      `json:"struct_type"` // "node"
 
 		size uint64 // Target for Size pointer.
@@ -109,6 +111,14 @@ func lsNodeJSON(enc *json.Encoder, path string, node *restic.Node) error {
 		n.Size = &n.size
 	}
 
+	access, def := node.ACLs()
+	if access != nil {
+		n.ACL = access.Short()
+	}
+	if def != nil {
+		n.DefaultACL = def.Short()
+	}
+
 	return enc.Encode(n)
 }
 
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairPacks = &cobra.Command{
+	Use:   "packs [packIDs...]",
+	Short: "Salvage damaged pack files",
+	Long: `
+The "repair packs" command extracts intact blobs from the specified pack files,
+rebuilds the index to remove the damaged pack files and removes the pack files
+from the repository.
+
+Blobs are located using the pack header and the index. In addition, data that
+can still be decrypted is searched for at the start of the pack file and
+directly after each blob, so that blobs following a damaged blob are found even
+if both the pack header and the index are damaged. Only blobs whose content
+still matches their ID are saved into new pack files.
+
+A copy of each damaged pack file is saved as "pack-<ID>" to the directory
+passed with --backup-dir before it is removed from the repository.
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairPacks(repairPacksOptions, globalOptions, args)
+	},
+}
+
+// RepairPacksOptions collects all options for the repair packs command.
+type RepairPacksOptions struct {
+	BackupDir string
+}
+
+var repairPacksOptions RepairPacksOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairPacks)
+	flags := cmdRepairPacks.Flags()
+
+	flags.StringVar(&repairPacksOptions.BackupDir, "backup-dir", "", "save copies of the damaged pack files to `dir` (required)")
+}
+
+func runRepairPacks(opts RepairPacksOptions, gopts GlobalOptions, args []string) error {
+	if opts.BackupDir == "" {
+		return errors.Fatal("please specify a directory for the copies of the damaged pack files using --backup-dir")
+	}
+	backupDir, err := filepath.Abs(opts.BackupDir)
+	if err != nil {
+		return errors.Fatalf("invalid backup directory %q: %v", opts.BackupDir, err)
+	}
+	if err = os.MkdirAll(backupDir, 0700); err != nil {
+		return errors.Fatalf("unable to create backup directory: %v", err)
+	}
+
+	ids := restic.NewIDSet()
+	for _, arg := range args {
+		id, err := restic.ParseID(arg)
+		if err != nil {
+			return errors.Fatalf("invalid pack ID %q: %v", arg, err)
+		}
+		ids.Insert(id)
+	}
+	if len(ids) == 0 {
+		return errors.Fatal("no ids specified")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("create exclusive lock for repository\n")
+	lock, err := lockRepoExclusive(gopts.ctx, repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("load index files\n")
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return errors.Fatalf("%s", err)
+	}
+
+	// collect the blobs which the index expects in the damaged pack files
+	indexBlobs := make(map[restic.ID][]restic.Blob)
+	for pb := range repo.Index().Each(gopts.ctx) {
+		if ids.Has(pb.PackID) {
+			indexBlobs[pb.PackID] = append(indexBlobs[pb.PackID], pb.Blob)
+		}
+	}
+
+	salvagedCount := 0
+	for id := range ids {
+		Verbosef("salvaging pack %v\n", id)
+
+		var buf []byte
+		h := restic.Handle{Type: restic.PackFile, Name: id.String()}
+		err := repo.Backend().Load(gopts.ctx, h, 0, 0, func(rd io.Reader) (ierr error) {
+			buf, ierr = ioutil.ReadAll(rd)
+			return ierr
+		})
+		if err != nil {
+			return errors.Fatalf("unable to load pack file %v: %v", id, err)
+		}
+
+		backupName := filepath.Join(backupDir, "pack-"+id.String())
+		if err = ioutil.WriteFile(backupName, buf, 0600); err != nil {
+			return errors.Fatalf("unable to save copy of pack file %v: %v", id, err)
+		}
+		Printf("saved copy of pack file %v to %v\n", id.Str(), backupName)
+
+		blobs, err := repo.SalvagePack(gopts.ctx, buf, indexBlobs[id])
+		if err != nil {
+			return err
+		}
+
+		for _, blob := range blobs {
+			// the blob is still listed in the index, thus force saving it
+			_, _, err = repo.SaveBlob(gopts.ctx, blob.Type, blob.Plaintext, blob.ID, true)
+			if err != nil {
+				return err
+			}
+		}
+		Verbosef("  salvaged %d of %d blobs known from the index\n", countKnownBlobs(blobs, indexBlobs[id]), len(indexBlobs[id]))
+		salvagedCount += len(blobs)
+	}
+
+	if err = repo.Flush(gopts.ctx); err != nil {
+		return err
+	}
+
+	Verbosef("salvaged %d blobs\n", salvagedCount)
+
+	// remove the damaged pack files from the index before deleting them, the
+	// index now contains the salvaged blobs in their new pack files
+	if err = rebuildIndexFiles(gopts, repo, ids, nil); err != nil {
+		return errors.Fatalf("%s", err)
+	}
+
+	Verbosef("removing %d damaged packs\n", len(ids))
+	DeleteFiles(gopts, repo, ids, restic.PackFile)
+
+	Verbosef("done\n")
+	Verbosef("use \"restic check\" to verify the repository, missing data can be removed using \"restic repair snapshots\"\n")
+	return nil
+}
+
+// countKnownBlobs returns how many of the blobs in known are contained in blobs.
+func countKnownBlobs(blobs []repository.SalvagedBlob, known []restic.Blob) int {
+	salvaged := restic.NewBlobSet()
+	for _, blob := range blobs {
+		salvaged.Insert(blob.BlobHandle)
+	}
+
+	count := 0
+	for _, blob := range known {
+		if salvaged.Has(blob.BlobHandle) {
+			count++
+		}
+	}
+	return count
+}
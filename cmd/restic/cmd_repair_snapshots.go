@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshot ID] [...]",
+	Short: "Repair snapshots",
+	Long: `
+The "repair snapshots" command repairs broken snapshots. It scans the given
+snapshots and generates new ones with damaged directories and file contents
+removed. If the broken snapshots are deleted, a prune run will be able to
+clean up the repository.
+
+The command depends on a correct index, thus make sure to run "rebuild-index"
+first!
+
+WARNING
+=======
+
+Repairing and deleting broken snapshots causes data loss! It will remove broken
+directories and modify broken files in the modified snapshots.
+
+If the contents of directories and files are still available, the better option
+is to run "backup" which in that case is able to heal existing snapshots. Only
+use the "repair snapshots" command if you need to recover an old and broken
+snapshot!
+
+EXIT STATUS
+===========
+
+Exit status is 0 if the command was successful, and non-zero if there was any error.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(repairSnapshotOptions, globalOptions, args)
+	},
+}
+
+// RepairOptions collects all options for the repair snapshots command.
+type RepairOptions struct {
+	DryRun bool
+	Forget bool
+
+	Hosts []string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var repairSnapshotOptions RepairOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+	flags := cmdRepairSnapshots.Flags()
+
+	flags.BoolVarP(&repairSnapshotOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+	flags.BoolVarP(&repairSnapshotOptions.Forget, "forget", "", false, "remove original snapshots after creating new ones")
+
+	flags.StringArrayVarP(&repairSnapshotOptions.Hosts, "host", "H", nil, "only consider snapshots for this `host`, when no snapshot ID is given (can be specified multiple times)")
+	flags.Var(&repairSnapshotOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
+	flags.StringArrayVar(&repairSnapshotOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
+}
+
+func runRepairSnapshots(opts RepairOptions, gopts GlobalOptions, args []string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	var treeSaver walker.TreeLoadSaver = repo
+	if !opts.DryRun {
+		Verbosef("create exclusive lock for repository\n")
+		lock, err := lockRepoExclusive(gopts.ctx, repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	} else {
+		treeSaver = dryRunTreeSaver{repo}
+	}
+
+	if err := repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	// Three error cases are checked:
+	// - directories without a subtree (-> will be replaced by an empty tree)
+	// - trees which cannot be loaded (-> the tree contents will be removed)
+	// - files whose contents are not fully available  (-> file will be modified)
+	rewriter := walker.NewTreeRewriter(walker.RewriteOpts{
+		RewriteNode: func(node *restic.Node, path string) *restic.Node {
+			if node.Type != "file" {
+				return node
+			}
+
+			ok := true
+			var newContent = restic.IDs{}
+			var newSize uint64
+			// check all contents and remove if not available
+			for _, id := range node.Content {
+				if size, found := repo.LookupBlobSize(id, restic.DataBlob); !found {
+					ok = false
+				} else {
+					newContent = append(newContent, id)
+					newSize += uint64(size)
+				}
+			}
+			if !ok {
+				Verbosef("  file %q: removed missing content\n", path)
+			} else if newSize != node.Size {
+				Verbosef("  file %q: fixed incorrect size\n", path)
+			}
+			// no-ops if already correct
+			node.Content = newContent
+			node.Size = newSize
+			return node
+		},
+		RewriteFailedTree: func(nodeID restic.ID, path string, _ error) (restic.ID, error) {
+			if path == "/" {
+				Verbosef("  dir %q: not readable\n", path)
+				// remove snapshots with invalid root node
+				return restic.ID{}, nil
+			}
+			// If a subtree fails to load, remove it
+			Verbosef("  dir %q: replaced with empty directory\n", path)
+			return treeSaver.SaveTree(gopts.ctx, restic.NewTree())
+		},
+	})
+
+	changedCount := 0
+	for sn := range FindFilteredSnapshots(gopts.ctx, repo, opts.Hosts, opts.Tags, opts.Paths, args) {
+		Verbosef("\nsnapshot %s of %v at %s)\n", sn.ID().Str(), sn.Paths, sn.Time)
+		changed, err := filterAndReplaceSnapshot(gopts.ctx, repo, sn,
+			func(ctx context.Context, sn *restic.Snapshot) (restic.ID, error) {
+				if sn.Tree == nil {
+					Verbosef("  snapshot has no tree\n")
+					return restic.ID{}, nil
+				}
+				return rewriter.RewriteTree(ctx, treeSaver, "/", *sn.Tree)
+			}, opts.DryRun, opts.Forget, "repaired")
+		if err != nil {
+			return errors.Fatalf("unable to repair snapshot ID %q: %v", sn.ID().Str(), err)
+		}
+		if changed {
+			changedCount++
+		}
+	}
+
+	Verbosef("\n")
+	if changedCount == 0 {
+		if !opts.DryRun {
+			Verbosef("no snapshots were modified\n")
+		} else {
+			Verbosef("no snapshots would be modified\n")
+		}
+	} else {
+		if !opts.Forget && !opts.DryRun {
+			Verbosef("please use the \"forget\" command to manually remove unneeded snapshots\n")
+		}
+		if opts.DryRun {
+			Verbosef("would modify %d snapshots\n", changedCount)
+		} else {
+			Verbosef("modified %d snapshots\n", changedCount)
+		}
+	}
+
+	return nil
+}
+
+// dryRunTreeSaver computes the IDs of trees without storing them.
+type dryRunTreeSaver struct {
+	restic.TreeLoader
+}
+
+func (dryRunTreeSaver) SaveTree(_ context.Context, t *restic.Tree) (restic.ID, error) {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return restic.ID{}, errors.Wrap(err, "MarshalJSON")
+	}
+	// same encoding as used by Repository.SaveTree
+	buf = append(buf, '\n')
+	return restic.Hash(buf), nil
+}
+
+// filterAndReplaceSnapshot uses filter to create a modified copy of the tree
+// of sn. If the tree was changed, a new snapshot referencing the original one
+// is saved, and with forget set, the original snapshot is removed. If the
+// filter returns the null ID, the snapshot is only removed with forget set,
+// otherwise it is reported and kept. addTag is added to the new snapshot
+// unless the original is removed.
+func filterAndReplaceSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, filter func(ctx context.Context, sn *restic.Snapshot) (restic.ID, error), dryRun bool, forget bool, addTag string) (bool, error) {
+	filteredTree, err := filter(ctx, sn)
+	if err != nil {
+		return false, err
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return false, err
+	}
+
+	if filteredTree.IsNull() {
+		if !forget {
+			Verbosef("snapshot %v is empty, use --forget to remove it\n", sn.ID().Str())
+			return false, nil
+		}
+		if dryRun {
+			Verbosef("would delete empty snapshot\n")
+		} else {
+			h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+			if err = repo.Backend().Remove(ctx, h); err != nil {
+				return false, err
+			}
+			debug.Log("removed empty snapshot %v", sn.ID())
+			Verbosef("removed empty snapshot %v\n", sn.ID().Str())
+		}
+		return true, nil
+	}
+
+	if filteredTree == *sn.Tree {
+		debug.Log("snapshot %v not modified", sn.ID())
+		return false, nil
+	}
+
+	debug.Log("snapshot %v modified", sn.ID())
+	if dryRun {
+		Verbosef("would save new snapshot\n")
+
+		if forget {
+			Verbosef("would remove old snapshot\n")
+		}
+
+		return true, nil
+	}
+
+	// Always set the original snapshot id as this essentially a new snapshot.
+	sn.Original = sn.ID()
+	sn.Tree = &filteredTree
+
+	if !forget {
+		sn.AddTags([]string{addTag})
+	}
+
+	// Save the new snapshot.
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return false, err
+	}
+	Verbosef("saved new snapshot %v\n", id.Str())
+
+	if forget {
+		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+		if err = repo.Backend().Remove(ctx, h); err != nil {
+			return false, err
+		}
+		debug.Log("removed old snapshot %v", sn.ID())
+		Verbosef("removed old snapshot %v\n", sn.ID().Str())
+	}
+	return true, nil
+}
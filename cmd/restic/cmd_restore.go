@@ -1,19 +1,28 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/json"
+	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/spf13/cobra"
+	tomb "gopkg.in/tomb.v2"
 )
 
 var cmdRestore = &cobra.Command{
-	Use:   "restore [flags] snapshotID",
+	Use:   "restore [flags] snapshotID [snapshotID ...] | --from-history path",
 	Short: "Extract the data from a snapshot",
 	Long: `
 The "restore" command extracts the data from a snapshot from the repository to
@@ -22,14 +31,33 @@ a directory.
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
 
+If several snapshots are specified, each one is restored to a subdirectory of
+the target directory named after the short snapshot ID. Pack files needed by
+several snapshots are only downloaded once.
+
+With --from-history, the snapshots are searched from newest to oldest for the
+given path instead, and only the path is restored from the most recent snapshot
+containing it. Use --history-version to restore an older version of the path.
+
 EXIT STATUS
 ===========
 
 Exit status is 0 if the command was successful, and non-zero if there was any error.
+With --ignore-missing, the exit status is 3 if some files could not be restored
+completely.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runRestore(restoreOptions, globalOptions, args)
+		var t tomb.Tomb
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		t.Go(func() error { term.Run(t.Context(globalOptions.ctx)); return nil })
+
+		err := runRestore(restoreOptions, globalOptions, term, args)
+		t.Kill(nil)
+		if werr := t.Wait(); werr != nil {
+			panic(fmt.Sprintf("term.Run() returned err: %v", err))
+		}
+		return err
 	},
 }
 
@@ -39,16 +67,36 @@ type RestoreOptions struct {
 	InsensitiveExclude []string
 	Include            []string
 	InsensitiveInclude []string
+	FilesFrom          []string
+	FilesFromRaw       []string
 	Target             string
 	Hosts              []string
 	Paths              []string
 	Tags               restic.TagLists
 	Verify             bool
 	DryRun             bool
+	Sparse             bool
+	Overwrite          restorer.OverwriteBehavior
+	Delete             bool
+	NumericOwner       bool
+	RestoreACLs        bool
+	NoACLs             bool
+	StripComponents    int
+	PathMappings       []string
+	FromHistory        string
+	HistoryVersion     int
+	IgnoreMissing      bool
+	MetadataOnly       bool
+	ImmutableFlags     bool
+	ownerMappingOptions
+	xattrFilterOptions
 }
 
 var restoreOptions RestoreOptions
 
+// ErrPartialRestore is used to report a restore in which some files are damaged
+var ErrPartialRestore = errors.New("some files could not be restored completely")
+
 func init() {
 	cmdRoot.AddCommand(cmdRestore)
 
@@ -57,6 +105,8 @@ func init() {
 	flags.StringArrayVar(&restoreOptions.InsensitiveExclude, "iexclude", nil, "same as `--exclude` but ignores the casing of filenames")
 	flags.StringArrayVarP(&restoreOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
 	flags.StringArrayVar(&restoreOptions.InsensitiveInclude, "iinclude", nil, "same as `--include` but ignores the casing of filenames")
+	flags.StringArrayVar(&restoreOptions.FilesFrom, "files-from", nil, "read the paths to restore from `file`, one per line (can be specified multiple times)")
+	flags.StringArrayVar(&restoreOptions.FilesFromRaw, "files-from-raw", nil, "read the paths to restore from `file`, separated by NUL bytes (can be specified multiple times)")
 	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to")
 
 	flags.StringArrayVarP(&restoreOptions.Hosts, "host", "H", nil, `only consider snapshots for this host when the snapshot ID is "latest" (can be specified multiple times)`)
@@ -64,12 +114,27 @@ func init() {
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
 	flags.BoolVar(&restoreOptions.DryRun, "dry-run", false, "do not do anything only display pack files")
+	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse files, parts only containing zeros are not written")
+	flags.Var(&restoreOptions.Overwrite, "overwrite", "overwrite behavior for existing files, one of (always|if-changed|if-newer|never)")
+	flags.IntVar(&restoreOptions.StripComponents, "strip-components", 0, "remove `n` leading path components from the restored items")
+	flags.StringArrayVar(&restoreOptions.PathMappings, "map", nil, "restore the items below `/old=/new` in the snapshot at the new path (can be specified multiple times)")
+	flags.BoolVar(&restoreOptions.NumericOwner, "numeric-owner", true, "restore the numeric user and group IDs, set to false to look up the user and group names on this system")
+	initOwnerMappingOptions(flags, &restoreOptions.ownerMappingOptions)
+	flags.BoolVar(&restoreOptions.RestoreACLs, "restore-acls", true, "restore the POSIX ACLs stored in the snapshot, the user and group IDs within them are translated by --map-uid and --map-gid")
+	flags.BoolVar(&restoreOptions.NoACLs, "no-acls", false, "do not restore POSIX ACLs, same as --restore-acls=false")
+	initXattrFilterOptions(flags, &restoreOptions.xattrFilterOptions)
+	flags.BoolVar(&restoreOptions.ImmutableFlags, "restore-immutable-flags", false, "also restore the immutable and append-only inode flags, restored items with these flags cannot be overwritten or deleted by later restores (Linux only)")
+	flags.BoolVar(&restoreOptions.Delete, "delete", false, "delete files and directories from the target which are not contained in the snapshot")
+	flags.BoolVar(&restoreOptions.MetadataOnly, "metadata-only", false, "only restore the metadata of items which already exist in the target directory, report missing items and differences")
+	flags.BoolVar(&restoreOptions.IgnoreMissing, "ignore-missing", false, "fill parts of files which are missing from the repository or cannot be loaded with zeros instead of aborting")
+	flags.StringVar(&restoreOptions.FromHistory, "from-history", "", "restore only `path` from the most recent snapshot containing it")
+	flags.IntVar(&restoreOptions.HistoryVersion, "history-version", 0, "with --from-history, restore the `n`th older version of the path instead of the most recent one")
 }
 
-func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
+func runRestore(opts RestoreOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	ctx := gopts.ctx
 	hasExcludes := len(opts.Exclude) > 0 || len(opts.InsensitiveExclude) > 0
-	hasIncludes := len(opts.Include) > 0 || len(opts.InsensitiveInclude) > 0
+	hasIncludes := len(opts.Include) > 0 || len(opts.InsensitiveInclude) > 0 || len(opts.FilesFrom) > 0 || len(opts.FilesFromRaw) > 0
 
 	for i, str := range opts.InsensitiveExclude {
 		opts.InsensitiveExclude[i] = strings.ToLower(str)
@@ -80,10 +145,22 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	switch {
-	case len(args) == 0:
+	case opts.FromHistory != "" && len(args) > 0:
+		return errors.Fatal("--from-history cannot be combined with a snapshot ID")
+	case opts.FromHistory == "" && len(args) == 0:
 		return errors.Fatal("no snapshot ID specified")
-	case len(args) > 1:
-		return errors.Fatalf("more than one snapshot ID specified: %v", args)
+	}
+
+	if opts.HistoryVersion < 0 {
+		return errors.Fatal("--history-version must not be negative")
+	}
+
+	if opts.Delete && opts.FromHistory != "" {
+		return errors.Fatal("--delete cannot be combined with --from-history")
+	}
+
+	if opts.Delete && opts.MetadataOnly {
+		return errors.Fatal("--delete cannot be combined with --metadata-only")
 	}
 
 	if opts.Target == "" && !opts.DryRun {
@@ -94,9 +171,46 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
-	snapshotIDString := args[0]
+	if gopts.password == "" {
+		for _, filename := range append(opts.FilesFrom, opts.FilesFromRaw...) {
+			if filename == "-" {
+				return errors.Fatal("unable to read password from stdin when paths are to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+			}
+		}
+	}
+
+	includePaths, err := readRestorePaths(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.StripComponents < 0 {
+		return errors.Fatal("--strip-components must not be negative")
+	}
+
+	var pathMappings []restorer.PathMapping
+	for _, s := range opts.PathMappings {
+		m, err := restorer.ParsePathMapping(s)
+		if err != nil {
+			return errors.Fatalf("invalid --map: %v", err)
+		}
+		pathMappings = append(pathMappings, m)
+	}
+
+	if opts.Delete && (opts.StripComponents > 0 || len(pathMappings) > 0) {
+		return errors.Fatal("--delete cannot be combined with --strip-components or --map")
+	}
 
-	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
+	owners, err := opts.OwnerMapping()
+	if err != nil {
+		return err
+	}
+	owners.ByName = !opts.NumericOwner
+
+	xattrFilter, err := opts.XattrFilter()
+	if err != nil {
+		return err
+	}
 
 	repo, err := OpenRepository(gopts)
 	if err != nil {
@@ -116,31 +230,128 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
-	var id restic.ID
+	var ids restic.IDs
+	var historyPath string
 
-	if snapshotIDString == "latest" {
-		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Hosts)
+	if opts.FromHistory != "" {
+		historyPath = cleanHistoryPath(opts.FromHistory)
+		debug.Log("restore %v from history to %v", historyPath, opts.Target)
+
+		snapshots, err := restic.FindFilteredSnapshots(ctx, repo, opts.Hosts, opts.Tags, opts.Paths)
 		if err != nil {
-			Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Hosts:%v", err, opts.Paths, opts.Hosts)
+			return err
 		}
-	} else {
-		id, err = restic.FindSnapshot(ctx, repo, snapshotIDString)
+
+		sn, _, err := findPathInHistory(ctx, repo, snapshots, historyPath, opts.HistoryVersion)
 		if err != nil {
-			Exitf(1, "invalid id %q: %v", snapshotIDString, err)
+			return err
+		}
+		ids = restic.IDs{*sn.ID()}
+	} else {
+		seen := restic.NewIDSet()
+		for _, snapshotIDString := range args {
+			debug.Log("restore %v to %v", snapshotIDString, opts.Target)
+
+			var id restic.ID
+			if snapshotIDString == "latest" {
+				id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Hosts)
+				if err != nil {
+					Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Hosts:%v", err, opts.Paths, opts.Hosts)
+				}
+			} else {
+				id, err = restic.FindSnapshot(ctx, repo, snapshotIDString)
+				if err != nil {
+					Exitf(1, "invalid id %q: %v", snapshotIDString, err)
+				}
+			}
+
+			// restore each snapshot only once
+			if seen.Has(id) {
+				continue
+			}
+			seen.Insert(id)
+			ids = append(ids, id)
 		}
 	}
 
-	res, err := restorer.NewRestorer(ctx, repo, id)
+	res, err := restorer.NewMultiRestorer(ctx, repo, ids)
 	if err != nil {
 		Exitf(2, "creating restorer failed: %v\n", err)
 	}
 
-	totalErrors := 0
-	res.Error = func(location string, err error) error {
-		Warnf("ignoring error for %s: %s\n", location, err)
-		totalErrors++
-		return nil
+	type RestoreProgressReporter interface {
+		ReportTotal(files, bytes uint64)
+		StartPack(packID restic.ID)
+		CompletePack(packID restic.ID)
+		CompleteBlob(location string, bytes uint64)
+		CompleteItem(location string, node *restic.Node)
+		ReportDamage(location string, offset, length int64, err error)
+		ReportMismatch(location string, differences []string)
+		DamagedFiles() uint
+		SetMinUpdatePause(d time.Duration)
+		Run(ctx context.Context) error
+		Error(location string, err error) error
+		Warn(location string, err error)
+		ErrorCount() uint
+		Finish(snapshotIDs restic.IDs)
+
+		// ui.StdioWrapper
+		Stdout() io.WriteCloser
+		Stderr() io.WriteCloser
+
+		// ui.Message
+		E(msg string, args ...interface{})
+		P(msg string, args ...interface{})
+		V(msg string, args ...interface{})
+		VV(msg string, args ...interface{})
+	}
+
+	var p RestoreProgressReporter
+	if gopts.JSON {
+		p = json.NewRestore(term, gopts.verbosity)
+	} else {
+		p = ui.NewRestore(term, gopts.verbosity)
+	}
+
+	// use the terminal for stdout/stderr
+	prevStdout, prevStderr := gopts.stdout, gopts.stderr
+	defer func() {
+		gopts.stdout, gopts.stderr = prevStdout, prevStderr
+	}()
+	gopts.stdout, gopts.stderr = p.Stdout(), p.Stderr()
+
+	p.SetMinUpdatePause(calculateProgressInterval(!gopts.Quiet))
+
+	res.Sparse = opts.Sparse
+	res.Overwrite = opts.Overwrite
+	res.Delete = opts.Delete
+	res.OwnerMapping = owners
+	res.SkipACLs = opts.NoACLs || !opts.RestoreACLs
+	res.XattrFilter = xattrFilter
+	res.RestoreImmutableFlags = opts.ImmutableFlags
+	res.StripComponents = opts.StripComponents
+	res.PathMappings = pathMappings
+	res.IgnoreMissing = opts.IgnoreMissing
+	res.ReportDamage = p.ReportDamage
+	res.MetadataOnly = opts.MetadataOnly
+	res.ReportMismatch = p.ReportMismatch
+	res.DeleteItem = func(location string, isDir bool) {
+		if gopts.JSON {
+			return
+		}
+		if opts.DryRun {
+			p.V("would delete %s\n", location)
+		} else {
+			p.V("deleted %s\n", location)
+		}
 	}
+	res.Error = p.Error
+	res.Warn = p.Warn
+	res.ReportTotal = p.ReportTotal
+	res.StartPack = p.StartPack
+	res.CompletePack = p.CompletePack
+	res.CompleteBlob = p.CompleteBlob
+	res.CompleteItem = p.CompleteItem
 
 	excludePatterns := filter.ParsePatterns(opts.Exclude)
 	insensitiveExcludePatterns := filter.ParsePatterns(opts.InsensitiveExclude)
@@ -178,8 +389,10 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 			Warnf("error for iexclude pattern: %v", err)
 		}
 
-		selectedForRestore = matched || matchedInsensitive
-		childMayBeSelected = (childMayMatch || childMayMatchInsensitive) && node.Type == "dir"
+		matchedPath, childMayMatchPath := includePaths.Match(item)
+
+		selectedForRestore = matched || matchedInsensitive || matchedPath
+		childMayBeSelected = (childMayMatch || childMayMatchInsensitive || childMayMatchPath) && node.Type == "dir"
 
 		return selectedForRestore, childMayBeSelected
 	}
@@ -190,28 +403,103 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		res.SelectFilter = selectIncludeFilter
 	}
 
-	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	if historyPath != "" {
+		res.SelectFilter = selectHistoryPathFilter(historyPath, res.SelectFilter)
+	}
+
+	if !gopts.JSON {
+		switch {
+		case historyPath != "":
+			p.P("restoring %s from %s to %s\n", historyPath, res.Snapshot(), opts.Target)
+		case len(ids) > 1:
+			for _, sn := range res.Snapshots() {
+				p.P("restoring %s to %s\n", sn, filepath.Join(opts.Target, sn.ID().Str()))
+			}
+		default:
+			p.P("restoring %s to %s\n", res.Snapshot(), opts.Target)
+		}
+	}
+
+	var t tomb.Tomb
+	t.Go(func() error { return p.Run(t.Context(ctx)) })
+
 	err = res.RestoreTo(ctx, opts.Target, opts.DryRun)
+
+	// cleanly shutdown the progress report
+	t.Kill(nil)
+	werr := t.Wait()
+
 	if err != nil {
 		return err
 	}
 
-	if totalErrors > 0 {
-		return errors.Fatalf("There were %d errors\n", totalErrors)
+	p.Finish(ids)
+
+	if p.ErrorCount() > 0 {
+		return errors.Fatalf("There were %d errors\n", p.ErrorCount())
+	}
+
+	if p.DamagedFiles() > 0 {
+		// the damaged files cannot be verified
+		return ErrPartialRestore
 	}
 
 	if opts.Verify {
-		Verbosef("verifying files in %s\n", opts.Target)
+		if !gopts.JSON {
+			p.P("verifying files in %s\n", opts.Target)
+		}
 		var count int
 		count, err = res.VerifyFiles(ctx, opts.Target)
 		if err != nil {
 			return err
 		}
-		if totalErrors > 0 {
-			return errors.Fatalf("There were %d errors\n", totalErrors)
+		if p.ErrorCount() > 0 {
+			return errors.Fatalf("There were %d errors\n", p.ErrorCount())
+		}
+		if !gopts.JSON {
+			p.P("finished verifying %d files in %s\n", count, opts.Target)
 		}
-		Verbosef("finished verifying %d files in %s\n", count, opts.Target)
 	}
 
-	return nil
+	return werr
+}
+
+// readRestorePaths returns the set of paths read from the files passed to
+// --files-from and --files-from-raw. Relative paths are interpreted relative to
+// the root of the snapshot.
+func readRestorePaths(opts RestoreOptions) (*filter.PathSet, error) {
+	paths := filter.NewPathSet()
+	add := func(p string) {
+		paths.Add(filepath.Join(string(filepath.Separator), filepath.FromSlash(p)))
+	}
+
+	for _, file := range opts.FilesFrom {
+		lines, err := readLines(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" || line[0] == '#' { // '#' marks a comment.
+				continue
+			}
+			add(line)
+		}
+	}
+
+	for _, file := range opts.FilesFromRaw {
+		names, err := readFilenamesFromFileRaw(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			add(name)
+		}
+	}
+
+	if (len(opts.FilesFrom) > 0 || len(opts.FilesFromRaw) > 0) && paths.Empty() {
+		return nil, errors.Fatal("no paths to restore found in --files-from or --files-from-raw")
+	}
+
+	return paths, nil
 }
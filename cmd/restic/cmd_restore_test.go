@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestReadRestorePaths(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filesFrom := filepath.Join(dir, "files-from")
+	// Empty lines should be ignored. A line starting with '#' is a comment.
+	rtest.OK(t, ioutil.WriteFile(filesFrom, []byte("/home/user/work/report.txt\n\n # a comment\n  srv/www  \r\n"), 0644))
+
+	filesFromRaw := filepath.Join(dir, "files-from-raw")
+	rtest.OK(t, ioutil.WriteFile(filesFromRaw, []byte("/tmp/name with spaces \x00/tmp/#notacomment\x00"), 0644))
+
+	paths, err := readRestorePaths(RestoreOptions{
+		FilesFrom:    []string{filesFrom},
+		FilesFromRaw: []string{filesFromRaw},
+	})
+	rtest.OK(t, err)
+
+	for p, want := range map[string]bool{
+		"/home/user/work/report.txt": true,
+		"/home/user/work/other.txt":  false,
+		"/srv/www/index.html":        true,
+		"/tmp/name with spaces ":     true,
+		"/tmp/name with spaces":      false,
+		"/tmp/#notacomment":          true,
+	} {
+		match, _ := paths.Match(filepath.FromSlash(p))
+		rtest.Assert(t, match == want, "Match(%q) returned %v, want %v", p, match, want)
+	}
+
+	rtest.OK(t, ioutil.WriteFile(filesFrom, []byte("# only a comment\n"), 0644))
+	_, err = readRestorePaths(RestoreOptions{FilesFrom: []string{filesFrom}})
+	rtest.Assert(t, err != nil, "expected error for empty list of paths")
+
+	paths, err = readRestorePaths(RestoreOptions{})
+	rtest.OK(t, err)
+	rtest.Assert(t, paths.Empty(), "expected empty set without --files-from")
+}
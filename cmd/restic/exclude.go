@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -15,6 +16,7 @@ import (
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
+	"github.com/spf13/pflag"
 )
 
 type rejectionCache struct {
@@ -71,6 +73,57 @@ type RejectByNameFunc func(path string) bool
 // should be excluded (rejected) from the backup.
 type RejectFunc func(path string, fi os.FileInfo) bool
 
+// excludePatternOptions collects the options for excluding files by name.
+type excludePatternOptions struct {
+	Excludes                []string
+	InsensitiveExcludes     []string
+	ExcludeFiles            []string
+	InsensitiveExcludeFiles []string
+}
+
+func initExcludePatternOptions(f *pflag.FlagSet, opts *excludePatternOptions) {
+	f.StringArrayVarP(&opts.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&opts.InsensitiveExcludes, "iexclude", nil, "same as --exclude `pattern` but ignores the casing of filenames")
+	f.StringArrayVar(&opts.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+	f.StringArrayVar(&opts.InsensitiveExcludeFiles, "iexclude-file", nil, "same as --exclude-file but ignores casing of `file`names in patterns")
+}
+
+// Empty returns true if no exclude patterns are set.
+func (opts *excludePatternOptions) Empty() bool {
+	return len(opts.Excludes) == 0 && len(opts.InsensitiveExcludes) == 0 && len(opts.ExcludeFiles) == 0 && len(opts.InsensitiveExcludeFiles) == 0
+}
+
+// CollectPatterns returns a list of functions which reject files matching the
+// exclude patterns, including the patterns read from exclude files.
+func (opts excludePatternOptions) CollectPatterns() ([]RejectByNameFunc, error) {
+	var fs []RejectByNameFunc
+	// add patterns from file
+	if len(opts.ExcludeFiles) > 0 {
+		excludes, err := readExcludePatternsFromFiles(opts.ExcludeFiles)
+		if err != nil {
+			return nil, err
+		}
+		opts.Excludes = append(opts.Excludes, excludes...)
+	}
+
+	if len(opts.InsensitiveExcludeFiles) > 0 {
+		excludes, err := readExcludePatternsFromFiles(opts.InsensitiveExcludeFiles)
+		if err != nil {
+			return nil, err
+		}
+		opts.InsensitiveExcludes = append(opts.InsensitiveExcludes, excludes...)
+	}
+
+	if len(opts.InsensitiveExcludes) > 0 {
+		fs = append(fs, rejectByInsensitivePattern(opts.InsensitiveExcludes))
+	}
+
+	if len(opts.Excludes) > 0 {
+		fs = append(fs, rejectByPattern(opts.Excludes))
+	}
+	return fs, nil
+}
+
 // rejectByPattern returns a RejectByNameFunc which rejects files that match
 // one of the patterns.
 func rejectByPattern(patterns []string) RejectByNameFunc {
@@ -382,6 +435,169 @@ func rejectBySize(maxSizeStr string) (RejectFunc, error) {
 	}, nil
 }
 
+// ignoreFiles holds the parsed ignore files of the directory which is
+// currently walked and of its parents within the backup targets. The targets
+// are walked depth-first, so the ignore files of a directory are dropped as
+// soon as an item outside of it is checked. An instance must only be used for
+// a single walk.
+type ignoreFiles struct {
+	names []string
+	roots []string
+
+	mtx sync.Mutex
+	// stack contains the directories from the outermost to the innermost
+	stack []ignoreDir
+}
+
+// ignoreDir contains the rules of the ignore files in dir, file is nil if dir
+// does not contain an ignore file.
+type ignoreDir struct {
+	dir  string
+	file *filter.IgnoreFile
+}
+
+// withinRoots returns true if dir is one of the backup targets or is
+// contained in one of them.
+func (c *ignoreFiles) withinRoots(dir string) bool {
+	for _, root := range c.roots {
+		if fs.HasPathPrefix(root, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// load returns the rules of the ignore files in dir, which is nil if dir does
+// not contain an ignore file. If several names are configured, the rules of
+// later files take precedence.
+func (c *ignoreFiles) load(dir string) *filter.IgnoreFile {
+	var data [][]byte
+	for _, name := range c.names {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			Warnf("could not read ignore file: %v\n", err)
+			continue
+		}
+		data = append(data, buf)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+	debug.Log("found ignore files in %v", dir)
+	return filter.ParseIgnoreFile(bytes.Join(data, []byte("\n")))
+}
+
+// enter updates the stack for dir, the directories which are not parents of
+// dir are removed and the missing ones up to the backup target are loaded.
+func (c *ignoreFiles) enter(dir string) {
+	for len(c.stack) > 0 && !fs.HasPathPrefix(c.stack[len(c.stack)-1].dir, dir) {
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+
+	var missing []string
+	for d := dir; c.withinRoots(d); {
+		if len(c.stack) > 0 && c.stack[len(c.stack)-1].dir == d {
+			break
+		}
+		missing = append(missing, d)
+
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		c.stack = append(c.stack, ignoreDir{dir: missing[i], file: c.load(missing[i])})
+	}
+}
+
+// Reject returns true if the ignore files of the parent directories of the
+// item with the absolute path abs exclude it.
+func (c *ignoreFiles) Reject(abs string, isDir bool) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.enter(filepath.Dir(abs))
+
+	// the ignore files in deeper directories take precedence
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		d := c.stack[i]
+		if d.file == nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(d.dir, abs)
+		if err != nil {
+			continue
+		}
+		if ignored, matched := d.file.Match(rel, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
+
+// rejectByIgnoreFiles returns a RejectFunc which excludes items according to
+// the ignore files with the given names in their parent directories within
+// the backup targets. The ignore files use the syntax of gitignore files, those
+// in deeper directories take precedence. The returned function must only be
+// used for a single walk of the targets.
+func rejectByIgnoreFiles(names []string, targets []string) (RejectFunc, error) {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return nil, errors.Fatalf("invalid name for ignore file %q", name)
+		}
+	}
+
+	c := &ignoreFiles{names: names}
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		c.roots = append(c.roots, abs)
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		abs, err := filepath.Abs(item)
+		if err != nil {
+			debug.Log("unable to determine absolute path of %v: %v", item, err)
+			return false
+		}
+
+		return c.Reject(abs, fi.IsDir())
+	}, nil
+}
+
+// rejectNodump returns a RejectFunc which rejects files and directories with
+// the nodump inode flag, like dump(8) the contents of such directories are
+// excluded as well. Inode flags are only supported on Linux.
+func rejectNodump() RejectFunc {
+	return func(item string, fi os.FileInfo) bool {
+		if !fi.Mode().IsRegular() && !fi.IsDir() {
+			return false
+		}
+
+		flags, err := fs.GetInodeFlags(item)
+		if err != nil {
+			debug.Log("unable to read inode flags of %v: %v", item, err)
+			return false
+		}
+
+		if flags&fs.InodeFlagNodump != 0 {
+			debug.Log("%v has the nodump flag set", item)
+			return true
+		}
+		return false
+	}
+}
+
 func parseSizeStr(sizeStr string) (int64, error) {
 	if sizeStr == "" {
 		return 0, errors.New("expected size, got empty string")
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -319,6 +320,135 @@ func TestIsExcludedByFileSize(t *testing.T) {
 	}
 }
 
+func TestRejectNodump(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	nodumpFile := filepath.Join(tempDir, "nodump")
+	dumpFile := filepath.Join(tempDir, "dump")
+	nodumpDir := filepath.Join(tempDir, "nodumpdir")
+	test.OK(t, ioutil.WriteFile(nodumpFile, []byte("foo"), 0600))
+	test.OK(t, ioutil.WriteFile(dumpFile, []byte("foo"), 0600))
+	test.OK(t, os.Mkdir(nodumpDir, 0700))
+
+	for _, p := range []string{nodumpFile, nodumpDir} {
+		test.OK(t, fs.SetInodeFlags(p, fs.InodeFlagNodump, fs.InodeFlagNodump))
+	}
+	flags, err := fs.GetInodeFlags(nodumpFile)
+	test.OK(t, err)
+	if flags&fs.InodeFlagNodump == 0 {
+		t.Skip("inode flags are not supported")
+	}
+
+	reject := rejectNodump()
+	for _, item := range []struct {
+		path   string
+		reject bool
+	}{
+		{nodumpFile, true},
+		{dumpFile, false},
+		{nodumpDir, true},
+		{tempDir, false},
+	} {
+		fi, err := os.Lstat(item.path)
+		test.OK(t, err)
+		if reject(item.path, fi) != item.reject {
+			t.Errorf("rejection status of %v is wrong: want %v", item.path, item.reject)
+		}
+	}
+}
+
+func TestRejectByIgnoreFiles(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	files := []struct {
+		path string
+		incl bool
+	}{
+		{".resticignore", true},
+		{"main.go", true},
+		{"main.o", false},
+		{"keep.o", true},
+		{"build/out", false},
+		{"src/.resticignore", true},
+		{"src/foo.o", true},
+		{"src/foo.tmp", false},
+		{"src/build/out", true},
+		{"src/logs/today", false},
+	}
+
+	ignoreFiles := map[string]string{
+		".resticignore":     "*.o\n!keep.o\n/build\nlogs/\n",
+		"src/.resticignore": "!*.o\n*.tmp\n",
+	}
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		test.OK(t, os.MkdirAll(filepath.Dir(p), 0700))
+		test.OK(t, ioutil.WriteFile(p, []byte(ignoreFiles[f.path]), 0600))
+	}
+
+	reject, err := rejectByIgnoreFiles([]string{".resticignore"}, []string{tempDir})
+	test.OK(t, err)
+
+	// mock the archiver walk, which does not descend into rejected directories
+	m := make(map[string]bool)
+	walk := func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		excluded := reject(p, fi)
+		m[p] = !excluded
+		if excluded && fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	test.OK(t, filepath.Walk(tempDir, walk))
+
+	for _, f := range files {
+		p := filepath.Join(tempDir, filepath.FromSlash(f.path))
+		if m[p] != f.incl {
+			t.Errorf("inclusion status of %s is wrong: want %v, got %v", f.path, f.incl, m[p])
+		}
+	}
+
+	_, err = rejectByIgnoreFiles([]string{"sub/.ignore"}, []string{tempDir})
+	test.Assert(t, err != nil, "invalid ignore file name not rejected")
+
+	// ignore files above the backup targets are not used
+	reject, err = rejectByIgnoreFiles([]string{".resticignore"}, []string{filepath.Join(tempDir, "src")})
+	test.OK(t, err)
+	fi, err := os.Lstat(filepath.Join(tempDir, "src", "logs"))
+	test.OK(t, err)
+	test.Assert(t, !reject(filepath.Join(tempDir, "src", "logs"), fi), "ignore file above the backup target was used")
+}
+
+func TestIgnoreFilesStack(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	for _, dir := range []string{"a/b/c", "a/d", "e"} {
+		test.OK(t, os.MkdirAll(filepath.Join(tempDir, filepath.FromSlash(dir)), 0700))
+	}
+	test.OK(t, ioutil.WriteFile(filepath.Join(tempDir, "a", "b", ".resticignore"), []byte("*.tmp\n"), 0600))
+
+	c := &ignoreFiles{names: []string{".resticignore"}, roots: []string{tempDir}}
+	depth := func() int {
+		return len(c.stack)
+	}
+
+	test.Assert(t, c.Reject(filepath.Join(tempDir, "a", "b", "c", "x.tmp"), false), "file not rejected")
+	test.Equals(t, 4, depth())
+
+	// the directories which have been finished are dropped
+	test.Assert(t, !c.Reject(filepath.Join(tempDir, "a", "d", "x.tmp"), false), "file rejected")
+	test.Equals(t, 3, depth())
+	test.Assert(t, !c.Reject(filepath.Join(tempDir, "e", "x.tmp"), false), "file rejected")
+	test.Equals(t, 2, depth())
+}
+
 func TestDeviceMap(t *testing.T) {
 	deviceMap := DeviceMap{
 		filepath.FromSlash("/"):          1,
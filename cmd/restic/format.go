@@ -82,8 +82,23 @@ func formatNode(path string, n *restic.Node, long bool) string {
 		mode = os.ModeSocket
 	}
 
-	return fmt.Sprintf("%s %5d %5d %6d %s %s%s",
+	return fmt.Sprintf("%s %5d %5d %6d %s %s%s%s",
 		mode|n.Mode, n.UID, n.GID, n.Size,
 		n.ModTime.Local().Format(TimeFormat), path,
-		target)
+		target, formatACLs(n))
+}
+
+// formatACLs returns the POSIX ACLs of the node for the long listing format,
+// with a leading space, or an empty string if the node has no ACLs.
+func formatACLs(n *restic.Node) string {
+	access, def := n.ACLs()
+
+	var s string
+	if access != nil && len(access.Entries) > 0 {
+		s += " acl=" + access.Short()
+	}
+	if def != nil && len(def.Entries) > 0 {
+		s += " default-acl=" + def.Short()
+	}
+	return s
 }
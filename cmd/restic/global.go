@@ -68,6 +68,7 @@ type GlobalOptions struct {
 	LimitUploadKb   int
 	LimitDownloadKb int
 	MinPackSize     uint
+	Compression     repository.CompressionMode
 
 	ctx      context.Context
 	password string
@@ -129,6 +130,7 @@ func init() {
 	f.IntVar(&globalOptions.LimitUploadKb, "limit-upload", 0, "limits uploads to a maximum rate in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.LimitDownloadKb, "limit-download", 0, "limits downloads to a maximum rate in KiB/s. (default: unlimited)")
 	f.UintVar(&globalOptions.MinPackSize, "min-packsize", 0, "set min pack size in MiB. (default: $RESTIC_MIN_PACKSIZE or 4)")
+	f.Var(&globalOptions.Compression, "compression", "compression mode (only available for repository format version 2), one of (auto|off|max) (default: $RESTIC_COMPRESSION)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
 	// Use our "generate" command instead of the cobra provided "completion" command
 	cmdRoot.CompletionOptions.DisableDefaultCmd = true
@@ -138,6 +140,12 @@ func init() {
 		globalOptions.MinPackSize = uint(minPackSize)
 	}
 
+	// set the compression mode from the environment, the flag overrides it.
+	// Invalid values are reported in the PersistentPreRunE of cmdRoot.
+	if comp := os.Getenv("RESTIC_COMPRESSION"); comp != "" {
+		_ = globalOptions.Compression.Set(comp)
+	}
+
 	restoreTerminal()
 }
 
@@ -467,7 +475,10 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 		}
 	}
 
-	s := repository.New(be, opts.MinPackSize*1024*1024)
+	s := repository.New(be, repository.Options{
+		Compression: opts.Compression,
+		MinPackSize: opts.MinPackSize * 1024 * 1024,
+	})
 
 	passwordTriesLeft := 1
 	if stdinIsTerminal() && opts.password == "" {
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"encoding/json"
@@ -98,6 +99,30 @@ func testRunList(t testing.TB, tpe string, opts GlobalOptions) restic.IDs {
 	return parseIDsFromReader(t, buf)
 }
 
+func testRunRestoreAssumeFailure(t testing.TB, snapshotID string, opts RestoreOptions, gopts GlobalOptions) error {
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var wg errgroup.Group
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	wg.Go(func() error { term.Run(ctx); return nil })
+
+	var args []string
+	if snapshotID != "" {
+		args = []string{snapshotID}
+	}
+	restoreErr := runRestore(opts, gopts, term, args)
+
+	cancel()
+
+	err := wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return restoreErr
+}
+
 func testRunRestore(t testing.TB, opts GlobalOptions, dir string, snapshotID restic.ID) {
 	testRunRestoreExcludes(t, opts, dir, snapshotID, nil)
 }
@@ -109,7 +134,7 @@ func testRunRestoreLatest(t testing.TB, gopts GlobalOptions, dir string, paths [
 		Paths:  paths,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{"latest"}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, "latest", opts, gopts))
 }
 
 func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, excludes []string) {
@@ -118,7 +143,7 @@ func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Exclude: excludes,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, snapshotID.String(), opts, gopts))
 }
 
 func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, includes []string) {
@@ -127,7 +152,7 @@ func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Include: includes,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreAssumeFailure(t, snapshotID.String(), opts, gopts))
 }
 
 func testRunCheck(t testing.TB, gopts GlobalOptions) {
@@ -345,6 +370,36 @@ func testBackup(t *testing.T, useFsSnapshot bool) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestBackupFilesCache(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{FilesCache: true}
+
+	// the first backup fills the files cache, the second one uses it
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	stat1 := dirStats(env.repo)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2,
+		"expected two snapshots, got %v", snapshotIDs)
+
+	stat2 := dirStats(env.repo)
+	if stat2.size > stat1.size+stat1.size/10 {
+		t.Error("repository size has grown by more than 10 percent")
+	}
+
+	for i, snapshotID := range snapshotIDs {
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env.gopts, restoredir, snapshotID)
+		diff := directoriesContentsDiff(env.testdata, filepath.Join(restoredir, "testdata"))
+		rtest.Assert(t, diff == "", "directories are not equal: %v", diff)
+	}
+
+	testRunCheck(t, env.gopts)
+}
+
 func TestBackupNonExistingFile(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -470,6 +525,263 @@ func TestBackupTreeLoadError(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func testRunRepairSnapshots(t testing.TB, gopts GlobalOptions, opts RepairOptions) {
+	rtest.OK(t, runRepairSnapshots(opts, gopts, nil))
+}
+
+func TestRepairSnapshotsWithLostData(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	p := filepath.Join(env.testdata, "test/test")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	rtest.OK(t, appendRandomData(p, 5))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "test/other"), []byte("other"), 0644))
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+	oldSnapshots := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(oldSnapshots) == 1, "expected one snapshot, got %v", oldSnapshots)
+
+	// remove all data packs
+	removePacksExcept(env.gopts, t, restic.NewIDSet(), false)
+	testRunRebuildIndex(t, env.gopts)
+	rtest.Assert(t, runCheck(CheckOptions{}, env.gopts, nil) != nil,
+		"check should have reported an error")
+
+	// a dry run must not modify the repository
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{DryRun: true})
+	rtest.Equals(t, oldSnapshots, testRunList(t, "snapshots", env.gopts))
+
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{Forget: true})
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	rtest.Assert(t, !snapshotIDs[0].Equal(oldSnapshots[0]), "snapshot was not replaced")
+
+	r, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, r, snapshotIDs[0])
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.Original != nil && sn.Original.Equal(oldSnapshots[0]),
+		"new snapshot does not reference the original snapshot, got %v", sn.Original)
+
+	// the repaired snapshot still contains the files, but without content
+	lsOutput := testRunLs(t, env.gopts, snapshotIDs[0].String())
+	rtest.Assert(t, includes(lsOutput, "/testdata/test/test"), "file is missing in repaired snapshot: %v", lsOutput)
+	rtest.Assert(t, includes(lsOutput, "/testdata/test/other"), "file is missing in repaired snapshot: %v", lsOutput)
+}
+
+func TestRepairSnapshotsWithLostTree(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	p := filepath.Join(env.testdata, "test/test")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	rtest.OK(t, appendRandomData(p, 5))
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	oldSnapshots := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(oldSnapshots) == 1, "expected one snapshot, got %v", oldSnapshots)
+
+	// remove all tree packs, the root tree of the snapshot is unreadable
+	removePacksExcept(env.gopts, t, restic.NewIDSet(), true)
+	testRunRebuildIndex(t, env.gopts)
+
+	// without --forget, the damaged snapshot must be kept
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{})
+	rtest.Equals(t, oldSnapshots, testRunList(t, "snapshots", env.gopts))
+
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{Forget: true, DryRun: true})
+	rtest.Equals(t, oldSnapshots, testRunList(t, "snapshots", env.gopts))
+
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{Forget: true})
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 0, "expected no snapshots, got %v", snapshotIDs)
+}
+
+func testRunRepairPacks(t testing.TB, gopts GlobalOptions, backupDir string, ids restic.IDs) {
+	var args []string
+	for _, id := range ids {
+		args = append(args, id.String())
+	}
+	rtest.OK(t, runRepairPacks(RepairPacksOptions{BackupDir: backupDir}, gopts, args))
+}
+
+func TestRepairPacks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// use several files so that the pack contains several blobs
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(env.testdata, "test", fmt.Sprintf("file%d", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, 100*1024))
+	}
+	// save blobs sequentially to store them in a single pack
+	env.gopts.MinPackSize = 4
+	opts := BackupOptions{FileReadConcurrency: 1, SaveBlobConcurrency: 1}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	r, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, r.LoadIndex(env.gopts.ctx))
+	treePacks := restic.NewIDSet()
+	for _, idx := range r.Index().(*repository.MasterIndex).All() {
+		for _, id := range idx.TreePacks() {
+			treePacks.Insert(id)
+		}
+	}
+
+	// damage a single blob in the middle of a data pack
+	var damagedPack restic.ID
+	var damagedBlob restic.Blob
+	var packBlobCount int
+	for pb := range r.Index().Each(env.gopts.ctx) {
+		if treePacks.Has(pb.PackID) {
+			continue
+		}
+		if damagedPack.IsNull() {
+			damagedPack = pb.PackID
+		}
+		if pb.PackID.Equal(damagedPack) {
+			packBlobCount++
+			if pb.Offset > 0 {
+				damagedBlob = pb.Blob
+			}
+		}
+	}
+	rtest.Assert(t, packBlobCount > 1, "expected several blobs in pack %v, got %v", damagedPack, packBlobCount)
+
+	packFile := filepath.Join(env.repo, "data", damagedPack.String()[:2], damagedPack.String())
+	buf, err := ioutil.ReadFile(packFile)
+	rtest.OK(t, err)
+	buf[damagedBlob.Offset+damagedBlob.Length/2] ^= 0x01
+	rtest.OK(t, os.Chmod(packFile, 0644))
+	rtest.OK(t, ioutil.WriteFile(packFile, buf, 0644))
+	rtest.Assert(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil) != nil,
+		"check should have reported an error")
+
+	backupDir := filepath.Join(env.base, "damaged-packs")
+	testRunRepairPacks(t, env.gopts, backupDir, restic.IDs{damagedPack})
+	_, err = os.Stat(filepath.Join(backupDir, "pack-"+damagedPack.String()))
+	rtest.OK(t, err)
+
+	r, err = OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, r.LoadIndex(env.gopts.ctx))
+	for pb := range r.Index().Each(env.gopts.ctx) {
+		rtest.Assert(t, !pb.PackID.Equal(damagedPack), "damaged pack is still referenced by the index")
+	}
+	rtest.Assert(t, !r.Index().Has(damagedBlob.BlobHandle), "damaged blob is still referenced by the index")
+	rtest.Equals(t, packBlobCount-1, countDataBlobs(env.gopts.ctx, r))
+
+	// only the damaged blob is missing, remove it from the snapshot
+	testRunRepairSnapshots(t, env.gopts, RepairOptions{Forget: true})
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+}
+
+func countDataBlobs(ctx context.Context, repo restic.Repository) int {
+	count := 0
+	for pb := range repo.Index().Each(ctx) {
+		if pb.Type == restic.DataBlob {
+			count++
+		}
+	}
+	return count
+}
+
+func testRunRewriteExclude(t testing.TB, gopts GlobalOptions, excludes []string, forget bool) {
+	opts := RewriteOptions{
+		excludePatternOptions: excludePatternOptions{Excludes: excludes},
+		Forget:                forget,
+	}
+
+	rtest.OK(t, runRewrite(opts, gopts, nil))
+}
+
+func testSetupRewriteData(t testing.TB, env *testEnvironment) []byte {
+	secret := []byte("secret data which must not stay in the repository")
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "data"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "data", "secret"), secret, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "data", "public"), []byte("public data"), 0644))
+	return secret
+}
+
+func TestRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	testSetupRewriteData(t, env)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	oldSnapshots := testRunList(t, "snapshots", env.gopts)
+
+	// an exclude pattern is required
+	rtest.Assert(t, runRewrite(RewriteOptions{}, env.gopts, nil) != nil,
+		"rewrite without excludes should have failed")
+
+	// a non-matching pattern must not modify any snapshot
+	testRunRewriteExclude(t, env.gopts, []string{"nonexistent"}, false)
+	rtest.Equals(t, oldSnapshots, testRunList(t, "snapshots", env.gopts))
+
+	testRunRewriteExclude(t, env.gopts, []string{"secret"}, false)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+	testRunCheck(t, env.gopts)
+
+	newID := snapshotIDs[0]
+	if newID.Equal(oldSnapshots[0]) {
+		newID = snapshotIDs[1]
+	}
+	r, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	sn, err := restic.LoadSnapshot(env.gopts.ctx, r, newID)
+	rtest.OK(t, err)
+	rtest.Assert(t, sn.Original != nil && sn.Original.Equal(oldSnapshots[0]),
+		"new snapshot does not reference the original snapshot, got %v", sn.Original)
+	rtest.Assert(t, includes(sn.Tags, "rewrite"), "new snapshot is not tagged, got %v", sn.Tags)
+
+	lsOutput := testRunLs(t, env.gopts, newID.String())
+	rtest.Assert(t, !includes(lsOutput, "/testdata/data/secret"), "excluded file is still present: %v", lsOutput)
+	rtest.Assert(t, includes(lsOutput, "/testdata/data/public"), "file is missing: %v", lsOutput)
+}
+
+func TestRewriteForgetAndPrune(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	secret := testSetupRewriteData(t, env)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	// the file is small enough to be stored as a single blob
+	secretBlob := restic.BlobHandle{ID: restic.Hash(secret), Type: restic.DataBlob}
+	hasSecretBlob := func() bool {
+		r, err := OpenRepository(env.gopts)
+		rtest.OK(t, err)
+		rtest.OK(t, r.LoadIndex(env.gopts.ctx))
+		return r.Index().Has(secretBlob)
+	}
+	rtest.Assert(t, hasSecretBlob(), "secret blob is missing after backup")
+
+	testRunRewriteExclude(t, env.gopts, []string{"secret"}, true)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	testRunPrune(t, env.gopts, PruneOptions{MaxUnused: "0%"})
+	testRunCheck(t, env.gopts)
+	rtest.Assert(t, !hasSecretBlob(), "secret blob is still present after prune")
+}
+
 func includes(haystack []string, needle string) bool {
 	for _, s := range haystack {
 		if s == needle {
@@ -581,6 +893,91 @@ func TestBackupErrors(t *testing.T) {
 		"expected one snapshot, got %v", snapshotIDs)
 }
 
+func TestBackupStdinFromCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	opts := BackupOptions{
+		StdinFromCommand: true,
+		StdinFilename:    "data.txt",
+		StdinCommands:    []string{"other=echo other"},
+	}
+	testRunBackup(t, "", []string{"echo", "foo"}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	lines := testRunLs(t, env.gopts, snapshotIDs[0].String())
+	for _, name := range []string{"/data.txt", "/other"} {
+		rtest.Assert(t, testHasLine(lines, name), "file %v not found in snapshot, ls output: %v", name, lines)
+	}
+
+	// the incomplete output of a failing command must not be saved
+	gopts := env.gopts
+	gopts.stderr = ioutil.Discard
+	opts = BackupOptions{StdinFromCommand: true, StdinFilename: "stdin"}
+	err := testRunBackupAssumeFailure(t, "", []string{"sh", "-c", "echo partial; exit 1"}, opts, gopts)
+	rtest.Assert(t, err != nil, "failing command did not return an error")
+	rtest.Assert(t, strings.Contains(err.Error(), "exit status 1"), "unexpected error %v", err)
+
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+}
+
+func TestBackupFromTar(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := testSetupBackupData(t, env)
+
+	// uncompress the archive which was unpacked into env.testdata
+	in, err := os.Open(datafile)
+	rtest.OK(t, err)
+	gzr, err := gzip.NewReader(in)
+	rtest.OK(t, err)
+	tarfile := filepath.Join(env.base, "backup-data.tar")
+	out, err := os.Create(tarfile)
+	rtest.OK(t, err)
+	_, err = io.Copy(out, gzr)
+	rtest.OK(t, err)
+	rtest.OK(t, out.Close())
+	rtest.OK(t, gzr.Close())
+	rtest.OK(t, in.Close())
+
+	testRunBackup(t, "", nil, BackupOptions{FromTar: tarfile}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	fromTar := testRunLs(t, env.gopts, snapshotIDs[0].String())
+
+	testRunBackup(t, env.testdata, []string{"."}, BackupOptions{}, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	fromDir := testRunLs(t, env.gopts, newest.ID.String())
+
+	// the first line contains the snapshot
+	rtest.Equals(t, fromDir[1:], fromTar[1:])
+
+	testRunCheck(t, env.gopts)
+
+	// archives cannot be read from stdin, compressed archives are rejected
+	err = testRunBackupAssumeFailure(t, "", nil, BackupOptions{FromTar: "-"}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "stdin"), "unexpected error %v", err)
+	err = testRunBackupAssumeFailure(t, "", nil, BackupOptions{FromTar: datafile}, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "gzip"), "unexpected error %v", err)
+}
+
+func testHasLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
 const (
 	incrementalFirstWrite  = 10 * 1042 * 1024
 	incrementalSecondWrite = 1 * 1042 * 1024
@@ -1096,6 +1493,43 @@ func TestRestoreFilter(t *testing.T) {
 	}
 }
 
+func TestRestoreFilesFrom(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, name := range []string{"file1", "file2", "subdir1/file3", "subdir2/file4"} {
+		p := filepath.Join(env.testdata, name)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, 100))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotID := testRunList(t, "snapshots", env.gopts)[0]
+
+	filesFrom := filepath.Join(env.base, "files-from")
+	rtest.OK(t, ioutil.WriteFile(filesFrom, []byte("/testdata/file1\n/testdata/subdir2\n"), 0644))
+
+	target := filepath.Join(env.base, "restore")
+	opts := RestoreOptions{Target: target, FilesFrom: []string{filesFrom}}
+	rtest.OK(t, testRunRestoreAssumeFailure(t, snapshotID.String(), opts, env.gopts))
+
+	for name, exists := range map[string]bool{
+		"file1":         true,
+		"file2":         false,
+		"subdir1":       false,
+		"subdir2/file4": true,
+	} {
+		_, err := os.Stat(filepath.Join(target, "testdata", filepath.FromSlash(name)))
+		if exists {
+			rtest.OK(t, err)
+		} else {
+			rtest.Assert(t, os.IsNotExist(err), "expected %v to not exist, err %v", name, err)
+		}
+	}
+}
+
 func TestRestore(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1188,6 +1622,113 @@ func TestRestoreLatest(t *testing.T) {
 	}
 }
 
+func TestRestoreFromHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	back := rtest.Chdir(t, filepath.Dir(env.testdata))
+	defer back()
+
+	p := filepath.Join(env.testdata, "dir", "testfile")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	other := filepath.Join(env.testdata, "other")
+	rtest.OK(t, appendRandomData(other, 10))
+
+	opts := BackupOptions{}
+	// the file changes size in every version, the third backup does not
+	// modify it
+	for _, size := range []int{100, 101, -1, 102} {
+		if size >= 0 {
+			rtest.OK(t, os.RemoveAll(p))
+			rtest.OK(t, appendRandomData(p, uint(size)))
+		}
+		testRunBackup(t, "", []string{filepath.Base(env.testdata)}, opts, env.gopts)
+	}
+
+	// the file is deleted in the latest snapshot
+	rtest.OK(t, os.RemoveAll(filepath.Dir(p)))
+	testRunBackup(t, "", []string{filepath.Base(env.testdata)}, opts, env.gopts)
+
+	historyPath := "/" + filepath.Base(env.testdata) + "/dir/testfile"
+	for version, size := range []int64{102, 101, 100} {
+		target := filepath.Join(env.base, fmt.Sprintf("restore%d", version))
+		opts := RestoreOptions{
+			Target:         target,
+			FromHistory:    historyPath,
+			HistoryVersion: version,
+		}
+		rtest.OK(t, testRunRestoreAssumeFailure(t, "", opts, env.gopts))
+
+		rtest.OK(t, testFileSize(filepath.Join(target, filepath.FromSlash(historyPath)), size))
+		_, err := os.Stat(filepath.Join(target, filepath.Base(env.testdata), "other"))
+		rtest.Assert(t, os.IsNotExist(err), "other file was restored, err %v", err)
+	}
+
+	opts3 := RestoreOptions{Target: filepath.Join(env.base, "restore3"), FromHistory: historyPath, HistoryVersion: 3}
+	err := testRunRestoreAssumeFailure(t, "", opts3, env.gopts)
+	rtest.Assert(t, err != nil, "restoring a nonexisting version did not fail")
+
+	opts3 = RestoreOptions{Target: filepath.Join(env.base, "restore3"), FromHistory: "/nonexisting"}
+	err = testRunRestoreAssumeFailure(t, "", opts3, env.gopts)
+	rtest.Assert(t, err != nil, "restoring a nonexisting path did not fail")
+}
+
+// corruptDataPacks overwrites the beginning of all packs containing data
+// blobs with zeros.
+func corruptDataPacks(gopts GlobalOptions, t *testing.T) {
+	r, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+
+	rtest.OK(t, r.LoadIndex(gopts.ctx))
+	treePacks := restic.NewIDSet()
+	for _, idx := range r.Index().(*repository.MasterIndex).All() {
+		for _, id := range idx.TreePacks() {
+			treePacks.Insert(id)
+		}
+	}
+
+	rtest.OK(t, r.List(gopts.ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		if treePacks.Has(id) {
+			return nil
+		}
+		filename := filepath.Join(gopts.Repo, "data", id.String()[:2], id.String())
+		rtest.OK(t, os.Chmod(filename, 0644))
+		f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+		rtest.OK(t, err)
+		_, err = f.WriteAt(make([]byte, size/2), 0)
+		rtest.OK(t, err)
+		return f.Close()
+	}))
+}
+
+func TestRestoreIgnoreMissing(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	p := filepath.Join(env.testdata, "testfile")
+	rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+	rtest.OK(t, appendRandomData(p, 1000))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+
+	corruptDataPacks(env.gopts, t)
+
+	target := filepath.Join(env.base, "restore")
+	err := testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: target}, env.gopts)
+	rtest.Assert(t, err != nil && err != ErrPartialRestore, "expected restore to fail, got %v", err)
+
+	rtest.OK(t, os.RemoveAll(target))
+	err = testRunRestoreAssumeFailure(t, "latest", RestoreOptions{Target: target, IgnoreMissing: true}, env.gopts)
+	rtest.Equals(t, ErrPartialRestore, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(target, "testdata", "testfile"))
+	rtest.OK(t, err)
+	rtest.Equals(t, make([]byte, 1000), data)
+}
+
 func TestRestoreWithPermissionFailure(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1938,3 +2479,33 @@ func TestBackendLoadWriteTo(t *testing.T) {
 	// test readData using the hashing.Reader
 	testRunCheck(t, env.gopts)
 }
+
+func TestMigrateUpgradeRepoV2(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+	rtest.OK(t, runInit(InitOptions{RepositoryVersion: "1"}, env.gopts, nil))
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v2"}))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(2), repo.Config().Version)
+
+	// the new backup stores compressed blobs next to the uncompressed ones
+	data := bytes.Repeat([]byte("compressible"), 1024*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "0", "compressible"), data, 0644))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
@@ -45,6 +46,10 @@ directories in an encrypted repository stored on different backends.
 			globalOptions.verbosity = 0
 		}
 
+		if globalOptions.Compression == repository.CompressionInvalid {
+			return errors.Fatal("invalid compression mode, must be one of (auto|off|max)")
+		}
+
 		// parse extended options
 		opts, err := options.Parse(globalOptions.Options)
 		if err != nil {
@@ -100,7 +105,7 @@ func main() {
 	switch {
 	case restic.IsAlreadyLocked(errors.Cause(err)):
 		fmt.Fprintf(os.Stderr, "%v\nthe `unlock` command can be used to remove stale locks\n", err)
-	case err == ErrInvalidSourceData:
+	case err == ErrInvalidSourceData || err == ErrPartialRestore:
 		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	case errors.IsFatal(errors.Cause(err)):
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -120,7 +125,7 @@ func main() {
 	switch err {
 	case nil:
 		exitCode = 0
-	case ErrInvalidSourceData:
+	case ErrInvalidSourceData, ErrPartialRestore:
 		exitCode = 3
 	default:
 		exitCode = 1
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/textfile"
+	"github.com/spf13/pflag"
+)
+
+// ownerMappingOptions collects the options for translating the owner of
+// files.
+type ownerMappingOptions struct {
+	MapUIDs  []string
+	MapGIDs  []string
+	MapFiles []string
+}
+
+func initOwnerMappingOptions(f *pflag.FlagSet, opts *ownerMappingOptions) {
+	f.StringArrayVar(&opts.MapUIDs, "map-uid", nil, "translate the user ID `old:new` stored in the snapshot (can be specified multiple times)")
+	f.StringArrayVar(&opts.MapGIDs, "map-gid", nil, "translate the group ID `old:new` stored in the snapshot (can be specified multiple times)")
+	f.StringArrayVar(&opts.MapFiles, "map-file", nil, "read user and group ID translations from a `file` (can be specified multiple times)")
+}
+
+// OwnerMapping returns the mapping configured by the options, IDs from the
+// map files are added first, such that --map-uid and --map-gid take
+// precedence.
+func (opts ownerMappingOptions) OwnerMapping() (*restic.OwnerMapping, error) {
+	m := &restic.OwnerMapping{
+		UIDs: make(map[uint32]uint32),
+		GIDs: make(map[uint32]uint32),
+	}
+
+	for _, filename := range opts.MapFiles {
+		err := readOwnerMappingFile(filename, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range opts.MapUIDs {
+		err := addIDMapping(m.UIDs, spec)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --map-uid: %v", err)
+		}
+	}
+
+	for _, spec := range opts.MapGIDs {
+		err := addIDMapping(m.GIDs, spec)
+		if err != nil {
+			return nil, errors.Fatalf("invalid --map-gid: %v", err)
+		}
+	}
+
+	return m, nil
+}
+
+// readOwnerMappingFile reads ID translations from filename. Each line has
+// the form "uid old:new" or "gid old:new". Empty lines and lines starting
+// with "#" are ignored.
+func readOwnerMappingFile(filename string, m *restic.OwnerMapping) error {
+	data, err := textfile.Read(filename)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.Fatalf("%s:%d: invalid line %q, expected \"uid old:new\" or \"gid old:new\"", filename, lineNo, line)
+		}
+
+		switch fields[0] {
+		case "uid":
+			err = addIDMapping(m.UIDs, fields[1])
+		case "gid":
+			err = addIDMapping(m.GIDs, fields[1])
+		default:
+			err = errors.Errorf("unknown type %q, must be uid or gid", fields[0])
+		}
+		if err != nil {
+			return errors.Fatalf("%s:%d: %v", filename, lineNo, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// addIDMapping parses spec of the form "old:new" and adds it to ids.
+func addIDMapping(ids map[uint32]uint32, spec string) error {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 {
+		return errors.Errorf("invalid mapping %q, expected old:new", spec)
+	}
+
+	var values [2]uint32
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid ID %q in mapping %q", part, spec)
+		}
+		values[i] = uint32(v)
+	}
+
+	ids[values[0]] = values[1]
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOwnerMappingOptions(t *testing.T) {
+	tempDir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	mapFile := filepath.Join(tempDir, "map")
+	rtest.OK(t, ioutil.WriteFile(mapFile, []byte(`# translate the users from the old server
+uid 1000:2000
+uid 1001:2001
+
+gid 100:200
+`), 0644))
+
+	opts := ownerMappingOptions{
+		MapUIDs:  []string{"1001:3001", "0:10"},
+		MapGIDs:  []string{"50:60"},
+		MapFiles: []string{mapFile},
+	}
+	m, err := opts.OwnerMapping()
+	rtest.OK(t, err)
+	rtest.Equals(t, map[uint32]uint32{1000: 2000, 1001: 3001, 0: 10}, m.UIDs)
+	rtest.Equals(t, map[uint32]uint32{100: 200, 50: 60}, m.GIDs)
+
+	for _, opts := range []ownerMappingOptions{
+		{MapUIDs: []string{"1000"}},
+		{MapUIDs: []string{"1000:2000:3000"}},
+		{MapGIDs: []string{"foo:100"}},
+		{MapGIDs: []string{"100:-1"}},
+	} {
+		_, err := opts.OwnerMapping()
+		rtest.Assert(t, err != nil, "expected error for %v", opts)
+	}
+
+	rtest.OK(t, ioutil.WriteFile(mapFile, []byte("user 1000:2000\n"), 0644))
+	_, err = ownerMappingOptions{MapFiles: []string{mapFile}}.OwnerMapping()
+	rtest.Assert(t, err != nil, "expected error for invalid map file")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// cleanHistoryPath returns the slash-separated absolute path of p within a
+// snapshot.
+func cleanHistoryPath(p string) string {
+	return path.Join("/", filepath.ToSlash(p))
+}
+
+// findNodeInSnapshot returns the node at the slash-separated absolute path
+// p within the snapshot sn. If the snapshot does not contain the path, nil
+// is returned.
+func findNodeInSnapshot(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, p string) (*restic.Node, error) {
+	var found *restic.Node
+	err := walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			return false, nil
+		}
+
+		if found != nil {
+			return false, walker.ErrSkipNode
+		}
+
+		if nodepath == p {
+			found = node
+			return false, walker.ErrSkipNode
+		}
+
+		// only descend into the directories on the way to p
+		if node.Type == "dir" && !fs.HasPathPrefix(nodepath, p) {
+			return false, walker.ErrSkipNode
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// sameVersion returns true if the nodes a and b have the same content.
+// Metadata like the access time is ignored.
+func sameVersion(a, b *restic.Node) bool {
+	if a.Type != b.Type || a.Size != b.Size || !a.ModTime.Equal(b.ModTime) || a.LinkTarget != b.LinkTarget {
+		return false
+	}
+
+	if (a.Subtree == nil) != (b.Subtree == nil) || (a.Subtree != nil && !a.Subtree.Equal(*b.Subtree)) {
+		return false
+	}
+
+	if len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !a.Content[i].Equal(b.Content[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findPathInHistory searches the snapshots from newest to oldest for the
+// slash-separated absolute path p. Snapshots which contain an unchanged copy
+// of a newer version are skipped, version selects how many versions to go
+// back, 0 is the most recent version. The most recent snapshot containing the
+// selected version is returned.
+func findPathInHistory(ctx context.Context, repo restic.Repository, snapshots restic.Snapshots, p string, version int) (*restic.Snapshot, *restic.Node, error) {
+	// sort newest first
+	sort.Sort(snapshots)
+
+	var (
+		current      *restic.Node
+		currentSn    *restic.Snapshot
+		versionFound int
+	)
+
+	for _, sn := range snapshots {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		node, err := findNodeInSnapshot(ctx, repo, sn, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if node == nil {
+			debug.Log("path %v not found in snapshot %v", p, sn.ID().Str())
+			continue
+		}
+
+		if current != nil && sameVersion(current, node) {
+			continue
+		}
+
+		if current != nil {
+			if versionFound == version {
+				break
+			}
+			versionFound++
+		}
+
+		current, currentSn = node, sn
+	}
+
+	if current == nil {
+		return nil, nil, errors.Fatalf("path %v not found in any snapshot", p)
+	}
+	if versionFound != version {
+		return nil, nil, errors.Fatalf("path %v only has %d versions", p, versionFound+1)
+	}
+
+	return currentSn, current, nil
+}
+
+type selectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+// selectHistoryPathFilter returns a filter which only selects the
+// slash-separated absolute path p and the items below it, within which the
+// decision is left to next.
+func selectHistoryPathFilter(p string, next selectFilter) selectFilter {
+	p = filepath.FromSlash(p)
+	return func(item string, dstpath string, node *restic.Node) (bool, bool) {
+		switch {
+		case fs.HasPathPrefix(p, item):
+			return next(item, dstpath, node)
+		case fs.HasPathPrefix(item, p):
+			// item is a directory on the way to p
+			_, childMayBeSelected := next(item, dstpath, node)
+			return false, childMayBeSelected
+		default:
+			return false, false
+		}
+	}
+}
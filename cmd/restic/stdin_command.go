@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// stdinCommand is a command whose standard output is saved as the file
+// filename in the snapshot.
+type stdinCommand struct {
+	filename string
+	args     []string
+}
+
+// collectStdinCommands returns the commands specified via --stdin-command and
+// the command passed as the arguments for --stdin-from-command, which is saved
+// as the file --stdin-filename.
+func collectStdinCommands(opts BackupOptions, args []string) ([]stdinCommand, error) {
+	var cmds []stdinCommand
+	if opts.StdinFromCommand && len(args) > 0 {
+		cmds = append(cmds, stdinCommand{
+			filename: path.Join("/", opts.StdinFilename),
+			args:     args,
+		})
+	}
+
+	for _, spec := range opts.StdinCommands {
+		cmd, err := parseStdinCommand(spec)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	seen := make(map[string]struct{}, len(cmds))
+	for _, cmd := range cmds {
+		if _, ok := seen[cmd.filename]; ok {
+			return nil, errors.Fatalf("the output of several commands would be saved as %v", cmd.filename)
+		}
+		seen[cmd.filename] = struct{}{}
+	}
+
+	return cmds, nil
+}
+
+// parseStdinCommand parses a command in the format "name=command args...",
+// the command is split into its arguments like a shell would do it.
+func parseStdinCommand(spec string) (stdinCommand, error) {
+	data := strings.SplitN(spec, "=", 2)
+	if len(data) != 2 || data[0] == "" {
+		return stdinCommand{}, errors.Fatalf("invalid command %q, expected name=command", spec)
+	}
+
+	args, err := backend.SplitShellStrings(data[1])
+	if err != nil {
+		return stdinCommand{}, errors.Fatalf("invalid command %q: %v", spec, err)
+	}
+	if len(args) == 0 {
+		return stdinCommand{}, errors.Fatalf("invalid command %q, the command is empty", spec)
+	}
+
+	return stdinCommand{
+		filename: path.Join("/", data[0]),
+		args:     args,
+	}, nil
+}
+
+// startStdinCommands starts all commands and returns a file system which
+// contains their standard output. The standard error of the commands is
+// written to stderr.
+func startStdinCommands(ctx context.Context, cmds []stdinCommand, modTime time.Time, stderr io.Writer) (*fs.MultiReader, error) {
+	readers := make([]*fs.Reader, 0, len(cmds))
+	for _, cmd := range cmds {
+		rd, err := fs.NewCommandReader(ctx, cmd.args, stderr)
+		if err != nil {
+			// stop the commands started so far
+			for _, r := range readers {
+				_ = r.Close()
+			}
+			return nil, err
+		}
+
+		readers = append(readers, &fs.Reader{
+			ModTime:        modTime,
+			Name:           cmd.filename,
+			Mode:           0644,
+			ReadCloser:     rd,
+			AllowEmptyFile: true,
+		})
+	}
+
+	return &fs.MultiReader{Readers: readers}, nil
+}
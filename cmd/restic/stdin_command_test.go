@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseStdinCommand(t *testing.T) {
+	var tests = []struct {
+		spec     string
+		filename string
+		args     []string
+		err      bool
+	}{
+		{"db=pg_dump mydb", "/db", []string{"pg_dump", "mydb"}, false},
+		{"dumps/db.sql=pg_dump -c 'my db'", "/dumps/db.sql", []string{"pg_dump", "-c", "my db"}, false},
+		{"db=sh -c 'echo a=b'", "/db", []string{"sh", "-c", "echo a=b"}, false},
+		{"pg_dump mydb", "", nil, true},
+		{"=pg_dump mydb", "", nil, true},
+		{"db=", "", nil, true},
+		{"db=pg_dump 'mydb", "", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			cmd, err := parseStdinCommand(test.spec)
+			if test.err {
+				rtest.Assert(t, err != nil, "expected error for %q, got nil", test.spec)
+				return
+			}
+			rtest.OK(t, err)
+			rtest.Equals(t, test.filename, cmd.filename)
+			rtest.Equals(t, test.args, cmd.args)
+		})
+	}
+}
+
+func TestCollectStdinCommands(t *testing.T) {
+	opts := BackupOptions{
+		StdinFromCommand: true,
+		StdinFilename:    "stdin",
+		StdinCommands:    []string{"db=pg_dump mydb"},
+	}
+
+	cmds, err := collectStdinCommands(opts, []string{"tar", "-c", "/etc"})
+	rtest.OK(t, err)
+	rtest.Equals(t, []stdinCommand{
+		{filename: "/stdin", args: []string{"tar", "-c", "/etc"}},
+		{filename: "/db", args: []string{"pg_dump", "mydb"}},
+	}, cmds)
+
+	opts.StdinCommands = append(opts.StdinCommands, "stdin=echo foo")
+	_, err = collectStdinCommands(opts, []string{"tar", "-c", "/etc"})
+	rtest.Assert(t, err != nil, "duplicate file names were not rejected")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/pflag"
+)
+
+// xattrFilterOptions collects the options for selecting extended attributes.
+type xattrFilterOptions struct {
+	XattrInclude []string
+	XattrExclude []string
+}
+
+func initXattrFilterOptions(f *pflag.FlagSet, opts *xattrFilterOptions) {
+	f.StringArrayVar(&opts.XattrInclude, "xattr-include", nil, "only process extended attributes whose name matches `pattern`, e.g. 'user.*' (can be specified multiple times)")
+	f.StringArrayVar(&opts.XattrExclude, "xattr-exclude", nil, "skip extended attributes whose name matches `pattern`, e.g. 'security.*' (can be specified multiple times)")
+}
+
+// XattrFilter returns the filter configured by the options.
+func (opts xattrFilterOptions) XattrFilter() (*restic.XattrFilter, error) {
+	f, err := restic.NewXattrFilter(opts.XattrInclude, opts.XattrExclude)
+	if err != nil {
+		return nil, errors.Fatal(err.Error())
+	}
+	return f, nil
+}
@@ -57,6 +57,10 @@ type Archiver struct {
 	fileSaver *FileSaver
 	treeSaver *TreeSaver
 
+	// checkpoint records the completed items, it is nil if no checkpoints
+	// are saved.
+	checkpoint *checkpointTree
+
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
 
@@ -80,8 +84,21 @@ type Archiver struct {
 	// default.
 	WithAtime bool
 
+	// WithInodeFlags configures if the inode flags and the creation time of
+	// files and directories should be saved. Reading them needs additional
+	// system calls for each item, so it's off by default.
+	WithInodeFlags bool
+
+	// XattrFilter selects the extended attributes which are saved, it may be
+	// nil.
+	XattrFilter *restic.XattrFilter
+
 	// Flags controlling change detection. See doc/040_backup.rst for details.
 	ChangeIgnoreFlags uint
+
+	// FilesCache is consulted before the parent snapshot to detect unchanged
+	// files, it may be nil.
+	FilesCache *FilesCache
 }
 
 // Flags for the ChangeIgnoreFlags bitfield.
@@ -198,6 +215,10 @@ func (arch *Archiver) nodeFromFileInfo(filename string, fi os.FileInfo) (*restic
 	if !arch.WithAtime {
 		node.AccessTime = node.ModTime
 	}
+	if arch.WithInodeFlags {
+		node.FillInodeFlags(filename, fi)
+	}
+	node = arch.XattrFilter.Apply(node)
 	return node, errors.Wrap(err, "NodeFromFileInfo")
 }
 
@@ -229,7 +250,7 @@ func (arch *Archiver) wrapLoadTreeError(id restic.ID, err error) error {
 
 // SaveDir stores a directory in the repo and returns the node. snPath is the
 // path within the current snapshot.
-func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo, dir string, previous *restic.Tree, complete CompleteFunc) (d FutureTree, err error) {
+func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo, dir string, previous *previousTree, complete CompleteFunc) (d FutureTree, err error) {
 	debug.Log("%v %v", snPath, dir)
 
 	treeNode, err := arch.nodeFromFileInfo(dir, fi)
@@ -243,6 +264,8 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo
 	}
 	sort.Strings(names)
 
+	arch.checkpoint.start(snPath, treeNode)
+
 	nodes := make([]FutureNode, 0, len(names))
 
 	for _, name := range names {
@@ -253,9 +276,8 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo
 		}
 
 		pathname := arch.FS.Join(dir, name)
-		oldNode := previous.Find(name)
 		snItem := join(snPath, name)
-		fn, excluded, err := arch.Save(ctx, snItem, pathname, oldNode)
+		fn, excluded, err := arch.Save(ctx, snItem, pathname, previous.Item(name))
 
 		// return error early if possible
 		if err != nil {
@@ -326,8 +348,14 @@ func (fn *FutureNode) wait(ctx context.Context) {
 // allBlobsPresent checks if all blobs (contents) of the given node are
 // present in the index.
 func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
+	return arch.allContentPresent(previous.Content)
+}
+
+// allContentPresent checks if all data blobs in content are present in the
+// index.
+func (arch *Archiver) allContentPresent(content restic.IDs) bool {
 	// check if all blobs are contained in index
-	for _, id := range previous.Content {
+	for _, id := range content {
 		if !arch.Repo.Index().Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
 			return false
 		}
@@ -341,8 +369,10 @@ func (arch *Archiver) allBlobsPresent(previous *restic.Node) bool {
 //
 // Errors and completion needs to be handled by the caller.
 //
-// snPath is the path within the current snapshot.
-func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous *restic.Node) (fn FutureNode, excluded bool, err error) {
+// snPath is the path within the current snapshot. The node of the item in the
+// parent snapshot is only looked up if the item is not found in the files
+// cache.
+func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous *previousItem) (fn FutureNode, excluded bool, err error) {
 	start := time.Now()
 
 	fn = FutureNode{
@@ -384,20 +414,45 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		debug.Log("  %v regular file", target)
 		start := time.Now()
 
+		// consult the files cache first, it does not require loading the
+		// trees of the parent snapshot
+		if entry := previous.cachedEntry(); entry != nil && !fileChanged(fi, entry.node(), arch.ChangeIgnoreFlags) && arch.allContentPresent(entry.Content) {
+			debug.Log("%v found in the files cache, using old list of blobs", target)
+			fn.node, err = arch.nodeFromFileInfo(target, fi)
+			if err != nil {
+				return FutureNode{}, false, err
+			}
+
+			fn.node.Content = entry.Content
+			arch.CompleteItem(snPath, fn.node, fn.node, ItemStats{}, time.Since(start))
+			arch.CompleteBlob(snPath, fn.node.Size)
+			arch.checkpoint.complete(snPath, fn.node)
+			previous.saved(fn.node)
+
+			return fn, false, nil
+		}
+
+		oldNode, err := previous.Node()
+		if err != nil {
+			return FutureNode{}, false, err
+		}
+
 		// check if the file has not changed before performing a fopen operation (more expensive, specially
 		// in network filesystems)
-		if previous != nil && !fileChanged(fi, previous, arch.ChangeIgnoreFlags) {
-			if arch.allBlobsPresent(previous) {
+		if oldNode != nil && !fileChanged(fi, oldNode, arch.ChangeIgnoreFlags) {
+			if arch.allBlobsPresent(oldNode) {
 				debug.Log("%v hasn't changed, using old list of blobs", target)
-				arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
-				arch.CompleteBlob(snPath, previous.Size)
+				arch.CompleteItem(snPath, oldNode, oldNode, ItemStats{}, time.Since(start))
+				arch.CompleteBlob(snPath, oldNode.Size)
 				fn.node, err = arch.nodeFromFileInfo(target, fi)
 				if err != nil {
 					return FutureNode{}, false, err
 				}
 
 				// copy list of blobs
-				fn.node.Content = previous.Content
+				fn.node.Content = oldNode.Content
+				arch.checkpoint.complete(snPath, fn.node)
+				previous.saved(fn.node)
 
 				return fn, false, nil
 			}
@@ -450,7 +505,9 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		fn.file = arch.fileSaver.Save(ctx, snPath, file, fi, func() {
 			arch.StartFile(snPath)
 		}, func(node *restic.Node, stats ItemStats) {
-			arch.CompleteItem(snPath, previous, node, stats, time.Since(start))
+			arch.checkpoint.complete(snPath, node)
+			previous.saved(node)
+			arch.CompleteItem(snPath, oldNode, node, stats, time.Since(start))
 		})
 
 	case fi.IsDir():
@@ -458,18 +515,21 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 
 		snItem := snPath + "/"
 		start := time.Now()
-		oldSubtree, err := arch.loadSubtree(ctx, previous)
-		if err != nil {
-			err = arch.error(abstarget, fi, err)
-		}
-		if err != nil {
-			return FutureNode{}, false, err
-		}
+		oldSubtree := arch.previousSubtree(ctx, abstarget, fi, previous)
 
 		fn.isTree = true
 		fn.tree, err = arch.SaveDir(ctx, snPath, fi, target, oldSubtree,
 			func(node *restic.Node, stats ItemStats) {
-				arch.CompleteItem(snItem, previous, node, stats, time.Since(start))
+				arch.checkpoint.complete(snPath, node)
+				oldSubtree.update.save(node)
+
+				// don't load the parent tree just for reporting if the
+				// directory is found in the files cache
+				oldNode := oldSubtree.cached.DirNode()
+				if oldNode == nil {
+					oldNode, _ = previous.Node()
+				}
+				arch.CompleteItem(snItem, oldNode, node, stats, time.Since(start))
 			})
 		if err != nil {
 			debug.Log("SaveDir for %v returned error: %v", snPath, err)
@@ -487,6 +547,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		if err != nil {
 			return FutureNode{}, false, err
 		}
+		arch.checkpoint.complete(snPath, fn.node)
 	}
 
 	debug.Log("return after %.3f", time.Since(start).Seconds())
@@ -513,11 +574,20 @@ func fileChanged(fi os.FileInfo, node *restic.Node, ignoreFlags uint) bool {
 	checkCtime := ignoreFlags&ChangeIgnoreCtime == 0
 	checkInode := ignoreFlags&ChangeIgnoreInode == 0
 
-	extFI := fs.ExtendedStat(fi)
+	var ctime time.Time
+	var inode uint64
+	if n, ok := fi.Sys().(*restic.Node); ok {
+		// the file system provides the node directly
+		ctime, inode = n.ChangeTime, n.Inode
+	} else {
+		extFI := fs.ExtendedStat(fi)
+		ctime, inode = extFI.ChangeTime, extFI.Inode
+	}
+
 	switch {
-	case checkCtime && !extFI.ChangeTime.Equal(node.ChangeTime):
+	case checkCtime && !ctime.Equal(node.ChangeTime):
 		return true
-	case checkInode && node.Inode != extFI.Inode:
+	case checkInode && node.Inode != inode:
 		return true
 	}
 
@@ -565,7 +635,7 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 
 		// this is a leaf node
 		if subatree.Leaf() {
-			fn, excluded, err := arch.Save(ctx, join(snPath, name), subatree.Path, previous.Find(name))
+			fn, excluded, err := arch.Save(ctx, join(snPath, name), subatree.Path, knownPrevious(previous.Find(name)))
 
 			if err != nil {
 				err = arch.error(subatree.Path, fn.fi, err)
@@ -635,6 +705,7 @@ func (arch *Archiver) SaveTree(ctx context.Context, snPath string, atree *Tree,
 			return nil, err
 		}
 
+		arch.checkpoint.complete(join(snPath, name), node)
 		arch.CompleteItem(snItem, oldNode, node, nodeStats, time.Since(start))
 	}
 
@@ -730,10 +801,15 @@ type SnapshotOptions struct {
 	Excludes       []string
 	Time           time.Time
 	ParentSnapshot restic.ID
+
+	// CheckpointInterval configures how often a checkpoint snapshot is saved
+	// while the backup is running. No checkpoints are saved if it is zero.
+	CheckpointInterval time.Duration
 }
 
-// loadParentTree loads a tree referenced by snapshot id. If id is null, nil is returned.
-func (arch *Archiver) loadParentTree(ctx context.Context, snapshotID restic.ID) *restic.Tree {
+// loadParentSnapshot loads the snapshot referenced by snapshotID. If id is
+// null or the snapshot cannot be loaded, nil is returned.
+func (arch *Archiver) loadParentSnapshot(ctx context.Context, snapshotID restic.ID) *restic.Snapshot {
 	if snapshotID.IsNull() {
 		return nil
 	}
@@ -744,9 +820,18 @@ func (arch *Archiver) loadParentTree(ctx context.Context, snapshotID restic.ID)
 		debug.Log("unable to load snapshot %v: %v", snapshotID, err)
 		return nil
 	}
+	return sn
+}
+
+// loadParentTree loads the tree referenced by the snapshot sn. If sn is nil,
+// nil is returned.
+func (arch *Archiver) loadParentTree(ctx context.Context, sn *restic.Snapshot) *restic.Tree {
+	if sn == nil {
+		return nil
+	}
 
 	if sn.Tree == nil {
-		debug.Log("snapshot %v has empty tree %v", snapshotID)
+		debug.Log("snapshot %v has empty tree", sn.ID())
 		return nil
 	}
 
@@ -774,7 +859,11 @@ func (arch *Archiver) runWorkers(ctx context.Context, t *tomb.Tomb) {
 	arch.treeSaver = NewTreeSaver(ctx, t, arch.Options.SaveTreeConcurrency, arch.saveTree, arch.Error)
 }
 
-// Snapshot saves several targets and returns a snapshot.
+// Snapshot saves several targets and returns a snapshot. If the parent
+// snapshot is a checkpoint, the parent of the checkpoint is used as the parent
+// of the new snapshot. A checkpoint parent for the same host and paths is
+// removed once the new snapshot has been saved, it was left behind by an
+// interrupted backup of the same data.
 func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts SnapshotOptions) (*restic.Snapshot, restic.ID, error) {
 	cleanTargets, err := resolveRelativeTargets(arch.FS, targets)
 	if err != nil {
@@ -786,17 +875,48 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
+	parent := arch.loadParentSnapshot(ctx, opts.ParentSnapshot)
+	parentID := opts.ParentSnapshot
+	var obsoleteCheckpoints restic.IDs
+	if parent != nil && parent.Checkpoint {
+		debug.Log("parent snapshot %v is a checkpoint", opts.ParentSnapshot)
+		parentID = restic.ID{}
+		if parent.Parent != nil {
+			parentID = *parent.Parent
+		}
+
+		sn, err := arch.newSnapshot(targets, opts, parentID)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+		if sameCheckpointSource(parent, sn) {
+			obsoleteCheckpoints = append(obsoleteCheckpoints, opts.ParentSnapshot)
+		}
+	}
+
+	arch.checkpoint = nil
+	if opts.CheckpointInterval > 0 {
+		arch.checkpoint = &checkpointTree{}
+	}
+
 	var t tomb.Tomb
 	wctx := t.Context(ctx)
 	start := time.Now()
 
 	var rootTreeID restic.ID
 	var stats ItemStats
+	var lastCheckpoint restic.ID
 	t.Go(func() error {
 		arch.runWorkers(wctx, &t)
 
+		if opts.CheckpointInterval > 0 {
+			t.Go(func() error {
+				return arch.runCheckpoints(ctx, wctx, targets, opts, parentID, &lastCheckpoint)
+			})
+		}
+
 		debug.Log("starting snapshot")
-		tree, err := arch.SaveTree(wctx, "/", atree, arch.loadParentTree(wctx, opts.ParentSnapshot))
+		tree, err := arch.SaveTree(wctx, "/", atree, arch.loadParentTree(wctx, parent))
 		if err != nil {
 			return err
 		}
@@ -826,16 +946,10 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
-	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
+	sn, err := arch.newSnapshot(targets, opts, parentID)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
-
-	sn.Excludes = opts.Excludes
-	if !opts.ParentSnapshot.IsNull() {
-		id := opts.ParentSnapshot
-		sn.Parent = &id
-	}
 	sn.Tree = &rootTreeID
 
 	id, err := arch.Repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
@@ -843,5 +957,154 @@ func (arch *Archiver) Snapshot(ctx context.Context, targets []string, opts Snaps
 		return nil, restic.ID{}, err
 	}
 
+	if !lastCheckpoint.IsNull() {
+		obsoleteCheckpoints = append(obsoleteCheckpoints, lastCheckpoint)
+	}
+	for _, checkpointID := range obsoleteCheckpoints {
+		// a checkpoint which is left behind is just an additional snapshot,
+		// thus don't fail the backup
+		err = arch.removeSnapshot(ctx, checkpointID)
+		if err != nil {
+			debug.Log("unable to remove checkpoint %v: %v", checkpointID, err)
+		}
+	}
+
 	return sn, id, nil
 }
+
+// newSnapshot returns a new snapshot for targets without a tree.
+func (arch *Archiver) newSnapshot(targets []string, opts SnapshotOptions, parentID restic.ID) (*restic.Snapshot, error) {
+	sn, err := restic.NewSnapshot(targets, opts.Tags, opts.Hostname, opts.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	sn.Excludes = opts.Excludes
+	if !parentID.IsNull() {
+		id := parentID
+		sn.Parent = &id
+	}
+	return sn, nil
+}
+
+// sameCheckpointSource returns true if the checkpoint was saved by a backup
+// of the same host and paths as sn.
+func sameCheckpointSource(checkpoint, sn *restic.Snapshot) bool {
+	if checkpoint.Hostname != sn.Hostname || len(checkpoint.Paths) != len(sn.Paths) {
+		return false
+	}
+
+	paths := make(map[string]struct{}, len(sn.Paths))
+	for _, p := range sn.Paths {
+		paths[p] = struct{}{}
+	}
+	for _, p := range checkpoint.Paths {
+		if _, ok := paths[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (arch *Archiver) removeSnapshot(ctx context.Context, id restic.ID) error {
+	h := restic.Handle{Type: restic.SnapshotFile, Name: id.String()}
+	return arch.Repo.Backend().Remove(ctx, h)
+}
+
+// runCheckpoints saves a checkpoint snapshot every opts.CheckpointInterval
+// until wctx is cancelled. Each checkpoint replaces the previous one, the ID
+// of the latest checkpoint is stored in last. The trees of a checkpoint are
+// saved right away, but the snapshot is only saved once all blobs referenced
+// by it are contained in pack files, which are stored when they are full.
+// The index and snapshot are saved using ctx, so that a checkpoint is either
+// saved completely or not at all when the backup finishes in the meantime.
+func (arch *Archiver) runCheckpoints(ctx, wctx context.Context, targets []string, opts SnapshotOptions, parentID restic.ID, last *restic.ID) error {
+	ticker := time.NewTicker(opts.CheckpointInterval)
+	defer ticker.Stop()
+
+	pollInterval := checkpointPollInterval
+	if opts.CheckpointInterval < pollInterval {
+		pollInterval = opts.CheckpointInterval
+	}
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	var pending *pendingCheckpoint
+	for {
+		select {
+		case <-wctx.Done():
+			return nil
+		case <-ticker.C:
+			if pending != nil {
+				// the previous checkpoint is still waiting for its packs
+				continue
+			}
+
+			treeID, err := arch.checkpoint.save(wctx, arch.saveTree)
+			if err != nil {
+				if wctx.Err() != nil {
+					// the backup has finished or was aborted
+					return nil
+				}
+				return errors.Wrap(err, "saving checkpoint failed")
+			}
+			if treeID.IsNull() {
+				continue
+			}
+			pending = newPendingCheckpoint(treeID, arch.Repo.Index())
+		case <-poll.C:
+		}
+
+		if pending == nil || !pending.ready(arch.Repo.Index()) {
+			continue
+		}
+
+		id, err := arch.saveCheckpoint(ctx, targets, opts, parentID, pending.tree)
+		pending = nil
+		if err != nil {
+			if wctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "saving checkpoint failed")
+		}
+		// an unchanged checkpoint results in the same snapshot ID
+		if id.Equal(*last) {
+			continue
+		}
+
+		if !last.IsNull() {
+			err = arch.removeSnapshot(ctx, *last)
+			if err != nil {
+				return errors.Wrap(err, "removing checkpoint failed")
+			}
+		}
+		*last = id
+	}
+}
+
+// saveCheckpoint saves the index and a checkpoint snapshot for the tree, the
+// snapshot is tagged with CheckpointTag. All blobs referenced by the tree
+// must be contained in pack files stored in the backend.
+func (arch *Archiver) saveCheckpoint(ctx context.Context, targets []string, opts SnapshotOptions, parentID restic.ID, treeID restic.ID) (restic.ID, error) {
+	// make sure all data referenced by the checkpoint is contained in the
+	// index, the partially filled packs are not written
+	err := arch.Repo.SaveIndex(ctx)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	sn, err := arch.newSnapshot(targets, opts, parentID)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	sn.Checkpoint = true
+	sn.AddTags([]string{CheckpointTag})
+	sn.Tree = &treeID
+
+	id, err := arch.Repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	debug.Log("saved checkpoint %v with tree %v", id, treeID)
+	return id, nil
+}
@@ -0,0 +1,186 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// CheckpointTag is added to the snapshots which are saved periodically while
+// a backup is running, so that they can be recognized in the list of
+// snapshots. Only snapshots with restic.Snapshot.Checkpoint set are treated
+// as checkpoints.
+const CheckpointTag = "checkpoint"
+
+// checkpointPollInterval is how often a saved checkpoint tree is checked
+// whether all blobs it references have been stored in pack files.
+const checkpointPollInterval = time.Second
+
+// pendingCheckpoint is a checkpoint whose trees have been saved, but which
+// may reference blobs that are not yet contained in a pack file stored in the
+// backend. Instead of flushing the partially filled packs, the snapshot is
+// only saved once these packs have been completed.
+type pendingCheckpoint struct {
+	tree restic.ID
+	wait restic.BlobSet
+}
+
+// newPendingCheckpoint returns a pendingCheckpoint for the tree. All blobs
+// referenced by the tree are either contained in the index or pending at this
+// point, as only completed items are recorded.
+func newPendingCheckpoint(tree restic.ID, idx restic.MasterIndex) *pendingCheckpoint {
+	return &pendingCheckpoint{
+		tree: tree,
+		wait: idx.Pending(),
+	}
+}
+
+// ready returns true once all blobs which were pending when the checkpoint
+// was created are contained in pack files stored in the backend.
+func (p *pendingCheckpoint) ready(idx restic.MasterIndex) bool {
+	for bh := range p.wait {
+		if len(idx.Lookup(bh)) == 0 {
+			return false
+		}
+		delete(p.wait, bh)
+	}
+	return true
+}
+
+// checkpointTree records the files and directories which have been saved
+// completely while a backup is running, so that a partial snapshot can be
+// created from them at any time. All methods can be called on a nil
+// checkpointTree, in which case nothing is recorded.
+type checkpointTree struct {
+	m    sync.Mutex
+	root checkpointNode
+}
+
+type checkpointNode struct {
+	// node is nil for intermediate directories for which no metadata is known.
+	node     *restic.Node
+	complete bool
+	children map[string]*checkpointNode
+}
+
+// find returns the entry for snPath, it is created if necessary. If the
+// entry is part of a directory which has already been completed, nil is
+// returned.
+func (c *checkpointTree) find(snPath string) *checkpointNode {
+	cur := &c.root
+	for _, name := range strings.Split(strings.Trim(snPath, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if cur.complete {
+			return nil
+		}
+
+		next, ok := cur.children[name]
+		if !ok {
+			if cur.children == nil {
+				cur.children = make(map[string]*checkpointNode)
+			}
+			next = &checkpointNode{}
+			cur.children[name] = next
+		}
+		cur = next
+	}
+	return cur
+}
+
+// start records the metadata of a directory which is currently being saved.
+func (c *checkpointTree) start(snPath string, node *restic.Node) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry := c.find(snPath)
+	if entry == nil || entry.complete {
+		return
+	}
+	n := *node
+	entry.node = &n
+}
+
+// complete records that the file or directory at snPath has been saved. For
+// directories, node must reference the saved subtree.
+func (c *checkpointTree) complete(snPath string, node *restic.Node) {
+	if c == nil || node == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry := c.find(snPath)
+	if entry == nil {
+		return
+	}
+	n := *node
+	entry.node = &n
+	entry.complete = true
+	// the subtree already contains everything below this directory
+	entry.children = nil
+}
+
+// save stores the trees for all directories which have not been completed
+// yet, these only contain the nodes which have been recorded so far. The ID
+// of the root tree is returned, it is null if nothing has been completed.
+func (c *checkpointTree) save(ctx context.Context, saveTree func(context.Context, *restic.Tree) (restic.ID, ItemStats, error)) (restic.ID, error) {
+	if c == nil {
+		return restic.ID{}, nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.saveDir(ctx, &c.root, saveTree)
+}
+
+func (c *checkpointTree) saveDir(ctx context.Context, dir *checkpointNode, saveTree func(context.Context, *restic.Tree) (restic.ID, ItemStats, error)) (restic.ID, error) {
+	tree := restic.NewTree()
+	for name, entry := range dir.children {
+		var node *restic.Node
+		if entry.complete {
+			n := *entry.node
+			node = &n
+		} else {
+			id, err := c.saveDir(ctx, entry, saveTree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			if id.IsNull() {
+				continue
+			}
+
+			if entry.node != nil {
+				n := *entry.node
+				node = &n
+			} else {
+				node = &restic.Node{Type: "dir", Mode: os.ModeDir | 0755}
+			}
+			node.Subtree = &id
+		}
+
+		node.Name = name
+		err := tree.Insert(node)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	if len(tree.Nodes) == 0 {
+		return restic.ID{}, nil
+	}
+
+	id, _, err := saveTree(ctx, tree)
+	return id, err
+}
@@ -0,0 +1,250 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+func TestCheckpointTree(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	saveTree := func(ctx context.Context, tree *restic.Tree) (restic.ID, ItemStats, error) {
+		id, err := repo.SaveTree(ctx, tree)
+		return id, ItemStats{}, err
+	}
+
+	// nothing has been completed yet
+	var c checkpointTree
+	id, err := c.save(ctx, saveTree)
+	restictest.OK(t, err)
+	restictest.Assert(t, id.IsNull(), "expected null id for empty checkpoint, got %v", id)
+
+	subtreeID := restic.NewRandomID()
+	c.start("/home", &restic.Node{Name: "home", Type: "dir", Mode: os.ModeDir | 0700})
+	c.complete("/home/file", &restic.Node{Name: "file", Type: "file"})
+	c.complete("/home/done/x", &restic.Node{Name: "x", Type: "file"})
+	c.complete("/home/done", &restic.Node{Name: "done", Type: "dir", Subtree: &subtreeID})
+	// items within completed directories are ignored
+	c.complete("/home/done/y", &restic.Node{Name: "y", Type: "file"})
+	c.start("/home/empty", &restic.Node{Name: "empty", Type: "dir"})
+	c.complete("/other/link", &restic.Node{Name: "link", Type: "symlink"})
+
+	id, err = c.save(ctx, saveTree)
+	restictest.OK(t, err)
+	restictest.OK(t, repo.Flush(ctx))
+
+	root, err := repo.LoadTree(ctx, id)
+	restictest.OK(t, err)
+	restictest.Equals(t, 2, len(root.Nodes))
+
+	home := root.Find("home")
+	restictest.Assert(t, home != nil && home.Subtree != nil, "home directory missing in checkpoint")
+	restictest.Equals(t, os.ModeDir|0700, home.Mode)
+
+	homeTree, err := repo.LoadTree(ctx, *home.Subtree)
+	restictest.OK(t, err)
+	restictest.Equals(t, 2, len(homeTree.Nodes))
+	restictest.Assert(t, homeTree.Find("file") != nil, "file missing in checkpoint")
+	done := homeTree.Find("done")
+	restictest.Assert(t, done != nil && done.Subtree != nil && done.Subtree.Equal(subtreeID),
+		"completed directory has wrong subtree %v", done)
+
+	other := root.Find("other")
+	restictest.Assert(t, other != nil && other.Type == "dir", "intermediate directory other missing in checkpoint")
+}
+
+func TestArchiverCheckpointParent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"dir": TestDir{
+			"file1": TestFile{Content: "foobar"},
+			"sub": TestDir{
+				"file2": TestFile{Content: "baz"},
+			},
+		},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	_, parentID, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+	restictest.OK(t, err)
+
+	// save a checkpoint, which references the same data as the parent
+	parent, err := restic.LoadSnapshot(ctx, repo, parentID)
+	restictest.OK(t, err)
+	checkpoint := *parent
+	checkpoint.Parent = &parentID
+	checkpoint.Tags = restic.TagList{CheckpointTag}
+	checkpoint.Checkpoint = true
+	checkpointID, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, &checkpoint)
+	restictest.OK(t, err)
+
+	testFS := &MockFS{
+		FS:        fs.Track{FS: fs.Local{}},
+		bytesRead: make(map[string]int),
+	}
+	arch = New(repo, testFS, Options{})
+	sn, _, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: checkpointID})
+	restictest.OK(t, err)
+
+	// the files are unchanged, nothing must be read again
+	restictest.Equals(t, 0, len(testFS.bytesRead))
+
+	// the checkpoint is replaced by the new snapshot
+	restictest.Assert(t, sn.Parent != nil && sn.Parent.Equal(parentID), "wrong parent %v, want %v", sn.Parent, parentID)
+	_, err = restic.LoadSnapshot(ctx, repo, checkpointID)
+	restictest.Assert(t, err != nil, "checkpoint %v was not removed", checkpointID.Str())
+
+	checker.TestCheckRepo(t, repo)
+}
+
+func TestArchiverCheckpointParentKept(t *testing.T) {
+	var tests = []struct {
+		name   string
+		modify func(sn *restic.Snapshot)
+	}{
+		{
+			// a snapshot the user tagged with "checkpoint" is not a checkpoint
+			name: "tag",
+			modify: func(sn *restic.Snapshot) {
+				sn.Tags = restic.TagList{CheckpointTag}
+			},
+		},
+		{
+			name: "other-host",
+			modify: func(sn *restic.Snapshot) {
+				sn.Checkpoint = true
+				sn.Hostname = "other"
+			},
+		},
+		{
+			name: "other-paths",
+			modify: func(sn *restic.Snapshot) {
+				sn.Checkpoint = true
+				sn.Paths = append(sn.Paths, "/other")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tempdir, repo, cleanup := prepareTempdirRepoSrc(t, TestDir{"file": TestFile{Content: "foobar"}})
+			defer cleanup()
+
+			back := restictest.Chdir(t, tempdir)
+			defer back()
+
+			arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+			_, parentID, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now()})
+			restictest.OK(t, err)
+
+			parent, err := restic.LoadSnapshot(ctx, repo, parentID)
+			restictest.OK(t, err)
+			sn := *parent
+			sn.Parent = &parentID
+			test.modify(&sn)
+			snID, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, &sn)
+			restictest.OK(t, err)
+
+			_, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: snID})
+			restictest.OK(t, err)
+
+			_, err = restic.LoadSnapshot(ctx, repo, snID)
+			restictest.OK(t, err)
+		})
+	}
+}
+
+func TestPendingCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tree := restic.NewTree()
+	restictest.OK(t, tree.Insert(&restic.Node{Name: "foo", Type: "file"}))
+	id, err := repo.SaveTree(ctx, tree)
+	restictest.OK(t, err)
+
+	// the tree is only contained in a partially filled pack
+	p := newPendingCheckpoint(id, repo.Index())
+	restictest.Assert(t, !p.ready(repo.Index()), "checkpoint is ready before the pack was stored")
+
+	restictest.OK(t, repo.Flush(ctx))
+	restictest.Assert(t, p.ready(repo.Index()), "checkpoint is not ready after the pack was stored")
+}
+
+// SlowFS delays opening files.
+type SlowFS struct {
+	fs.FS
+	Delay time.Duration
+}
+
+func (m *SlowFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	time.Sleep(m.Delay)
+	return m.FS.OpenFile(name, flag, perm)
+}
+
+func TestArchiverCheckpoints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{}
+	for _, dir := range []string{"a", "b", "c"} {
+		sub := TestDir{}
+		for _, file := range []string{"1", "2", "3", "4"} {
+			sub[file] = TestFile{Content: dir + file}
+		}
+		src[dir] = sub
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	testFS := &SlowFS{FS: fs.Track{FS: fs.Local{}}, Delay: 10 * time.Millisecond}
+	arch := New(repo, testFS, Options{FileReadConcurrency: 1})
+	sopts := SnapshotOptions{
+		Time:               time.Now(),
+		CheckpointInterval: 5 * time.Millisecond,
+	}
+	_, id, err := arch.Snapshot(ctx, []string{"."}, sopts)
+	restictest.OK(t, err)
+
+	// all checkpoints must have been replaced by the final snapshot
+	var snapshots restic.IDs
+	restictest.OK(t, repo.List(ctx, restic.SnapshotFile, func(id restic.ID, size int64) error {
+		snapshots = append(snapshots, id)
+		return nil
+	}))
+	restictest.Equals(t, restic.IDs{id}, snapshots)
+
+	// the trees of the checkpoints are only removed by prune, thus don't
+	// check the repository for unused blobs
+	TestEnsureSnapshot(t, repo, id, src)
+}
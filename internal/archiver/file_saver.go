@@ -58,6 +58,11 @@ type FileSaver struct {
 
 	pol chunker.Pol
 
+	// files of at least twice splitSize bytes are split into ranges, which
+	// are chunked by up to splitWorkers goroutines concurrently
+	splitSize    int64
+	splitWorkers uint
+
 	ch chan<- saveFileJob
 
 	CompleteBlob func(filename string, bytes uint64)
@@ -78,6 +83,8 @@ func NewFileSaver(ctx context.Context, t *tomb.Tomb, save SaveBlobFn, pol chunke
 		saveBlob:     save,
 		saveFilePool: NewBufferPool(ctx, int(poolSize), chunker.MaxSize),
 		pol:          pol,
+		splitSize:    defaultSplitSize,
+		splitWorkers: blobWorkers,
 		ch:           ch,
 
 		CompleteBlob: func(string, uint64) {},
@@ -155,12 +162,51 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		return saveFileResponse{err: errors.Errorf("node type %q is wrong", node.Type)}
 	}
 
-	// reuse the chunker
-	chnker.Reset(f, s.pol)
+	// holes in sparse files are not read
+	rd := fs.NewSparseReader(f, fi)
 
 	var results []FutureBlob
+	var size uint64
+	if ra, ok := rd.(io.ReaderAt); ok && s.splitSize > 0 && fi.Size() >= 2*s.splitSize {
+		results, size, err = s.saveSplit(ctx, chnker, f.Name(), ra, fi.Size())
+	} else {
+		results, size, err = s.saveSequential(ctx, chnker, f.Name(), rd)
+	}
+	if err != nil {
+		_ = f.Close()
+		return saveFileResponse{err: err}
+	}
+
+	err = f.Close()
+	if err != nil {
+		return saveFileResponse{err: err}
+	}
 
 	node.Content = []restic.ID{}
+	for _, res := range results {
+		res.Wait(ctx)
+		if !res.Known() {
+			stats.DataBlobs++
+			stats.DataSize += uint64(res.Length())
+		}
+
+		node.Content = append(node.Content, res.ID())
+	}
+
+	node.Size = size
+
+	return saveFileResponse{
+		node:  node,
+		stats: stats,
+	}
+}
+
+// saveSequential chunks the data from rd and saves the blobs.
+func (s *FileSaver) saveSequential(ctx context.Context, chnker *chunker.Chunker, filename string, rd io.Reader) ([]FutureBlob, uint64, error) {
+	// reuse the chunker
+	chnker.Reset(rd, s.pol)
+
+	var results []FutureBlob
 	var size uint64
 	for {
 		buf := s.saveFilePool.Get()
@@ -175,14 +221,12 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		size += uint64(chunk.Length)
 
 		if err != nil {
-			_ = f.Close()
-			return saveFileResponse{err: err}
+			return nil, 0, err
 		}
 
 		// test if the context has been cancelled, return the error
 		if ctx.Err() != nil {
-			_ = f.Close()
-			return saveFileResponse{err: ctx.Err()}
+			return nil, 0, ctx.Err()
 		}
 
 		res := s.saveBlob(ctx, restic.DataBlob, buf)
@@ -190,34 +234,13 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 
 		// test if the context has been cancelled, return the error
 		if ctx.Err() != nil {
-			_ = f.Close()
-			return saveFileResponse{err: ctx.Err()}
+			return nil, 0, ctx.Err()
 		}
 
-		s.CompleteBlob(f.Name(), uint64(len(chunk.Data)))
-	}
-
-	err = f.Close()
-	if err != nil {
-		return saveFileResponse{err: err}
+		s.CompleteBlob(filename, uint64(len(chunk.Data)))
 	}
 
-	for _, res := range results {
-		res.Wait(ctx)
-		if !res.Known() {
-			stats.DataBlobs++
-			stats.DataSize += uint64(res.Length())
-		}
-
-		node.Content = append(node.Content, res.ID())
-	}
-
-	node.Size = size
-
-	return saveFileResponse{
-		node:  node,
-		stats: stats,
-	}
+	return results, size, nil
 }
 
 func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
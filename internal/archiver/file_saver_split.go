@@ -0,0 +1,247 @@
+package archiver
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// defaultSplitSize is the size of the ranges in which large files are chunked
+// concurrently. Files smaller than twice this size are chunked sequentially.
+const defaultSplitSize = 8 * chunker.MaxSize
+
+// splitHeadChunks is the number of chunks at the start of a range (except the
+// first one) which are not saved by the worker chunking the range. The
+// boundaries of these chunks usually differ from those found when the file is
+// chunked sequentially, after a few chunks both are in sync.
+const splitHeadChunks = 4
+
+// splitRange is a part of a large file, which is chunked independently of the
+// preceding parts.
+type splitRange struct {
+	start, end int64
+	done       chan struct{}
+
+	// cuts contains the start of the range, followed by the end of each chunk
+	// found from there on, up to the first one which ends at or after end.
+	cuts []int64
+	// blobs contains the saved blob for each chunk. The first
+	// splitHeadChunks chunks of all ranges but the first one are not saved,
+	// their entries are left empty.
+	blobs []FutureBlob
+	// eof is set when the end of the file has been reached.
+	eof bool
+	err error
+}
+
+// wait blocks until the range has been chunked.
+func (r *splitRange) wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cut returns the index of pos in r.cuts, or -1 if no chunk starts at pos.
+func (r *splitRange) cut(pos int64) int {
+	i := sort.Search(len(r.cuts), func(i int) bool { return r.cuts[i] >= pos })
+	if i < len(r.cuts) && r.cuts[i] == pos {
+		return i
+	}
+	return -1
+}
+
+// saveSplit stores the contents of a large file, which is split into ranges of
+// s.splitSize bytes that are chunked concurrently. A chunk boundary only
+// depends on the bytes since the previous boundary, so as soon as a range
+// reaches a boundary found by the sequential chunker both yield the same
+// chunks. The ranges are stitched together at such boundaries, gaps are
+// chunked sequentially, so that the result is exactly the same as for
+// chunking the whole file at once.
+func (s *FileSaver) saveSplit(ctx context.Context, chnker *chunker.Chunker, filename string, rd io.ReaderAt, size int64) ([]FutureBlob, uint64, error) {
+	// the workers must have finished before returning, as the caller closes
+	// the file afterwards
+	var wg sync.WaitGroup
+	wctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	ranges := make([]*splitRange, (size+s.splitSize-1)/s.splitSize)
+	for i := range ranges {
+		ranges[i] = &splitRange{
+			start: int64(i) * s.splitSize,
+			end:   int64(i+1) * s.splitSize,
+			done:  make(chan struct{}),
+		}
+	}
+	// the file may have grown in the meantime, the last range is chunked to
+	// the end
+	ranges[len(ranges)-1].end = math.MaxInt64
+
+	debug.Log("chunking %v in %d ranges", filename, len(ranges))
+
+	ch := make(chan *splitRange)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ch)
+		for _, r := range ranges {
+			select {
+			case ch <- r:
+			case <-wctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := s.splitWorkers
+	if workers > uint(len(ranges)) {
+		workers = uint(len(ranges))
+	}
+	for i := uint(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chnker := chunker.New(nil, s.pol)
+			for r := range ch {
+				s.chunkRange(wctx, chnker, rd, r)
+				close(r.done)
+			}
+		}()
+	}
+
+	var results []FutureBlob
+	cur, idx := 0, 0
+	for {
+		r := ranges[cur]
+		err := r.wait(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// from idx on, the chunks of r are the same as the sequential ones
+		for ; idx < len(r.blobs); idx++ {
+			res := r.blobs[idx]
+			if res.ch == nil {
+				res, err = s.saveChunk(ctx, rd, r.cuts[idx], r.cuts[idx+1])
+				if err != nil {
+					return nil, 0, err
+				}
+			}
+			results = append(results, res)
+			s.CompleteBlob(filename, uint64(r.cuts[idx+1]-r.cuts[idx]))
+		}
+
+		pos := r.cuts[len(r.cuts)-1]
+		if r.eof || cur == len(ranges)-1 {
+			return results, uint64(pos), nil
+		}
+
+		// the last chunk of r ends in one of the following ranges, continue
+		// chunking from there until a boundary of that range is reached
+		chnker.Reset(io.NewSectionReader(rd, pos, math.MaxInt64-pos), s.pol)
+		for {
+			next := int(pos / s.splitSize)
+			if next >= len(ranges) {
+				next = len(ranges) - 1
+			}
+
+			err = ranges[next].wait(ctx)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			if i := ranges[next].cut(pos); i >= 0 {
+				cur, idx = next, i
+				break
+			}
+
+			buf := s.saveFilePool.Get()
+			chunk, err := chnker.Next(buf.Data)
+			if errors.Cause(err) == io.EOF {
+				buf.Release()
+				return results, uint64(pos), nil
+			}
+			if err != nil {
+				buf.Release()
+				return nil, 0, err
+			}
+
+			buf.Data = chunk.Data
+			pos += int64(chunk.Length)
+			results = append(results, s.saveBlob(ctx, restic.DataBlob, buf))
+			s.CompleteBlob(filename, uint64(len(chunk.Data)))
+		}
+	}
+}
+
+// chunkRange chunks the range r of rd, starting at r.start as if a chunk
+// ended there. Progress is reported once the chunks are used for the file.
+func (s *FileSaver) chunkRange(ctx context.Context, chnker *chunker.Chunker, rd io.ReaderAt, r *splitRange) {
+	chnker.Reset(io.NewSectionReader(rd, r.start, math.MaxInt64-r.start), s.pol)
+
+	pos := r.start
+	r.cuts = append(r.cuts, pos)
+	for pos < r.end {
+		buf := s.saveFilePool.Get()
+		chunk, err := chnker.Next(buf.Data)
+		if errors.Cause(err) == io.EOF {
+			buf.Release()
+			r.eof = true
+			return
+		}
+		if err != nil {
+			buf.Release()
+			r.err = err
+			return
+		}
+
+		// test if the context has been cancelled, return the error
+		if ctx.Err() != nil {
+			buf.Release()
+			r.err = ctx.Err()
+			return
+		}
+
+		pos += int64(chunk.Length)
+		r.cuts = append(r.cuts, pos)
+
+		if r.start > 0 && len(r.blobs) < splitHeadChunks {
+			buf.Release()
+			r.blobs = append(r.blobs, FutureBlob{})
+			continue
+		}
+
+		buf.Data = chunk.Data
+		r.blobs = append(r.blobs, s.saveBlob(ctx, restic.DataBlob, buf))
+	}
+}
+
+// saveChunk reads the bytes from start to end from rd and saves them as a
+// blob.
+func (s *FileSaver) saveChunk(ctx context.Context, rd io.ReaderAt, start, end int64) (FutureBlob, error) {
+	buf := s.saveFilePool.Get()
+	if int64(cap(buf.Data)) < end-start {
+		buf.Data = make([]byte, end-start)
+	}
+	buf.Data = buf.Data[:end-start]
+
+	_, err := io.ReadFull(io.NewSectionReader(rd, start, end-start), buf.Data)
+	if err != nil {
+		buf.Release()
+		return FutureBlob{}, errors.Wrap(err, "ReadAt")
+	}
+
+	return s.saveBlob(ctx, restic.DataBlob, buf), nil
+}
@@ -1,14 +1,20 @@
 package archiver
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
@@ -95,3 +101,177 @@ func TestFileSaver(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFileSaverSplit(t *testing.T) {
+	// random data with a run of zeros in the middle, which is cut at
+	// MaxSize, so that ranges starting in it are not in sync immediately
+	data := test.Random(23, 40*1024*1024)
+	for i := 14 * 1024 * 1024; i < 31*1024*1024+123; i++ {
+		data[i] = 0
+	}
+
+	tempdir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	// the run of zeros is not written, so that the file is sparse on file
+	// systems which support it and is read via the sparse reader
+	filename := filepath.Join(tempdir, "file")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]int{{0, 14 * 1024 * 1024}, {31*1024*1024 + 123, len(data)}} {
+		_, err = f.WriteAt(data[r[0]:r[1]], int64(r[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pol, err := chunker.RandomPolynomial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want restic.IDs
+	chnker := chunker.New(bytes.NewReader(data), pol)
+	buf := make([]byte, chunker.MaxSize)
+	for {
+		chunk, err := chnker.Next(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, restic.Hash(chunk.Data))
+	}
+
+	saveBlob := func(ctx context.Context, tpe restic.BlobType, buf *Buffer) FutureBlob {
+		ch := make(chan saveBlobResponse, 1)
+		ch <- saveBlobResponse{id: restic.Hash(buf.Data)}
+		close(ch)
+		length := len(buf.Data)
+		buf.Release()
+		return FutureBlob{ch: ch, length: length}
+	}
+
+	for _, splitSize := range []int64{1024 * 1024, 3*1024*1024 + 17, 16 * 1024 * 1024} {
+		t.Run(fmt.Sprintf("%d", splitSize), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tmb, ctx := tomb.WithContext(ctx)
+			s := NewFileSaver(ctx, tmb, saveBlob, pol, 1, 4)
+			s.NodeFromFileInfo = restic.NodeFromFileInfo
+			s.splitSize = splitSize
+
+			var m sync.Mutex
+			var completed uint64
+			s.CompleteBlob = func(_ string, bytes uint64) {
+				m.Lock()
+				completed += bytes
+				m.Unlock()
+			}
+
+			f, err := fs.Local{}.Open(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ff := s.Save(ctx, filename, f, fi, func() {}, nil)
+			ff.Wait(ctx)
+			if ff.Err() != nil {
+				t.Fatal(ff.Err())
+			}
+
+			test.Equals(t, uint64(len(data)), ff.Node().Size)
+			test.Equals(t, uint64(len(data)), completed)
+			test.Equals(t, want, ff.Node().Content)
+
+			tmb.Kill(nil)
+			err = tmb.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// slowReaderAt reads from data and fails for the range [failStart, failEnd).
+// It counts the reads which happen after closed has been set.
+type slowReaderAt struct {
+	data               []byte
+	failStart, failEnd int64
+
+	m         sync.Mutex
+	closed    bool
+	lateReads int
+}
+
+func (r *slowReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.m.Lock()
+	if r.closed {
+		r.lateReads++
+	}
+	r.m.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+	if off < r.failEnd && off+int64(len(p)) > r.failStart {
+		return 0, errors.New("read error")
+	}
+	return bytes.NewReader(r.data).ReadAt(p, off)
+}
+
+func TestFileSaverSplitError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	saveBlob := func(ctx context.Context, tpe restic.BlobType, buf *Buffer) FutureBlob {
+		ch := make(chan saveBlobResponse)
+		close(ch)
+		buf.Release()
+		return FutureBlob{ch: ch}
+	}
+
+	pol, err := chunker.RandomPolynomial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmb, ctx := tomb.WithContext(ctx)
+	s := NewFileSaver(ctx, tmb, saveBlob, pol, 1, 4)
+	s.splitSize = 1024 * 1024
+
+	data := test.Random(23, 16*1024*1024)
+	rd := &slowReaderAt{data: data, failStart: 1024 * 1024, failEnd: 2 * 1024 * 1024}
+
+	_, _, err = s.saveSplit(ctx, chunker.New(nil, pol), "file", rd, int64(len(data)))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the file is closed by the caller now, it must not be read anymore
+	rd.m.Lock()
+	rd.closed = true
+	rd.m.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	rd.m.Lock()
+	test.Equals(t, 0, rd.lateReads)
+	rd.m.Unlock()
+
+	tmb.Kill(nil)
+	err = tmb.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,334 @@
+package archiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// FilesCache is a local cache which records the contents of the files saved
+// by the archiver, so that unchanged files can be detected without loading
+// the trees of the parent snapshot from the repository.
+//
+// For each directory, a record is stored in a file named after the hash of
+// the absolute path of the directory. It contains the node of the directory
+// and the inode, change time, modification time, size and the list of
+// content blobs of each regular file in it, as saved by the last backup. The
+// records are encrypted with the repository key, as the blob IDs are hashes of
+// the file contents. A record is only written when it has changed or when it
+// is older than half the TTL, records which have not been written for longer
+// than the TTL are removed by Expire.
+type FilesCache struct {
+	dir string
+	key *crypto.Key
+	ttl time.Duration
+}
+
+// DefaultFilesCacheTTL is the default duration after which records of
+// directories which have not been saved again are removed from the files
+// cache.
+const DefaultFilesCacheTTL = 30 * 24 * time.Hour
+
+// NewFilesCache returns a files cache which stores the records in dir, it is
+// created if it does not exist yet. The records are encrypted with key. If ttl
+// is zero, DefaultFilesCacheTTL is used.
+func NewFilesCache(dir string, key *crypto.Key, ttl time.Duration) (*FilesCache, error) {
+	if ttl == 0 {
+		ttl = DefaultFilesCacheTTL
+	}
+
+	err := fs.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &FilesCache{dir: dir, key: key, ttl: ttl}, nil
+}
+
+// filesCacheDir is the record for a directory in the files cache.
+type filesCacheDir struct {
+	Node  *restic.Node      `json:"node"`
+	Files []filesCacheEntry `json:"files"`
+
+	files map[string]*filesCacheEntry
+	// raw is the serialized record and modTime the time it was written
+	raw     []byte
+	modTime time.Time
+}
+
+// filesCacheEntry is the entry for a regular file.
+type filesCacheEntry struct {
+	Name       string     `json:"name"`
+	Inode      uint64     `json:"inode"`
+	ChangeTime time.Time  `json:"ctime"`
+	ModTime    time.Time  `json:"mtime"`
+	Size       uint64     `json:"size"`
+	Content    restic.IDs `json:"content"`
+}
+
+// Find returns the entry for the file name, or nil if there is none.
+func (d *filesCacheDir) Find(name string) *filesCacheEntry {
+	if d == nil {
+		return nil
+	}
+	return d.files[name]
+}
+
+// DirNode returns the node of the directory as saved by the last backup, or
+// nil if there is no record.
+func (d *filesCacheDir) DirNode() *restic.Node {
+	if d == nil {
+		return nil
+	}
+	return d.Node
+}
+
+// node returns a node with the attributes recorded for the file, which can be
+// compared using fileChanged.
+func (e *filesCacheEntry) node() *restic.Node {
+	return &restic.Node{
+		Name:       e.Name,
+		Type:       "file",
+		Inode:      e.Inode,
+		ChangeTime: e.ChangeTime,
+		ModTime:    e.ModTime,
+		Size:       e.Size,
+		Content:    e.Content,
+	}
+}
+
+// filename returns the name of the file containing the record for the
+// directory path.
+func (fc *FilesCache) filename(path string) string {
+	id := restic.Hash([]byte(path)).String()
+	return filepath.Join(fc.dir, id[:2], id)
+}
+
+// load returns the record for the directory path. If the files cache is not
+// used or there is no record, nil is returned.
+func (fc *FilesCache) load(path string) *filesCacheDir {
+	if fc == nil {
+		return nil
+	}
+
+	f, err := os.Open(fc.filename(path))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			debug.Log("unable to read files cache record for %v: %v", path, err)
+		}
+		return nil
+	}
+
+	fi, err := f.Stat()
+	var buf []byte
+	if err == nil {
+		buf, err = ioutil.ReadAll(f)
+	}
+	_ = f.Close()
+	if err != nil {
+		debug.Log("unable to read files cache record for %v: %v", path, err)
+		return nil
+	}
+
+	if len(buf) < fc.key.NonceSize() {
+		debug.Log("invalid files cache record for %v: too short", path)
+		return nil
+	}
+	nonce, ciphertext := buf[:fc.key.NonceSize()], buf[fc.key.NonceSize():]
+	plaintext, err := fc.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		debug.Log("unable to decrypt files cache record for %v: %v", path, err)
+		return nil
+	}
+
+	d := &filesCacheDir{}
+	err = json.Unmarshal(plaintext, d)
+	if err != nil {
+		debug.Log("invalid files cache record for %v: %v", path, err)
+		return nil
+	}
+
+	d.raw = plaintext
+	d.modTime = fi.ModTime()
+	d.files = make(map[string]*filesCacheEntry, len(d.Files))
+	for i := range d.Files {
+		d.files[d.Files[i].Name] = &d.Files[i]
+	}
+
+	return d
+}
+
+// save replaces the record for the directory path with the serialized record
+// in plaintext.
+func (fc *FilesCache) save(path string, plaintext []byte) error {
+	nonce := crypto.NewRandomNonce()
+	buf := fc.key.Seal(nonce, nonce, plaintext, nil)
+
+	filename := fc.filename(path)
+	err := fs.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// write to a temporary file first, so that an interrupted backup does
+	// not leave a truncated record behind
+	f, err := ioutil.TempFile(filepath.Dir(filename), "tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = f.Write(buf)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// update returns a new record for the directory path, which is saved once
+// all files in it have been added. old is the current record, which is only
+// replaced if it differs from the new one. If the files cache is not used, nil
+// is returned.
+func (fc *FilesCache) update(path string, old *filesCacheDir) *filesCacheUpdate {
+	if fc == nil {
+		return nil
+	}
+	return &filesCacheUpdate{fc: fc, path: path, old: old}
+}
+
+// filesCacheExpireBatch is the number of subdirectories of the files cache
+// which are checked for expired records by each call to Expire.
+const filesCacheExpireBatch = 16
+
+// Expire removes the records which have not been written for longer than the
+// TTL. Each call only checks filesCacheExpireBatch of the 256 subdirectories
+// and continues where the previous call stopped, so that not all records are
+// read on every backup. Expired records are therefore removed after at most
+// 256/filesCacheExpireBatch calls.
+func (fc *FilesCache) Expire() error {
+	stateFile := filepath.Join(fc.dir, "expire")
+	next := 0
+	buf, err := ioutil.ReadFile(stateFile)
+	if err == nil {
+		next, err = strconv.Atoi(strings.TrimSpace(string(buf)))
+		if err != nil || next < 0 || next > 255 {
+			next = 0
+		}
+	}
+
+	oldest := time.Now().Add(-fc.ttl)
+	removed := 0
+	for i := 0; i < filesCacheExpireBatch; i++ {
+		subdir := filepath.Join(fc.dir, fmt.Sprintf("%02x", (next+i)%256))
+		records, err := ioutil.ReadDir(subdir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, fi := range records {
+			if !fi.ModTime().Before(oldest) {
+				continue
+			}
+
+			err = fs.Remove(filepath.Join(subdir, fi.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.WithStack(err)
+			}
+			removed++
+		}
+	}
+
+	debug.Log("removed %d expired records from the files cache", removed)
+
+	next = (next + filesCacheExpireBatch) % 256
+	err = ioutil.WriteFile(stateFile, []byte(strconv.Itoa(next)), 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// filesCacheUpdate collects the entries for a directory while it is saved.
+type filesCacheUpdate struct {
+	fc   *FilesCache
+	path string
+	old  *filesCacheDir
+
+	m     sync.Mutex
+	files []filesCacheEntry
+}
+
+// add records the file described by node, other types are ignored.
+func (u *filesCacheUpdate) add(node *restic.Node) {
+	if u == nil || node == nil || node.Type != "file" {
+		return
+	}
+
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	u.files = append(u.files, filesCacheEntry{
+		Name:       node.Name,
+		Inode:      node.Inode,
+		ChangeTime: node.ChangeTime,
+		ModTime:    node.ModTime,
+		Size:       node.Size,
+		Content:    node.Content,
+	})
+}
+
+// save replaces the record for the directory with the node and the files
+// added so far. An unchanged record is only written again when it is older
+// than half the TTL, so that it does not expire. The files cache is only an
+// optimization, so errors are not returned.
+func (u *filesCacheUpdate) save(node *restic.Node) {
+	if u == nil || node == nil {
+		return
+	}
+
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	sort.Slice(u.files, func(i, j int) bool {
+		return u.files[i].Name < u.files[j].Name
+	})
+
+	plaintext, err := json.Marshal(&filesCacheDir{Node: node, Files: u.files})
+	if err != nil {
+		debug.Log("unable to serialize files cache record for %v: %v", u.path, err)
+		return
+	}
+
+	if u.old != nil && bytes.Equal(u.old.raw, plaintext) && time.Since(u.old.modTime) < u.fc.ttl/2 {
+		return
+	}
+
+	err = u.fc.save(u.path, plaintext)
+	if err != nil {
+		debug.Log("unable to save files cache record for %v: %v", u.path, err)
+	}
+}
@@ -0,0 +1,213 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+// treeLoadCountingRepo counts the trees loaded from the repository.
+type treeLoadCountingRepo struct {
+	restic.Repository
+
+	m      sync.Mutex
+	loaded int
+}
+
+func (repo *treeLoadCountingRepo) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	repo.m.Lock()
+	repo.loaded++
+	repo.m.Unlock()
+	return repo.Repository.LoadTree(ctx, id)
+}
+
+func TestArchiverFilesCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"dir": TestDir{
+			"subdir": TestDir{
+				"file1": TestFile{Content: "content of file1"},
+				"file2": TestFile{Content: string(restictest.Random(23, 3*1024*1024+2343))},
+			},
+			"file3": TestFile{Content: "content of file3"},
+		},
+	}
+
+	tempdir, testRepo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	cachedir, removeCachedir := restictest.TempDir(t)
+	defer removeCachedir()
+
+	fc, err := NewFilesCache(filepath.Join(cachedir, "files"), testRepo.Key(), 0)
+	restictest.OK(t, err)
+
+	repo := &treeLoadCountingRepo{Repository: testRepo}
+	testFS := &MockFS{
+		FS:        fs.Track{FS: fs.Local{}},
+		bytesRead: make(map[string]int),
+	}
+
+	back := restictest.Chdir(t, tempdir)
+	defer back()
+
+	snapshot := func(parent restic.ID) restic.ID {
+		arch := New(repo, testFS, Options{})
+		arch.FilesCache = fc
+		_, id, err := arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: parent})
+		restictest.OK(t, err)
+		TestEnsureSnapshot(t, testRepo, id, src)
+		return id
+	}
+
+	first := snapshot(restic.ID{})
+	restictest.Equals(t, len("content of file1"), testFS.bytesRead[filepath.FromSlash("dir/subdir/file1")])
+
+	// all files are found in the files cache, only the root tree of the
+	// parent snapshot is loaded
+	records := filesCacheRecords(t, cachedir)
+	recent := time.Now().Add(-time.Minute).Truncate(time.Second)
+	for _, record := range records {
+		restictest.OK(t, os.Chtimes(record, recent, recent))
+	}
+	repo.loaded = 0
+	second := snapshot(first)
+	restictest.Equals(t, 1, repo.loaded)
+
+	// unchanged records are not written again
+	for _, record := range records {
+		fi, err := os.Stat(record)
+		restictest.OK(t, err)
+		restictest.Equals(t, recent, fi.ModTime())
+	}
+	restictest.Equals(t, len("content of file1"), testFS.bytesRead[filepath.FromSlash("dir/subdir/file1")])
+	restictest.Equals(t, len("content of file3"), testFS.bytesRead[filepath.FromSlash("dir/file3")])
+
+	// a modified file is read again
+	src["dir"].(TestDir)["file3"] = TestFile{Content: "modified content of file3"}
+	sleep()
+	save(t, filepath.Join(tempdir, "dir", "file3"), []byte("modified content of file3"))
+	snapshot(second)
+	restictest.Equals(t, len("content of file3")+len("modified content of file3"), testFS.bytesRead[filepath.FromSlash("dir/file3")])
+	restictest.Equals(t, len("content of file1"), testFS.bytesRead[filepath.FromSlash("dir/subdir/file1")])
+
+	// without a files cache, all trees of the parent snapshot are loaded
+	repo.loaded = 0
+	arch := New(repo, testFS, Options{})
+	_, _, err = arch.Snapshot(ctx, []string{"."}, SnapshotOptions{Time: time.Now(), ParentSnapshot: second})
+	restictest.OK(t, err)
+	restictest.Equals(t, 3, repo.loaded)
+}
+
+// filesCacheRecords returns the names of all records in the files cache.
+func filesCacheRecords(t testing.TB, dir string) []string {
+	records, err := filepath.Glob(filepath.Join(dir, "files", "*", "*"))
+	restictest.OK(t, err)
+	restictest.Assert(t, len(records) > 0, "no records found in the files cache")
+	return records
+}
+
+func TestFilesCacheExpire(t *testing.T) {
+	cachedir, removeCachedir := restictest.TempDir(t)
+	defer removeCachedir()
+
+	fc, err := NewFilesCache(cachedir, crypto.NewRandomKey(), time.Hour)
+	restictest.OK(t, err)
+
+	for _, path := range []string{"/old", "/new"} {
+		u := fc.update(path, nil)
+		u.add(&restic.Node{Name: "file", Type: "file", Size: 23})
+		u.save(&restic.Node{Name: path[1:], Type: "dir"})
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	restictest.OK(t, os.Chtimes(fc.filename("/old"), old, old))
+	// each call only checks some of the subdirectories
+	for i := 0; i < 256/filesCacheExpireBatch; i++ {
+		restictest.OK(t, fc.Expire())
+	}
+
+	restictest.Assert(t, fc.load("/old") == nil, "expired record was not removed")
+	d := fc.load("/new")
+	restictest.Assert(t, d != nil, "record was removed")
+	restictest.Equals(t, uint64(23), d.Find("file").Size)
+	restictest.Equals(t, "new", d.DirNode().Name)
+}
+
+func TestFilesCacheEncrypted(t *testing.T) {
+	cachedir, removeCachedir := restictest.TempDir(t)
+	defer removeCachedir()
+
+	key := crypto.NewRandomKey()
+	fc, err := NewFilesCache(cachedir, key, 0)
+	restictest.OK(t, err)
+
+	u := fc.update("/dir", nil)
+	u.add(&restic.Node{Name: "secret-file-name", Type: "file", Size: 23})
+	u.save(&restic.Node{Name: "dir", Type: "dir"})
+
+	buf, err := ioutil.ReadFile(fc.filename("/dir"))
+	restictest.OK(t, err)
+	restictest.Assert(t, !bytes.Contains(buf, []byte("secret-file-name")), "record is not encrypted")
+	restictest.Equals(t, uint64(23), fc.load("/dir").Find("secret-file-name").Size)
+
+	// records cannot be read with a different key
+	other, err := NewFilesCache(cachedir, crypto.NewRandomKey(), 0)
+	restictest.OK(t, err)
+	restictest.Assert(t, other.load("/dir") == nil, "record was decrypted with a different key")
+}
+
+func TestFilesCacheUnchanged(t *testing.T) {
+	cachedir, removeCachedir := restictest.TempDir(t)
+	defer removeCachedir()
+
+	fc, err := NewFilesCache(cachedir, crypto.NewRandomKey(), time.Hour)
+	restictest.OK(t, err)
+
+	save := func(size uint64) {
+		u := fc.update("/dir", fc.load("/dir"))
+		u.add(&restic.Node{Name: "file", Type: "file", Size: size})
+		u.save(&restic.Node{Name: "dir", Type: "dir"})
+	}
+
+	modTime := func() time.Time {
+		fi, err := os.Stat(fc.filename("/dir"))
+		restictest.OK(t, err)
+		return fi.ModTime()
+	}
+
+	setModTime := func(t0 time.Time) {
+		restictest.OK(t, os.Chtimes(fc.filename("/dir"), t0, t0))
+	}
+
+	save(23)
+	recent := time.Now().Add(-time.Minute).Truncate(time.Second)
+	setModTime(recent)
+
+	// an unchanged record is not written again
+	save(23)
+	restictest.Equals(t, recent, modTime())
+
+	// a changed record is written
+	save(42)
+	restictest.Assert(t, modTime().After(recent), "changed record was not written")
+	restictest.Equals(t, uint64(42), fc.load("/dir").Find("file").Size)
+
+	// an unchanged record older than half the TTL is written again
+	old := time.Now().Add(-45 * time.Minute).Truncate(time.Second)
+	setModTime(old)
+	save(42)
+	restictest.Assert(t, modTime().After(old), "old record was not written")
+}
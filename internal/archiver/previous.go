@@ -0,0 +1,134 @@
+package archiver
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// previousItem describes the version of an item in the parent snapshot. The
+// node is looked up lazily, so that the trees of the parent snapshot are only
+// loaded when the node is actually needed, e.g. not for files which are found
+// in the files cache.
+type previousItem struct {
+	once sync.Once
+	find func() (*restic.Node, error)
+	node *restic.Node
+	err  error
+
+	// cached is the entry for the item in the files cache, it is nil if
+	// there is none.
+	cached *filesCacheEntry
+	// update collects the entries for the directory containing the item.
+	update *filesCacheUpdate
+}
+
+// knownPrevious returns a previousItem for node, which has already been
+// loaded. If node is nil, nil is returned.
+func knownPrevious(node *restic.Node) *previousItem {
+	if node == nil {
+		return nil
+	}
+	return &previousItem{find: func() (*restic.Node, error) { return node, nil }}
+}
+
+// Node returns the node of the item in the parent snapshot, or nil if there
+// is none.
+func (p *previousItem) Node() (*restic.Node, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	p.once.Do(func() {
+		p.node, p.err = p.find()
+	})
+	return p.node, p.err
+}
+
+// cachedEntry returns the entry for the item in the files cache, or nil.
+func (p *previousItem) cachedEntry() *filesCacheEntry {
+	if p == nil {
+		return nil
+	}
+	return p.cached
+}
+
+// saved records node in the files cache once the item has been saved.
+func (p *previousItem) saved(node *restic.Node) {
+	if p == nil {
+		return
+	}
+	p.update.add(node)
+}
+
+// previousTree is the tree of a directory in the parent snapshot, which is
+// loaded when the first node of it is requested.
+type previousTree struct {
+	once sync.Once
+	load func() (*restic.Tree, error)
+	tree *restic.Tree
+	err  error
+
+	// cached is the record for the directory in the files cache, it is nil
+	// if there is none.
+	cached *filesCacheDir
+	// update collects the entries for the new record of the directory.
+	update *filesCacheUpdate
+}
+
+// Tree returns the tree, it is loaded on the first call.
+func (p *previousTree) Tree() (*restic.Tree, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	p.once.Do(func() {
+		p.tree, p.err = p.load()
+	})
+	return p.tree, p.err
+}
+
+// Item returns the previous version of the item name in the directory.
+func (p *previousTree) Item(name string) *previousItem {
+	if p == nil {
+		return nil
+	}
+
+	return &previousItem{
+		find: func() (*restic.Node, error) {
+			tree, err := p.Tree()
+			if err != nil {
+				return nil, err
+			}
+			return tree.Find(name), nil
+		},
+		cached: p.cached.Find(name),
+		update: p.update,
+	}
+}
+
+// previousSubtree returns the previous version of the contents of the
+// directory abstarget described by previous, together with its record in the
+// files cache. The tree is loaded on first use, errors are reported for
+// abstarget.
+func (arch *Archiver) previousSubtree(ctx context.Context, abstarget string, fi os.FileInfo, previous *previousItem) *previousTree {
+	cached := arch.FilesCache.load(abstarget)
+	return &previousTree{
+		load: func() (*restic.Tree, error) {
+			node, err := previous.Node()
+			if err != nil {
+				return nil, err
+			}
+
+			tree, err := arch.loadSubtree(ctx, node)
+			if err != nil {
+				err = arch.error(abstarget, fi, err)
+			}
+			return tree, err
+		},
+		cached: cached,
+		update: arch.FilesCache.update(abstarget, cached),
+	}
+}
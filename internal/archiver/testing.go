@@ -225,20 +225,17 @@ func TestEnsureFileContent(ctx context.Context, t testing.TB, repo restic.Reposi
 		return
 	}
 
-	content := make([]byte, restic.CiphertextLength(len(file.Content)))
-	pos := 0
+	content := make([]byte, 0, len(file.Content))
 	for _, id := range node.Content {
-		part, err := repo.LoadBlob(ctx, restic.DataBlob, id, content[pos:])
+		part, err := repo.LoadBlob(ctx, restic.DataBlob, id, nil)
 		if err != nil {
 			t.Fatalf("error loading blob %v: %v", id.Str(), err)
 			return
 		}
 
-		pos += len(part)
+		content = append(content, part...)
 	}
 
-	content = content[:pos]
-
 	if string(content) != file.Content {
 		t.Fatalf("%v: wrong content returned, want %q, got %q", filename, file.Content, content)
 	}
@@ -136,6 +136,39 @@ func Open(ctx context.Context, cfg Config) (*SFTP, error) {
 	return sftp, nil
 }
 
+// Client is an sftp session which is not bound to a repository, it gives
+// access to arbitrary files on the server.
+type Client struct {
+	*sftp.Client
+	r *SFTP
+}
+
+// Connect starts an sftp session as described by cfg by running "ssh" with
+// the appropriate arguments (or cfg.Command, if set), like Open. In contrast
+// to Open, no repository is accessed and cfg.Path is ignored.
+func Connect(cfg Config) (*Client, error) {
+	debug.Log("connect with config %#v", cfg)
+
+	cmd, args, err := buildSSHCommand(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := startClient(cmd, args...)
+	if err != nil {
+		debug.Log("unable to start program: %v", err)
+		return nil, err
+	}
+
+	r.Config = cfg
+	return &Client{Client: r.c, r: r}, nil
+}
+
+// Close closes the sftp session and waits for the ssh command to exit.
+func (c *Client) Close() error {
+	return c.r.Close()
+}
+
 func (r *SFTP) mkdirAllDataSubdirs() error {
 	for _, d := range r.Paths() {
 		err := r.c.MkdirAll(d)
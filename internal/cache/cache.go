@@ -260,3 +260,9 @@ func (c *Cache) Wrap(be restic.Backend) restic.Backend {
 func (c *Cache) BaseDir() string {
 	return c.Base
 }
+
+// FilesDir returns the directory used for the files cache of the backup
+// command.
+func (c *Cache) FilesDir() string {
+	return filepath.Join(c.path, "files")
+}
@@ -501,6 +501,13 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, size int6
 			continue
 		}
 
+		plaintext, err = repository.DecompressBlob(blob, plaintext)
+		if err != nil {
+			debug.Log("  error decompressing blob %v: %v", blob.ID, err)
+			errs = append(errs, errors.Errorf("blob %v: %v", i, err))
+			continue
+		}
+
 		hash := restic.Hash(plaintext)
 		if !hash.Equal(blob.ID) {
 			debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
@@ -511,7 +518,7 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID, size int6
 		// Check if blob is contained in index and position is correct
 		idxHas := false
 		for _, pb := range idx.Lookup(blob.BlobHandle) {
-			if pb.PackID == id && pb.Offset == blob.Offset && pb.Length == blob.Length {
+			if pb.PackID == id && pb.Offset == blob.Offset && pb.Length == blob.Length && pb.UncompressedLength == blob.UncompressedLength {
 				idxHas = true
 				break
 			}
@@ -300,3 +300,28 @@ func BenchmarkDecrypt(b *testing.B) {
 		rtest.OK(b, err)
 	}
 }
+
+func TestFindCiphertext(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	for _, size := range []int{0, 1, 15, 16, 17, 31, 32, 33, 1000, 1 << 16} {
+		data := rtest.Random(23, size)
+		nonce := crypto.NewRandomNonce()
+		ciphertext := k.Seal(append([]byte{}, nonce...), nonce, data, nil)
+		trailer := rtest.Random(42, 100)
+
+		n, ok := k.FindCiphertext(append(append([]byte{}, ciphertext...), trailer...))
+		rtest.Assert(t, ok, "ciphertext of size %d not found", size)
+		rtest.Equals(t, len(ciphertext), n)
+
+		// without a complete MAC the ciphertext must not be found
+		_, ok = k.FindCiphertext(ciphertext[:len(ciphertext)-1])
+		rtest.Assert(t, !ok, "truncated ciphertext of size %d found", size)
+
+		// a modified ciphertext must not be found
+		modified := append([]byte{}, ciphertext...)
+		modified[len(modified)/2] ^= 0x01
+		_, ok = k.FindCiphertext(append(modified, trailer...))
+		rtest.Assert(t, !ok, "modified ciphertext of size %d found", size)
+	}
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"math/bits"
+)
+
+// FindCiphertext checks whether buf starts with an authenticated ciphertext
+// in the format nonce || ciphertext || mac. The ciphertext can be followed by
+// arbitrary data. FindCiphertext returns the length of the shortest such
+// ciphertext including nonce and MAC, or false if none was found.
+//
+// The MAC is computed incrementally, so checking all possible lengths only
+// takes time linear in the length of buf.
+func (k *Key) FindCiphertext(buf []byte) (int, bool) {
+	if !k.Valid() || len(buf) < Extension {
+		return 0, false
+	}
+
+	nonce := buf[:ivSize]
+	if !validNonce(nonce) {
+		return 0, false
+	}
+
+	polyKey := poly1305PrepareKey(nonce, &k.MACKey)
+	var state scanMACState
+	state.init(&polyKey)
+
+	msg := buf[ivSize:]
+	var tag [macSize]byte
+	for l := 0; l+macSize <= len(msg); l++ {
+		// process all complete blocks before the current end of the message
+		if l > 0 && l%macSize == 0 {
+			state.update(msg[l-macSize:l], true)
+		}
+
+		state.sumPartial(msg[l-l%macSize:l], &tag)
+		if subtle.ConstantTimeCompare(tag[:], msg[l:l+macSize]) == 1 {
+			return ivSize + l + macSize, true
+		}
+	}
+
+	return 0, false
+}
+
+// scanMACState is the state of a Poly1305 computation, which in contrast to
+// the implementation in golang.org/x/crypto/poly1305 allows computing the tag
+// for a prefix of the message and then continuing with the remaining data.
+type scanMACState struct {
+	h [3]uint64
+	r [2]uint64
+	s [2]uint64
+}
+
+const (
+	scanRMask0 = 0x0FFFFFFC0FFFFFFF
+	scanRMask1 = 0x0FFFFFFC0FFFFFFC
+
+	// [p0, p1, p2] is 2^130 - 5 in little endian order.
+	scanP0 = 0xFFFFFFFFFFFFFFFB
+	scanP1 = 0xFFFFFFFFFFFFFFFF
+	scanP2 = 0x0000000000000003
+)
+
+func (m *scanMACState) init(key *[32]byte) {
+	m.r[0] = binary.LittleEndian.Uint64(key[0:8]) & scanRMask0
+	m.r[1] = binary.LittleEndian.Uint64(key[8:16]) & scanRMask1
+	m.s[0] = binary.LittleEndian.Uint64(key[16:24])
+	m.s[1] = binary.LittleEndian.Uint64(key[24:32])
+}
+
+// update processes a single block of at most 16 bytes. Only full blocks
+// may be passed with full set to true, a partial block must be the last one.
+func (m *scanMACState) update(block []byte, full bool) {
+	var buf [macSize]byte
+	copy(buf[:], block)
+
+	var c uint64
+	h0, h1, h2 := m.h[0], m.h[1], m.h[2]
+	h0, c = bits.Add64(h0, binary.LittleEndian.Uint64(buf[0:8]), 0)
+	h1, c = bits.Add64(h1, binary.LittleEndian.Uint64(buf[8:16]), c)
+	h2 += c
+	if full {
+		h2++
+	}
+
+	// compute h * r, h2 is at most 7 and the upper bits of r are cleared,
+	// thus the products h2*r0 and h2*r1 fit into 64 bits
+	r0, r1 := m.r[0], m.r[1]
+	h0r0hi, h0r0lo := bits.Mul64(h0, r0)
+	h1r0hi, h1r0lo := bits.Mul64(h1, r0)
+	h0r1hi, h0r1lo := bits.Mul64(h0, r1)
+	h1r1hi, h1r1lo := bits.Mul64(h1, r1)
+	h2r0 := h2 * r0
+	h2r1 := h2 * r1
+
+	m1lo, c := bits.Add64(h1r0lo, h0r1lo, 0)
+	m1hi, _ := bits.Add64(h1r0hi, h0r1hi, c)
+	m2lo, c := bits.Add64(h2r0, h1r1lo, 0)
+	m2hi, _ := bits.Add64(0, h1r1hi, c)
+
+	t0 := h0r0lo
+	t1, c := bits.Add64(m1lo, h0r0hi, 0)
+	t2, c := bits.Add64(m2lo, m1hi, c)
+	t3, _ := bits.Add64(h2r1, m2hi, c)
+
+	// reduce modulo 2^130 - 5 using a * 2^130 + b = a * 5 + b
+	h0, h1, h2 = t0, t1, t2&3
+	cclo, cchi := t2&^3, t3
+
+	h0, c = bits.Add64(h0, cclo, 0)
+	h1, c = bits.Add64(h1, cchi, c)
+	h2 += c
+
+	cclo, cchi = cclo>>2|cchi<<62, cchi>>2
+
+	h0, c = bits.Add64(h0, cclo, 0)
+	h1, c = bits.Add64(h1, cchi, c)
+	h2 += c
+
+	m.h[0], m.h[1], m.h[2] = h0, h1, h2
+}
+
+// sumPartial computes the tag for the data processed so far followed by the
+// partial block rest, without modifying the state.
+func (m *scanMACState) sumPartial(rest []byte, out *[macSize]byte) {
+	state := *m
+	if len(rest) > 0 {
+		var buf [macSize]byte
+		copy(buf[:], rest)
+		buf[len(rest)] = 1
+		state.update(buf[:], false)
+	}
+
+	h0, h1, h2 := state.h[0], state.h[1], state.h[2]
+
+	// h is less than 2 * (2^130 - 5), subtract p once if h >= p
+	hMinusP0, b := bits.Sub64(h0, scanP0, 0)
+	hMinusP1, b := bits.Sub64(h1, scanP1, b)
+	_, b = bits.Sub64(h2, scanP2, b)
+	if b == 0 {
+		h0, h1 = hMinusP0, hMinusP1
+	}
+
+	// tag = h + s mod 2^128
+	h0, c := bits.Add64(h0, state.s[0], 0)
+	h1, _ = bits.Add64(h1, state.s[1], c)
+
+	binary.LittleEndian.PutUint64(out[0:8], h0)
+	binary.LittleEndian.PutUint64(out[8:16], h1)
+}
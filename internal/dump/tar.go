@@ -6,22 +6,24 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
 type tarDumper struct {
-	w *tar.Writer
+	w      *tar.Writer
+	owners *restic.OwnerMapping
 }
 
 // Statically ensure that tarDumper implements dumper.
 var _ dumper = tarDumper{}
 
-// WriteTar will write the contents of the given tree, encoded as a tar to the given destination.
-func WriteTar(ctx context.Context, repo restic.Repository, tree *restic.Tree, rootPath string, dst io.Writer) error {
-	dmp := tarDumper{w: tar.NewWriter(dst)}
+// WriteTar will write the contents of the given tree, encoded as a tar to the
+// given destination. The owners stored in the tar headers are translated with
+// owners, which may be nil.
+func WriteTar(ctx context.Context, repo restic.Repository, tree *restic.Tree, rootPath string, dst io.Writer, owners *restic.OwnerMapping) error {
+	dmp := tarDumper{w: tar.NewWriter(dst), owners: owners}
 
 	return writeDump(ctx, repo, tree, rootPath, dmp, dst)
 }
@@ -45,6 +47,7 @@ func (dmp tarDumper) dumpNode(ctx context.Context, node *restic.Node, repo resti
 		return err
 	}
 
+	owner := dmp.owners.Map(node)
 	header := &tar.Header{
 		Name: filepath.ToSlash(relPath),
 		Size: int64(node.Size),
@@ -53,14 +56,14 @@ func (dmp tarDumper) dumpNode(ctx context.Context, node *restic.Node, repo resti
 		//
 		// https://golang.org/pkg/archive/tar/#Format
 		Mode:       int64(node.Mode & 07777777),
-		Uid:        int(node.UID),
-		Gid:        int(node.GID),
-		Uname:      node.User,
-		Gname:      node.Group,
+		Uid:        int(owner.UID),
+		Gid:        int(owner.GID),
+		Uname:      owner.User,
+		Gname:      owner.Group,
 		ModTime:    node.ModTime,
 		AccessTime: node.AccessTime,
 		ChangeTime: node.ChangeTime,
-		PAXRecords: parseXattrs(node.ExtendedAttributes),
+		PAXRecords: parseXattrs(owner.ExtendedAttributes),
 	}
 
 	// adapted from archive/tar.FileInfoHeader
@@ -119,16 +122,16 @@ func parseXattrs(xattrs []restic.ExtendedAttribute) map[string]string {
 	for _, attr := range xattrs {
 		attrString := string(attr.Value)
 
-		if strings.HasPrefix(attr.Name, "system.posix_acl_") {
-			na := acl{}
-			na.decode(attr.Value)
+		if restic.IsACLAttribute(attr.Name) {
+			na, err := restic.ParseACL(attr.Value)
+			if err != nil || len(na.Entries) == 0 {
+				continue
+			}
 
-			if na.String() != "" {
-				if strings.Contains(attr.Name, "system.posix_acl_access") {
-					tmpMap["SCHILY.acl.access"] = na.String()
-				} else if strings.Contains(attr.Name, "system.posix_acl_default") {
-					tmpMap["SCHILY.acl.default"] = na.String()
-				}
+			if attr.Name == restic.ACLAccessAttribute {
+				tmpMap["SCHILY.acl.access"] = na.String()
+			} else {
+				tmpMap["SCHILY.acl.default"] = na.String()
 			}
 		} else {
 			tmpMap["SCHILY.xattr."+attr.Name] = attrString
@@ -3,6 +3,7 @@ package dump
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,10 +14,16 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func TestWriteTar(t *testing.T) {
-	WriteTest(t, WriteTar, checkTar)
+	wd := func(ctx context.Context, repo restic.Repository, tree *restic.Tree, rootPath string, dst io.Writer) error {
+		return WriteTar(ctx, repo, tree, rootPath, dst, nil)
+	}
+	WriteTest(t, wd, checkTar)
 }
 
 func checkTar(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
@@ -113,3 +120,64 @@ func checkTar(t *testing.T, testDir string, srcTar *bytes.Buffer) error {
 
 	return nil
 }
+
+func TestWriteTarOwnerMapping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	acl := &restic.ACL{Version: 2, Entries: []restic.ACLEntry{
+		{Tag: restic.ACLUserOwner, Perm: 6},
+		{Tag: restic.ACLUser, ID: 1000, Perm: 6},
+		{Tag: restic.ACLGroupOwner, Perm: 4},
+		{Tag: restic.ACLGroup, ID: 100, Perm: 4},
+		{Tag: restic.ACLMask, Perm: 6},
+		{Tag: restic.ACLOther, Perm: 0},
+	}}
+	attrs := []restic.ExtendedAttribute{{Name: restic.ACLAccessAttribute, Value: acl.Encode()}}
+
+	tree := restic.NewTree()
+	for _, node := range []*restic.Node{
+		{Name: "mapped", Type: "symlink", LinkTarget: "x", Mode: os.ModeSymlink | 0777, UID: 1000, GID: 100, User: "alice", Group: "users", ExtendedAttributes: attrs},
+		{Name: "unmapped", Type: "symlink", LinkTarget: "x", Mode: os.ModeSymlink | 0777, UID: 1001, GID: 101, User: "bob", Group: "staff"},
+	} {
+		rtest.OK(t, tree.Insert(node))
+	}
+
+	owners := &restic.OwnerMapping{
+		UIDs: map[uint32]uint32{1000: 2000},
+		GIDs: map[uint32]uint32{100: 200},
+	}
+
+	dst := &bytes.Buffer{}
+	rtest.OK(t, WriteTar(ctx, repo, tree, "/", dst, owners))
+
+	type owner struct {
+		uid, gid     int
+		uname, gname string
+	}
+	want := map[string]owner{
+		"mapped":   {2000, 200, "", ""},
+		"unmapped": {1001, 101, "bob", "staff"},
+	}
+
+	tr := tar.NewReader(dst)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		rtest.Equals(t, want[hdr.Name], owner{hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname})
+		if hdr.Name == "mapped" {
+			// the IDs within the ACL are translated like the owner
+			rtest.Equals(t, acl.MapIDs(owners.UIDs, owners.GIDs).String(), hdr.PAXRecords["SCHILY.acl.access"])
+			rtest.Assert(t, strings.Contains(hdr.PAXRecords["SCHILY.acl.access"], "user:2000:rw-"),
+				"ACL user entry not mapped: %q", hdr.PAXRecords["SCHILY.acl.access"])
+		}
+		delete(want, hdr.Name)
+	}
+	rtest.Equals(t, 0, len(want))
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"path/filepath"
+	"strings"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -38,6 +39,7 @@ func (dmp zipDumper) dumpNode(ctx context.Context, node *restic.Node, repo resti
 		Name:               filepath.ToSlash(relPath),
 		UncompressedSize64: node.Size,
 		Modified:           node.ModTime,
+		Comment:            aclComment(node),
 	}
 	header.SetMode(node.Mode)
 
@@ -60,3 +62,18 @@ func (dmp zipDumper) dumpNode(ctx context.Context, node *restic.Node, repo resti
 
 	return GetNodeData(ctx, w, repo, node)
 }
+
+// aclComment returns the POSIX ACLs of node in a format suitable for the
+// comment of a zip file entry, as zip files have no standard field for ACLs.
+func aclComment(node *restic.Node) string {
+	access, def := node.ACLs()
+
+	var lines []string
+	if access != nil && len(access.Entries) > 0 {
+		lines = append(lines, "acl.access="+access.Short())
+	}
+	if def != nil && len(def.Entries) > 0 {
+		lines = append(lines, "acl.default="+def.Short())
+	}
+	return strings.Join(lines, "\n")
+}
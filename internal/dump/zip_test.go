@@ -12,12 +12,35 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func TestWriteZip(t *testing.T) {
 	WriteTest(t, WriteZip, checkZip)
 }
 
+func TestZipACLComment(t *testing.T) {
+	acl := &restic.ACL{Version: 2, Entries: []restic.ACLEntry{
+		{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+		{Tag: restic.ACLUser, ID: 1000, Perm: 7},
+		{Tag: restic.ACLOther, ID: 0xffffffff, Perm: 4},
+	}}
+
+	node := &restic.Node{}
+	rtest.Equals(t, "", aclComment(node))
+
+	node.ExtendedAttributes = []restic.ExtendedAttribute{
+		{Name: "user.foo", Value: []byte("bar")},
+		{Name: restic.ACLAccessAttribute, Value: acl.Encode()},
+	}
+	rtest.Equals(t, "acl.access=user::rw-,user:1000:rwx,other::r--", aclComment(node))
+
+	node.ExtendedAttributes = append(node.ExtendedAttributes,
+		restic.ExtendedAttribute{Name: restic.ACLDefaultAttribute, Value: acl.Encode()})
+	rtest.Equals(t, "acl.access=user::rw-,user:1000:rwx,other::r--\nacl.default=user::rw-,user:1000:rwx,other::r--", aclComment(node))
+}
+
 func readZipFile(f *zip.File) ([]byte, error) {
 	rc, err := f.Open()
 	if err != nil {
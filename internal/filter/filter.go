@@ -17,7 +17,10 @@ type patternPart struct {
 }
 
 // Pattern represents a preparsed filter pattern
-type Pattern []patternPart
+type Pattern struct {
+	parts     []patternPart
+	isNegated bool
+}
 
 func prepareStr(str string) ([]string, error) {
 	if str == "" {
@@ -26,7 +29,7 @@ func prepareStr(str string) ([]string, error) {
 	return splitPath(str), nil
 }
 
-func preparePattern(pattern string) Pattern {
+func preparePattern(pattern string) []patternPart {
 	parts := splitPath(filepath.Clean(pattern))
 	patterns := make([]patternPart, len(parts))
 	for i, part := range parts {
@@ -102,7 +105,7 @@ func ChildMatch(pattern, str string) (matched bool, err error) {
 	return childMatch(patterns, strs)
 }
 
-func childMatch(patterns Pattern, strs []string) (matched bool, err error) {
+func childMatch(patterns []patternPart, strs []string) (matched bool, err error) {
 	if patterns[0].pattern != "/" {
 		// relative pattern can always be nested down
 		return true, nil
@@ -124,7 +127,7 @@ func childMatch(patterns Pattern, strs []string) (matched bool, err error) {
 	return match(patterns[0:l], strs)
 }
 
-func hasDoubleWildcard(list Pattern) (ok bool, pos int) {
+func hasDoubleWildcard(list []patternPart) (ok bool, pos int) {
 	for i, item := range list {
 		if item.pattern == "" {
 			return true, i
@@ -134,10 +137,10 @@ func hasDoubleWildcard(list Pattern) (ok bool, pos int) {
 	return false, 0
 }
 
-func match(patterns Pattern, strs []string) (matched bool, err error) {
+func match(patterns []patternPart, strs []string) (matched bool, err error) {
 	if ok, pos := hasDoubleWildcard(patterns); ok {
 		// gradually expand '**' into separate wildcards
-		newPat := make(Pattern, len(strs))
+		newPat := make([]patternPart, len(strs))
 		// copy static prefix once
 		copy(newPat, patterns[:pos])
 		for i := 0; i <= len(strs)-len(patterns)+1; i++ {
@@ -207,7 +210,9 @@ func match(patterns Pattern, strs []string) (matched bool, err error) {
 	return false, nil
 }
 
-// ParsePatterns prepares a list of patterns for use with List.
+// ParsePatterns prepares a list of patterns for use with List. A pattern
+// starting with "!" is negated, it excludes the paths it matches from the
+// preceding patterns. A leading "!" of a pattern can be escaped as "\\!".
 func ParsePatterns(patterns []string) []Pattern {
 	patpat := make([]Pattern, 0)
 	for _, pat := range patterns {
@@ -215,24 +220,35 @@ func ParsePatterns(patterns []string) []Pattern {
 			continue
 		}
 
-		pats := preparePattern(pat)
-		patpat = append(patpat, pats)
+		isNegated := false
+		if strings.HasPrefix(pat, "!") {
+			isNegated = true
+			pat = pat[1:]
+			if pat == "" {
+				continue
+			}
+		}
+
+		patpat = append(patpat, Pattern{preparePattern(pat), isNegated})
 	}
 	return patpat
 }
 
-// List returns true if str matches one of the patterns. Empty patterns are ignored.
+// List returns true if str matches one of the patterns. Empty patterns are
+// ignored. If negated patterns are used, the last matching pattern decides.
 func List(patterns []Pattern, str string) (matched bool, err error) {
 	matched, _, err = list(patterns, false, str)
 	return matched, err
 }
 
-// ListWithChild returns true if str matches one of the patterns. Empty patterns are ignored.
+// ListWithChild returns true if str matches one of the patterns. Empty
+// patterns are ignored. If negated patterns are used, the last matching
+// pattern decides. childMayMatch is true if children of str may match.
 func ListWithChild(patterns []Pattern, str string) (matched bool, childMayMatch bool, err error) {
 	return list(patterns, true, str)
 }
 
-// List returns true if str matches one of the patterns. Empty patterns are ignored.
+// list returns true if str matches one of the patterns. Empty patterns are ignored.
 func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool, childMayMatch bool, err error) {
 	if len(patterns) == 0 {
 		return false, false, nil
@@ -242,15 +258,21 @@ func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool,
 	if err != nil {
 		return false, false, err
 	}
+
+	hasNegatedPattern := false
 	for _, pat := range patterns {
-		m, err := match(pat, strs)
+		hasNegatedPattern = hasNegatedPattern || pat.isNegated
+	}
+
+	for _, pat := range patterns {
+		m, err := match(pat.parts, strs)
 		if err != nil {
 			return false, false, err
 		}
 
 		var c bool
 		if checkChildMatches {
-			c, err = childMatch(pat, strs)
+			c, err = childMatch(pat.parts, strs)
 			if err != nil {
 				return false, false, err
 			}
@@ -258,10 +280,18 @@ func list(patterns []Pattern, checkChildMatches bool, str string) (matched bool,
 			c = true
 		}
 
+		if pat.isNegated {
+			// a negated pattern only removes str itself, children of str
+			// may still be matched by the preceding patterns
+			matched = matched && !m
+			continue
+		}
+
 		matched = matched || m
 		childMayMatch = childMayMatch || c
 
-		if matched && childMayMatch {
+		if matched && childMayMatch && !hasNegatedPattern {
+			// without negated patterns the result cannot change any more
 			return true, true, nil
 		}
 	}
@@ -257,6 +257,16 @@ var filterListTests = []struct {
 	{[]string{"/*/*/bar/test.*"}, "/foo/bar/test.go", false, false},
 	{[]string{"/*/*/bar/test.*", "*.go"}, "/foo/bar/test.go", true, true},
 	{[]string{"", "*.c"}, "/foo/bar/test.go", false, true},
+
+	// negated patterns
+	{[]string{"*.go", "!test.go"}, "/foo/bar/test.go", false, true},
+	{[]string{"*.go", "!test.go"}, "/foo/bar/main.go", true, true},
+	{[]string{"!test.go", "*.go"}, "/foo/bar/test.go", true, true},
+	{[]string{"*.go", "!test.go", "/foo/bar/test.go"}, "/foo/bar/test.go", true, true},
+	{[]string{"/foo/*", "!/foo/bar"}, "/foo/bar/test.go", false, true},
+	{[]string{"/foo/*", "!/foo/bar"}, "/foo/baz/test.go", true, true},
+	{[]string{"/foo", "!/foo/bar"}, "/foo/bar", false, true},
+	{[]string{"!"}, "/foo/bar/test.go", false, false},
 }
 
 func TestList(t *testing.T) {
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile contains the rules of an ignore file, which uses the syntax of
+// gitignore files. The rules apply to the items below the directory which
+// contains the ignore file.
+type IgnoreFile struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	// parts are the slash-separated components of the pattern
+	parts   []string
+	negated bool
+	// anchored patterns are matched against the path relative to the
+	// directory of the ignore file, the others against the last component
+	anchored bool
+	dirOnly  bool
+}
+
+// ParseIgnoreFile parses the content of an ignore file:
+//
+//   - Empty lines and lines starting with "#" are ignored, trailing spaces are
+//     removed unless they are escaped with a backslash.
+//   - A pattern starting with "!" re-includes the items excluded by a previous
+//     pattern. A leading "#" or "!" can be escaped with a backslash.
+//   - A pattern ending with "/" only matches directories.
+//   - A pattern containing a "/" at the beginning or in the middle is relative
+//     to the directory of the ignore file, otherwise it matches items with
+//     that name at any level below the directory.
+//   - "*", "?" and "[...]" match within a path component, "**" matches any
+//     number of directories.
+func ParseIgnoreFile(data []byte) *IgnoreFile {
+	f := &IgnoreFile{}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = trimTrailingSpaces(line)
+
+		var rule ignoreRule
+		switch {
+		case strings.HasPrefix(line, "!"):
+			rule.negated = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		for _, part := range strings.Split(line, "/") {
+			// ignore duplicate slashes
+			if part != "" {
+				rule.parts = append(rule.parts, part)
+			}
+		}
+
+		f.rules = append(f.rules, rule)
+	}
+
+	return f
+}
+
+// trimTrailingSpaces removes trailing spaces from line which are not escaped
+// with a backslash.
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// Match checks the item at the path rel, relative to the directory of the
+// ignore file. If one of the rules matches, matched is true and ignored
+// reports whether the last matching rule excludes the item.
+func (f *IgnoreFile) Match(rel string, isDir bool) (ignored bool, matched bool) {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		rule := f.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var ok bool
+		if rule.anchored {
+			ok = matchIgnoreParts(rule.parts, parts)
+		} else {
+			ok = matchIgnoreParts(rule.parts, parts[len(parts)-1:])
+		}
+
+		if ok {
+			return !rule.negated, true
+		}
+	}
+
+	return false, false
+}
+
+// matchIgnoreParts returns true if the pattern components match all path
+// components, "**" matches any number of components. A trailing "**" matches
+// at least one component, such that "foo/**" matches the content of "foo",
+// but not "foo" itself.
+func matchIgnoreParts(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchIgnoreParts(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+
+	return len(parts) == 0
+}
@@ -0,0 +1,92 @@
+package filter_test
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+)
+
+func TestIgnoreFile(t *testing.T) {
+	f := filter.ParseIgnoreFile([]byte(`# comment
+*.o
+!keep.o
+/build
+logs/
+doc/*.html
+**/tmp/**
+a/**/b
+\#notacomment
+\!bang
+trailing  
+`))
+
+	var tests = []struct {
+		path    string
+		isDir   bool
+		ignored bool
+		matched bool
+	}{
+		{"main.o", false, true, true},
+		{"src/main.o", false, true, true},
+		{"src/keep.o", false, false, true},
+		{"main.go", false, false, false},
+
+		// anchored pattern
+		{"build", true, true, true},
+		{"build", false, true, true},
+		{"src/build", true, false, false},
+
+		// directories only
+		{"logs", true, true, true},
+		{"logs", false, false, false},
+		{"src/logs", true, true, true},
+
+		// pattern with a slash is anchored
+		{"doc/index.html", false, true, true},
+		{"src/doc/index.html", false, false, false},
+		{"doc/sub/index.html", false, false, false},
+
+		// double wildcards
+		{"tmp/foo", false, true, true},
+		{"src/tmp/foo/bar", false, true, true},
+		{"tmp", true, false, false},
+		{"a/b", true, true, true},
+		{"a/x/y/b", true, true, true},
+		{"x/a/b", true, false, false},
+
+		// escapes and trailing spaces
+		{"#notacomment", false, true, true},
+		{"!bang", false, true, true},
+		{"trailing", false, true, true},
+	}
+
+	for _, test := range tests {
+		ignored, matched := f.Match(test.path, test.isDir)
+		if ignored != test.ignored || matched != test.matched {
+			t.Errorf("Match(%q, %v) = %v, %v, want %v, %v",
+				test.path, test.isDir, ignored, matched, test.ignored, test.matched)
+		}
+	}
+}
+
+func TestIgnoreFileLastRuleWins(t *testing.T) {
+	f := filter.ParseIgnoreFile([]byte("*\n!*/\n!*.go\n"))
+
+	var tests = []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"src", true, false},
+		{"src/main.go", false, false},
+		{"src/main.c", false, true},
+	}
+
+	for _, test := range tests {
+		ignored, matched := f.Match(test.path, test.isDir)
+		if !matched || ignored != test.ignored {
+			t.Errorf("Match(%q, %v) = %v, %v, want %v, true",
+				test.path, test.isDir, ignored, matched, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package filter
+
+import "path/filepath"
+
+// PathSet is a set of paths, it is used to select a large number of literal
+// paths. In contrast to a list of patterns, the time needed to check whether a
+// path is contained in the set only depends on the number of path components,
+// not on the number of paths in the set.
+type PathSet struct {
+	root pathSetNode
+}
+
+type pathSetNode struct {
+	children map[string]*pathSetNode
+	// contained is true if the path ending at this node was added to the set
+	contained bool
+}
+
+// NewPathSet returns a set containing paths.
+func NewPathSet(paths ...string) *PathSet {
+	s := &PathSet{}
+	for _, p := range paths {
+		s.Add(p)
+	}
+	return s
+}
+
+// Add adds the path p to the set, which also selects all items below it. The
+// empty path is ignored.
+func (s *PathSet) Add(p string) {
+	if p == "" {
+		return
+	}
+
+	node := &s.root
+	for _, part := range pathSetParts(p) {
+		if node.contained {
+			// a parent directory is already contained
+			return
+		}
+
+		child, ok := node.children[part]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[string]*pathSetNode)
+			}
+			child = &pathSetNode{}
+			node.children[part] = child
+		}
+		node = child
+	}
+
+	node.contained = true
+	// all paths below p are contained anyway
+	node.children = nil
+}
+
+// Match returns true if p or one of its parent directories is contained in the
+// set. childMayMatch is true if paths below p may be contained in the set.
+func (s *PathSet) Match(p string) (matched bool, childMayMatch bool) {
+	if p == "" {
+		return false, false
+	}
+
+	node := &s.root
+	for _, part := range pathSetParts(p) {
+		if node.contained {
+			return true, true
+		}
+
+		node = node.children[part]
+		if node == nil {
+			return false, false
+		}
+	}
+
+	return node.contained, node.contained || len(node.children) > 0
+}
+
+// Empty returns true if the set does not contain any path.
+func (s *PathSet) Empty() bool {
+	return !s.root.contained && len(s.root.children) == 0
+}
+
+// pathSetParts splits p into its components, for the root directory this
+// only returns "/".
+func pathSetParts(p string) []string {
+	parts := splitPath(filepath.Clean(p))
+	if len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
@@ -0,0 +1,78 @@
+package filter_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+)
+
+func TestPathSet(t *testing.T) {
+	s := filter.NewPathSet(
+		"/home/user/work/report.txt",
+		"/home/user/projects/",
+		"/home/user/projects/restic/main.go",
+		"/srv/www/../data",
+	)
+
+	var tests = []struct {
+		path          string
+		match         bool
+		childMayMatch bool
+	}{
+		{"/", false, true},
+		{"/home", false, true},
+		{"/home/user", false, true},
+		{"/home/user/work", false, true},
+		{"/home/user/work/report.txt", true, true},
+		{"/home/user/work/report.txt.bak", false, false},
+		{"/home/user/work/other.txt", false, false},
+		{"/home/user/projects", true, true},
+		{"/home/user/projects/restic/main.go", true, true},
+		{"/home/user/projects/other", true, true},
+		{"/srv", false, true},
+		{"/srv/www", false, false},
+		{"/srv/data/file", true, true},
+		{"/tmp", false, false},
+		{"home/user", false, false},
+		{"", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			match, childMayMatch := s.Match(filepath.FromSlash(test.path))
+			if match != test.match || childMayMatch != test.childMayMatch {
+				t.Errorf("Match(%q): expected %v, %v, got %v, %v",
+					test.path, test.match, test.childMayMatch, match, childMayMatch)
+			}
+		})
+	}
+
+	if s.Empty() {
+		t.Errorf("set is empty")
+	}
+	if !filter.NewPathSet().Empty() {
+		t.Errorf("new set is not empty")
+	}
+}
+
+func ExamplePathSet() {
+	s := filter.NewPathSet("/home/user/file.go", "/srv")
+	match, _ := s.Match("/srv/www/index.html")
+	fmt.Printf("match: %v\n", match)
+	// Output:
+	// match: true
+}
+
+func BenchmarkPathSet(b *testing.B) {
+	s := filter.NewPathSet()
+	for i := 0; i < 100000; i++ {
+		s.Add(fmt.Sprintf("/home/user/dir%d/file%d", i%1000, i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Match("/home/user/dir500/file12345")
+	}
+}
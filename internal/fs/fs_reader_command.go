@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// CommandReader provides the standard output of a command. Once all data has
+// been read, the exit status of the command is checked: if the command
+// failed, Read returns an error instead of io.EOF. This ensures that the
+// truncated output of a failed command is never mistaken for a complete file.
+type CommandReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+
+	eof      bool
+	waitOnce sync.Once
+	waitErr  error
+}
+
+// statically ensure that CommandReader implements io.ReadCloser.
+var _ io.ReadCloser = &CommandReader{}
+
+// NewCommandReader starts the command args, its standard error is written to
+// stderr. The command is killed when ctx is cancelled.
+func NewCommandReader(ctx context.Context, args []string, stderr io.Writer) (*CommandReader, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no command specified")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "StdoutPipe")
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.Fatalf("unable to start command %q: %v", strings.Join(args, " "), err)
+	}
+
+	return &CommandReader{cmd: cmd, stdout: stdout}, nil
+}
+
+// Read reads the output of the command. When the end of the output is
+// reached, it waits for the command to exit and returns an error if the
+// command failed.
+func (r *CommandReader) Read(p []byte) (int, error) {
+	if r.eof {
+		// the pipe has been closed when the command exited
+		if werr := r.wait(); werr != nil {
+			return 0, werr
+		}
+		return 0, io.EOF
+	}
+
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.eof = true
+		if werr := r.wait(); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// wait waits for the command to exit, it may be called several times.
+func (r *CommandReader) wait() error {
+	r.waitOnce.Do(func() {
+		err := r.cmd.Wait()
+		if err != nil {
+			r.waitErr = errors.Fatalf("command %q failed: %v", strings.Join(r.cmd.Args, " "), err)
+		}
+	})
+	return r.waitErr
+}
+
+// Close waits for the command to exit and returns an error if it failed. If
+// the output has not been read completely, the command is killed first.
+func (r *CommandReader) Close() error {
+	if !r.eof {
+		// the remaining output is not needed, stop the command
+		_ = r.cmd.Process.Kill()
+		_ = r.wait()
+		return nil
+	}
+
+	return r.wait()
+}
@@ -0,0 +1,76 @@
+package fs
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCommandReader(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	var tests = []struct {
+		script string
+		want   string
+		err    string
+	}{
+		{
+			script: "echo foo; echo bar",
+			want:   "foo\nbar\n",
+		},
+		{
+			script: "true",
+			want:   "",
+		},
+		{
+			script: "echo partial; exit 3",
+			want:   "partial\n",
+			err:    "exit status 3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.script, func(t *testing.T) {
+			rd, err := NewCommandReader(context.TODO(), []string{"sh", "-c", test.script}, ioutil.Discard)
+			rtest.OK(t, err)
+
+			buf, err := ioutil.ReadAll(rd)
+			rtest.Equals(t, test.want, string(buf))
+			if test.err != "" {
+				rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err),
+					"expected error containing %q, got %v", test.err, err)
+				rtest.Assert(t, rd.Close() != nil, "Close did not return the error of the command")
+				return
+			}
+			rtest.OK(t, err)
+			rtest.OK(t, rd.Close())
+		})
+	}
+}
+
+func TestCommandReaderNotFound(t *testing.T) {
+	_, err := NewCommandReader(context.TODO(), []string{"/nonexistent/command"}, ioutil.Discard)
+	rtest.Assert(t, err != nil, "starting a nonexistent command did not return an error")
+}
+
+func TestCommandReaderCloseEarly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	rd, err := NewCommandReader(context.TODO(), []string{"sh", "-c", "while true; do echo data; done"}, ioutil.Discard)
+	rtest.OK(t, err)
+
+	buf := make([]byte, 16)
+	_, err = rd.Read(buf)
+	rtest.OK(t, err)
+
+	// the command is killed, this must not block
+	rtest.OK(t, rd.Close())
+}
@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"os"
+	"path"
+	"syscall"
+)
+
+// MultiReader is a file system which provides several files, each of which
+// is provided by a Reader. The files are listed in the root directory, they
+// must have distinct names.
+type MultiReader struct {
+	Readers []*Reader
+}
+
+// statically ensure that MultiReader implements FS.
+var _ FS = &MultiReader{}
+
+// VolumeName returns leading volume name, for the MultiReader file system it's
+// always the empty string.
+func (fs *MultiReader) VolumeName(path string) string {
+	return ""
+}
+
+// Open opens a file for reading.
+func (fs *MultiReader) Open(name string) (File, error) {
+	switch name {
+	case "/", ".":
+		entries := make([]os.FileInfo, 0, len(fs.Readers))
+		for _, rd := range fs.Readers {
+			entries = append(entries, rd.fi())
+		}
+		return fakeDir{entries: entries}, nil
+	}
+
+	for _, rd := range fs.Readers {
+		if name == rd.Name {
+			return rd.Open(name)
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// OpenFile is the generalized open call; most users will use Open
+// or Create instead.  It opens the named file with specified flag
+// (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
+// methods on the returned File can be used for I/O.
+// If there is an error, it will be of type *PathError.
+func (fs *MultiReader) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	for _, rd := range fs.Readers {
+		if name == rd.Name {
+			return rd.OpenFile(name, flag, perm)
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// Stat returns a FileInfo describing the named file. If there is an error, it
+// will be of type *PathError.
+func (fs *MultiReader) Stat(name string) (os.FileInfo, error) {
+	return fs.Lstat(name)
+}
+
+// Lstat returns the FileInfo structure describing the named file. The
+// directories containing the files are reported by all Readers, the first
+// one which knows about name is used.
+func (fs *MultiReader) Lstat(name string) (os.FileInfo, error) {
+	for _, rd := range fs.Readers {
+		fi, err := rd.Lstat(name)
+		if err == nil {
+			return fi, nil
+		}
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls Clean on the result; in particular, all
+// empty strings are ignored.
+func (fs *MultiReader) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Separator returns the OS and FS dependent separator for dirs/subdirs/files.
+func (fs *MultiReader) Separator() string {
+	return "/"
+}
+
+// IsAbs reports whether the path is absolute. For the MultiReader, this is
+// always the case.
+func (fs *MultiReader) IsAbs(p string) bool {
+	return true
+}
+
+// Abs returns an absolute representation of path. For the MultiReader, all
+// paths are absolute.
+func (fs *MultiReader) Abs(p string) (string, error) {
+	return path.Clean(p), nil
+}
+
+// Clean returns the cleaned path. For details, see filepath.Clean.
+func (fs *MultiReader) Clean(p string) string {
+	return path.Clean(p)
+}
+
+// Base returns the last element of p.
+func (fs *MultiReader) Base(p string) string {
+	return path.Base(p)
+}
+
+// Dir returns p without the last element.
+func (fs *MultiReader) Dir(p string) string {
+	return path.Dir(p)
+}
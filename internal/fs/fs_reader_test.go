@@ -443,3 +443,52 @@ func TestFSReaderMinFileSize(t *testing.T) {
 		})
 	}
 }
+
+func TestFSMultiReader(t *testing.T) {
+	data1 := test.Random(23, 1<<16)
+	data2 := test.Random(42, 1<<10)
+	now := time.Now()
+
+	fs := &MultiReader{Readers: []*Reader{
+		{
+			Name:       "foo",
+			ReadCloser: ioutil.NopCloser(bytes.NewReader(data1)),
+			Mode:       0644,
+			ModTime:    now,
+		},
+		{
+			Name:       "bar",
+			ReadCloser: ioutil.NopCloser(bytes.NewReader(data2)),
+			Mode:       0600,
+			ModTime:    now,
+		},
+	}}
+
+	verifyDirectoryContents(t, fs, "/", []string{"foo", "bar"})
+
+	fi, err := fs.Lstat("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFileInfo(t, fi, "/", time.Time{}, os.ModeDir|0755, true)
+
+	fi, err = fs.Lstat("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFileInfo(t, fi, "bar", now, 0600, false)
+
+	_, err = fs.Lstat("other")
+	if !os.IsNotExist(err) {
+		t.Fatalf("Lstat of missing file returned wrong error %v", err)
+	}
+
+	verifyFileContentOpen(t, fs, "foo", data1)
+	verifyFileContentOpenFile(t, fs, "bar", data2)
+
+	// each file can only be opened once
+	_, err = fs.Open("foo")
+	if err == nil {
+		t.Fatal("second Open of the same file did not return an error")
+	}
+}
@@ -0,0 +1,22 @@
+package fs
+
+// Linux inode flags as set by chattr(1), see ioctl_iflags(2). Only the flags
+// which can be changed by users are listed.
+const (
+	InodeFlagCompress    = 0x00000004 // c: compress file contents
+	InodeFlagSync        = 0x00000008 // S: synchronous updates
+	InodeFlagImmutable   = 0x00000010 // i: file cannot be modified
+	InodeFlagAppend      = 0x00000020 // a: writes may only append
+	InodeFlagNodump      = 0x00000040 // d: excluded from backups by dump(8)
+	InodeFlagNoatime     = 0x00000080 // A: do not update the access time
+	InodeFlagNoCompress  = 0x00000400 // m: do not compress file contents
+	InodeFlagDirsync     = 0x00010000 // D: synchronous directory updates
+	InodeFlagTopdir      = 0x00020000 // T: top of directory hierarchy
+	InodeFlagNoCOW       = 0x00800000 // C: no copy on write
+	InodeFlagProjInherit = 0x20000000 // P: inherit the project ID
+
+	// InodeFlagsUser contains all flags listed above.
+	InodeFlagsUser = InodeFlagCompress | InodeFlagSync | InodeFlagImmutable |
+		InodeFlagAppend | InodeFlagNodump | InodeFlagNoatime | InodeFlagNoCompress |
+		InodeFlagDirsync | InodeFlagTopdir | InodeFlagNoCOW | InodeFlagProjInherit
+)
@@ -0,0 +1,85 @@
+package fs
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// isInodeFlagsUnsupported returns true if err signals that the file system or
+// the file type does not support inode flags.
+func isInodeFlagsUnsupported(err error) bool {
+	return errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EINVAL)
+}
+
+func openForInodeFlags(path string) (int, error) {
+	fd, err := unix.Open(fixpath(path), unix.O_RDONLY|unix.O_NONBLOCK|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return fd, nil
+}
+
+// GetInodeFlags returns the inode flags of the regular file or directory at
+// path. If the file system does not support inode flags, zero is returned.
+func GetInodeFlags(path string) (uint32, error) {
+	fd, err := openForInodeFlags(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if isInodeFlagsUnsupported(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "FS_IOC_GETFLAGS")
+	}
+	return flags, nil
+}
+
+// SetInodeFlags changes the inode flags selected by mask of the regular file
+// or directory at path to flags, the other flags are kept. If the file system
+// does not support inode flags, nothing is changed.
+func SetInodeFlags(path string, flags, mask uint32) error {
+	fd, err := openForInodeFlags(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	current, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if isInodeFlagsUnsupported(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "FS_IOC_GETFLAGS")
+	}
+
+	updated := current&^mask | flags&mask
+	if updated == current {
+		return nil
+	}
+
+	err = unix.IoctlSetPointerInt(fd, unix.FS_IOC_SETFLAGS, int(updated))
+	if isInodeFlagsUnsupported(err) {
+		return nil
+	}
+	return errors.Wrap(err, "FS_IOC_SETFLAGS")
+}
+
+// BirthTime returns the creation time of the item at path, which is only
+// available on file systems supporting it and Linux 4.11 and newer.
+func BirthTime(path string) (time.Time, bool) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, fixpath(path), unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stx)
+	if err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestInodeFlags(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0600))
+
+	rtest.OK(t, SetInodeFlags(filename, InodeFlagNodump, InodeFlagNodump))
+	flags, err := GetInodeFlags(filename)
+	rtest.OK(t, err)
+	if flags&InodeFlagNodump == 0 {
+		t.Skip("file system does not support inode flags")
+	}
+
+	// flags outside of the mask are not changed
+	rtest.OK(t, SetInodeFlags(filename, 0, InodeFlagNoatime))
+	flags, err = GetInodeFlags(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, flags&InodeFlagNodump != 0, "nodump flag was removed")
+
+	rtest.OK(t, SetInodeFlags(filename, 0, InodeFlagNodump))
+	flags, err = GetInodeFlags(filename)
+	rtest.OK(t, err)
+	rtest.Assert(t, flags&InodeFlagNodump == 0, "nodump flag was not removed")
+}
+
+func TestBirthTime(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	start := time.Now().Add(-time.Second)
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0600))
+
+	btime, ok := BirthTime(filename)
+	if !ok {
+		t.Skip("file system does not support the birth time")
+	}
+	rtest.Assert(t, btime.After(start) && btime.Before(time.Now().Add(time.Second)),
+		"unexpected birth time %v", btime)
+}
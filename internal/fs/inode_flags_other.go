@@ -0,0 +1,25 @@
+// +build !linux
+
+package fs
+
+import "time"
+
+// GetInodeFlags returns the inode flags of the regular file or directory at
+// path. Inode flags are only supported on Linux, zero is returned on other
+// systems.
+func GetInodeFlags(path string) (uint32, error) {
+	return 0, nil
+}
+
+// SetInodeFlags changes the inode flags selected by mask of the regular file
+// or directory at path. Inode flags are only supported on Linux, on other
+// systems nothing is changed.
+func SetInodeFlags(path string, flags, mask uint32) error {
+	return nil
+}
+
+// BirthTime returns the creation time of the item at path, it is only
+// supported on Linux.
+func BirthTime(path string) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,320 @@
+// Package sftpfs implements a read-only file system which accesses the files
+// on a remote host via an sftp session, such that they can be saved by the
+// archiver without installing restic on the remote host.
+package sftpfs
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// FS is a read-only file system on the remote host of an sftp session. The
+// metadata of the files is returned as a *restic.Node by the Sys() method of
+// their FileInfo. The sftp protocol only transfers the size, the permissions,
+// the owner and the access and modification timestamps, the change timestamp
+// is set to the modification timestamp.
+type FS struct {
+	c  *sftp.Client
+	wd string
+}
+
+// statically ensure that FS implements fs.FS.
+var _ fs.FS = &FS{}
+
+// New returns a file system for the sftp session c. Relative paths are
+// interpreted relative to the working directory of the session, usually
+// the home directory of the user.
+func New(c *sftp.Client) (*FS, error) {
+	wd, err := c.Getwd()
+	if err != nil {
+		return nil, errors.Wrap(err, "Getwd")
+	}
+
+	return &FS{c: c, wd: wd}, nil
+}
+
+// VolumeName returns leading volume name, for the sftp file system it's
+// always the empty string.
+func (sfs *FS) VolumeName(path string) string {
+	return ""
+}
+
+// Open opens a file or directory for reading.
+func (sfs *FS) Open(name string) (fs.File, error) {
+	return sfs.OpenFile(name, fs.O_RDONLY, 0)
+}
+
+// OpenFile is the generalized open call; most users will use Open
+// or Create instead.  It opens the named file with specified flag
+// (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
+// methods on the returned File can be used for I/O.
+// If there is an error, it will be of type *PathError.
+func (sfs *FS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	if flag & ^(fs.O_RDONLY|fs.O_NOFOLLOW) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.Errorf("invalid combination of flags 0x%x", flag)}
+	}
+
+	// the sftp protocol cannot open directories, they are read with ReadDir
+	var fi os.FileInfo
+	var err error
+	if flag&fs.O_NOFOLLOW != 0 {
+		fi, err = sfs.Lstat(name)
+	} else {
+		fi, err = sfs.Stat(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return &dir{name: name, fi: fi, sfs: sfs}, nil
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("file is a symlink")}
+	}
+
+	f, err := sfs.c.Open(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &file{File: f, sfs: sfs, name: name}, nil
+}
+
+// Stat returns a FileInfo describing the named file, symbolic links are
+// resolved. If there is an error, it will be of type *PathError.
+func (sfs *FS) Stat(name string) (os.FileInfo, error) {
+	fi, err := sfs.c.Stat(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return sfs.fileInfo(name, fi)
+}
+
+// Lstat returns the FileInfo structure describing the named file.
+// If the file is a symbolic link, the returned FileInfo
+// describes the symbolic link.  Lstat makes no attempt to follow the link.
+// If there is an error, it will be of type *PathError.
+func (sfs *FS) Lstat(name string) (os.FileInfo, error) {
+	fi, err := sfs.c.Lstat(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return sfs.fileInfo(name, fi)
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls Clean on the result; in particular, all
+// empty strings are ignored.
+func (sfs *FS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Separator returns the OS and FS dependent separator for dirs/subdirs/files.
+func (sfs *FS) Separator() string {
+	return "/"
+}
+
+// IsAbs reports whether the path is absolute.
+func (sfs *FS) IsAbs(p string) bool {
+	return path.IsAbs(p)
+}
+
+// Abs returns an absolute representation of path, relative paths are joined
+// with the working directory of the sftp session.
+func (sfs *FS) Abs(p string) (string, error) {
+	if !path.IsAbs(p) {
+		p = path.Join(sfs.wd, p)
+	}
+	return path.Clean(p), nil
+}
+
+// Clean returns the cleaned path. For details, see filepath.Clean.
+func (sfs *FS) Clean(p string) string {
+	return path.Clean(p)
+}
+
+// Base returns the last element of p.
+func (sfs *FS) Base(p string) string {
+	return path.Base(p)
+}
+
+// Dir returns p without the last element.
+func (sfs *FS) Dir(p string) string {
+	return path.Dir(p)
+}
+
+// fileInfo returns a FileInfo for the item name, which contains the node
+// built from the FileInfo fi returned by the sftp client.
+func (sfs *FS) fileInfo(name string, fi os.FileInfo) (os.FileInfo, error) {
+	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	node := &restic.Node{
+		Name:    fi.Name(),
+		Mode:    fi.Mode() & mask,
+		ModTime: fi.ModTime(),
+	}
+	node.AccessTime = node.ModTime
+	node.ChangeTime = node.ModTime
+
+	if stat, ok := fi.Sys().(*sftp.FileStat); ok {
+		node.UID = stat.UID
+		node.GID = stat.GID
+		node.AccessTime = time.Unix(int64(stat.Atime), 0)
+	}
+
+	switch fi.Mode() & (os.ModeType | os.ModeCharDevice) {
+	case 0:
+		node.Type = "file"
+		node.Size = uint64(fi.Size())
+		node.Links = 1
+	case os.ModeDir:
+		node.Type = "dir"
+	case os.ModeSymlink:
+		node.Type = "symlink"
+		node.Links = 1
+		target, err := sfs.c.ReadLink(name)
+		if err != nil {
+			return nil, &os.PathError{Op: "readlink", Path: name, Err: err}
+		}
+		node.LinkTarget = target
+	case os.ModeDevice | os.ModeCharDevice:
+		// the device number is not transferred by the sftp protocol
+		node.Type = "chardev"
+		node.Links = 1
+	case os.ModeDevice:
+		node.Type = "dev"
+		node.Links = 1
+	case os.ModeNamedPipe:
+		node.Type = "fifo"
+	case os.ModeSocket:
+		node.Type = "socket"
+	default:
+		debug.Log("unknown type of %v: %v", name, fi.Mode())
+	}
+
+	return fileInfo{FileInfo: fi, node: node}, nil
+}
+
+// fileInfo wraps a FileInfo returned by the sftp client, Sys() returns the
+// node.
+type fileInfo struct {
+	os.FileInfo
+	node *restic.Node
+}
+
+func (fi fileInfo) Sys() interface{} { return fi.node }
+
+// file is an opened regular file.
+type file struct {
+	*sftp.File
+	sfs  *FS
+	name string
+}
+
+// statically ensure that file implements fs.File.
+var _ fs.File = &file{}
+
+func (f *file) Fd() uintptr {
+	return 0
+}
+
+func (f *file) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdirnames", Path: f.name, Err: errors.New("not a directory")}
+}
+
+func (f *file) Readdir(n int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+	return f.sfs.fileInfo(f.name, fi)
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+// dir is an opened directory, the entries are read when Readdir or
+// Readdirnames is called.
+type dir struct {
+	name string
+	fi   os.FileInfo
+	sfs  *FS
+}
+
+// statically ensure that dir implements fs.File.
+var _ fs.File = &dir{}
+
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Seek(int64, int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) Fd() uintptr {
+	return 0
+}
+
+func (d *dir) Readdirnames(n int) ([]string, error) {
+	if n > 0 {
+		return nil, errors.New("not implemented")
+	}
+
+	entries, err := d.sfs.c.ReadDir(d.name)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: d.name, Err: err}
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+	}
+	return names, nil
+}
+
+func (d *dir) Readdir(n int) ([]os.FileInfo, error) {
+	if n > 0 {
+		return nil, errors.New("not implemented")
+	}
+
+	entries, err := d.sfs.c.ReadDir(d.name)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: d.name, Err: err}
+	}
+
+	result := make([]os.FileInfo, 0, len(entries))
+	for _, fi := range entries {
+		fi, err := d.sfs.fileInfo(path.Join(d.name, fi.Name()), fi)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fi)
+	}
+	return result, nil
+}
+
+func (d *dir) Stat() (os.FileInfo, error) {
+	return d.fi, nil
+}
+
+func (d *dir) Name() string {
+	return d.name
+}
@@ -0,0 +1,123 @@
+package sftpfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// pipe connects the client and the server of an sftp session.
+type pipe struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newTestFS returns a file system for an sftp session to a server running
+// in the same process, which serves the local file system.
+func newTestFS(t testing.TB) *FS {
+	clientRd, serverWr := io.Pipe()
+	serverRd, clientWr := io.Pipe()
+
+	server, err := sftp.NewServer(pipe{serverRd, serverWr}, sftp.ReadOnly())
+	rtest.OK(t, err)
+	go func() {
+		_ = server.Serve()
+	}()
+
+	client, err := sftp.NewClientPipe(clientRd, clientWr)
+	rtest.OK(t, err)
+	t.Cleanup(func() {
+		// closing the server first terminates the receive loop of the client
+		_ = server.Close()
+		_ = client.Close()
+	})
+
+	sfs, err := New(client)
+	rtest.OK(t, err)
+	return sfs
+}
+
+func lstatNode(t testing.TB, sfs *FS, name string) *restic.Node {
+	fi, err := sfs.Lstat(name)
+	rtest.OK(t, err)
+	node, err := restic.NodeFromFileInfo(name, fi)
+	rtest.OK(t, err)
+	return node
+}
+
+func TestFS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sftp server does not support Windows paths")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	mtime := time.Unix(1600000000, 0)
+	rtest.OK(t, os.Mkdir(filepath.Join(tempdir, "dir"), 0750))
+	file := filepath.Join(tempdir, "dir", "file")
+	rtest.OK(t, ioutil.WriteFile(file, []byte("content of file"), 0640))
+	rtest.OK(t, os.Chtimes(file, mtime, mtime))
+	rtest.OK(t, os.Symlink("dir/file", filepath.Join(tempdir, "link")))
+
+	sfs := newTestFS(t)
+
+	abs, err := sfs.Abs("foo")
+	rtest.OK(t, err)
+	rtest.Assert(t, sfs.IsAbs(abs), "Abs returned relative path %v", abs)
+
+	f, err := sfs.OpenFile(tempdir, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	rtest.OK(t, err)
+	names, err := f.Readdirnames(-1)
+	rtest.OK(t, err)
+	sort.Strings(names)
+	rtest.Equals(t, []string{"dir", "link"}, names)
+	rtest.OK(t, f.Close())
+
+	dir := lstatNode(t, sfs, filepath.Join(tempdir, "dir"))
+	rtest.Equals(t, "dir", dir.Type)
+	rtest.Equals(t, os.ModeDir|0750, dir.Mode)
+
+	node := lstatNode(t, sfs, file)
+	rtest.Equals(t, "file", node.Type)
+	rtest.Equals(t, "file", node.Name)
+	rtest.Equals(t, os.FileMode(0640), node.Mode)
+	rtest.Equals(t, uint64(15), node.Size)
+	rtest.Equals(t, uint32(os.Getuid()), node.UID)
+	rtest.Equals(t, uint32(os.Getgid()), node.GID)
+	rtest.Assert(t, node.ModTime.Equal(mtime), "wrong mtime %v", node.ModTime)
+	rtest.Assert(t, node.ChangeTime.Equal(mtime), "wrong ctime %v", node.ChangeTime)
+
+	link := lstatNode(t, sfs, filepath.Join(tempdir, "link"))
+	rtest.Equals(t, "symlink", link.Type)
+	rtest.Equals(t, "dir/file", link.LinkTarget)
+
+	fi, err := sfs.Stat(filepath.Join(tempdir, "link"))
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.Mode().IsRegular(), "Stat did not follow the symlink")
+
+	f, err = sfs.OpenFile(file, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	rtest.OK(t, err)
+	buf, err := ioutil.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content of file", string(buf))
+	fi, err = f.Stat()
+	rtest.OK(t, err)
+	_, ok := fi.Sys().(*restic.Node)
+	rtest.Assert(t, ok, "Stat of opened file does not return a node")
+	rtest.OK(t, f.Close())
+
+	_, err = sfs.Lstat(filepath.Join(tempdir, "missing"))
+	rtest.Assert(t, os.IsNotExist(err), "Lstat of missing file returned wrong error %v", err)
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// NewSparseReader returns a reader for the file f with the file info fi. If
+// the file is sparse, its holes are located using SEEK_DATA and SEEK_HOLE and
+// returned as zeros without reading them from the file. f must be positioned
+// at the start of the file. If f implements io.ReaderAt, so does the returned
+// reader.
+func NewSparseReader(f File, fi os.FileInfo) io.Reader {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Blocks*512 >= st.Size {
+		// all blocks are allocated, the file cannot contain holes
+		return f
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		return &sparseReaderAt{sparseReader: sparseReader{f: f}, ra: ra}
+	}
+	return &sparseReader{f: f}
+}
+
+// sparseReader reads a file which contains holes.
+type sparseReader struct {
+	f   File
+	pos int64
+
+	// [pos, end) is either completely a hole or contains data
+	end  int64
+	hole bool
+
+	// plain is set when the file system does not support locating holes
+	plain bool
+}
+
+func (r *sparseReader) Read(p []byte) (int, error) {
+	if r.plain {
+		return r.f.Read(p)
+	}
+
+	if r.pos >= r.end {
+		err := r.nextRegion()
+		if err != nil {
+			return 0, err
+		}
+		if r.plain {
+			return r.f.Read(p)
+		}
+	}
+
+	if int64(len(p)) > r.end-r.pos {
+		p = p[:r.end-r.pos]
+	}
+
+	if !r.hole {
+		n, err := r.f.Read(p)
+		r.pos += int64(n)
+		return n, err
+	}
+
+	for i := range p {
+		p[i] = 0
+	}
+	r.pos += int64(len(p))
+	return len(p), nil
+}
+
+// nextRegion determines the extent of the hole or data region starting at
+// r.pos and positions the file accordingly.
+func (r *sparseReader) nextRegion() error {
+	data, err := r.f.Seek(r.pos, unix.SEEK_DATA)
+	if errors.Is(err, syscall.ENXIO) {
+		// there is no data after pos, the remaining file is a hole
+		size, err := r.f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if size <= r.pos {
+			return io.EOF
+		}
+		r.end, r.hole = size, true
+		return nil
+	}
+	if err != nil {
+		return r.fallback()
+	}
+
+	if data > r.pos {
+		r.end, r.hole = data, true
+		return nil
+	}
+
+	// the end of the file is always considered to be a hole
+	hole, err := r.f.Seek(r.pos, unix.SEEK_HOLE)
+	if err != nil {
+		return r.fallback()
+	}
+	r.end, r.hole = hole, false
+
+	_, err = r.f.Seek(r.pos, io.SeekStart)
+	return err
+}
+
+// fallback continues reading the file without skipping holes.
+func (r *sparseReader) fallback() error {
+	r.plain = true
+	_, err := r.f.Seek(r.pos, io.SeekStart)
+	return err
+}
+
+// sparseReaderAt additionally supports reading a sparse file at arbitrary
+// offsets, so that it can be read concurrently. ReadAt must not be mixed with
+// Read, as it changes the offset of the file.
+type sparseReaderAt struct {
+	sparseReader
+	ra io.ReaderAt
+}
+
+func (r *sparseReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+
+		data, err := r.f.Seek(pos, unix.SEEK_DATA)
+		if errors.Is(err, syscall.ENXIO) {
+			// there is no data after pos, the remaining file is a hole
+			size, err := r.f.Seek(0, io.SeekEnd)
+			if err != nil {
+				return n, err
+			}
+			if size <= pos {
+				return n, io.EOF
+			}
+			n += zero(p[n:], size-pos)
+			if n < len(p) {
+				return n, io.EOF
+			}
+			return n, nil
+		}
+		if err != nil {
+			// the file system does not support locating holes
+			m, err := r.ra.ReadAt(p[n:], pos)
+			return n + m, err
+		}
+
+		if data > pos {
+			n += zero(p[n:], data-pos)
+			continue
+		}
+
+		// the end of the file is always considered to be a hole
+		hole, err := r.f.Seek(pos, unix.SEEK_HOLE)
+		if err != nil {
+			m, err := r.ra.ReadAt(p[n:], pos)
+			return n + m, err
+		}
+
+		buf := p[n:]
+		if int64(len(buf)) > hole-pos {
+			buf = buf[:hole-pos]
+		}
+		m, err := r.ra.ReadAt(buf, pos)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// zero sets the first max bytes of p to zero and returns their number, which
+// is limited by the length of p.
+func zero(p []byte, max int64) int {
+	if int64(len(p)) > max {
+		p = p[:max]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p)
+}
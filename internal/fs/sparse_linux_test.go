@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSparseReader(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	const blockSize = 1 << 20
+	for i, test := range []struct {
+		size int64
+		data []int64 // offsets of the data blocks
+	}{
+		{size: 4 * blockSize, data: []int64{0, 2 * blockSize}},
+		{size: 4*blockSize + 117, data: []int64{blockSize, 4 * blockSize}},
+		{size: 3 * blockSize, data: nil},
+		{size: 2 * blockSize, data: []int64{blockSize + 5}},
+	} {
+		filename := filepath.Join(tempdir, "file")
+		f, err := os.Create(filename)
+		rtest.OK(t, err)
+		rtest.OK(t, f.Truncate(test.size))
+
+		want := make([]byte, test.size)
+		for _, offset := range test.data {
+			data := rtest.Random(i, 100)
+			copy(want[offset:], data)
+			_, err = f.WriteAt(data, offset)
+			rtest.OK(t, err)
+		}
+		rtest.OK(t, f.Close())
+
+		f, err = os.Open(filename)
+		rtest.OK(t, err)
+		fi, err := f.Stat()
+		rtest.OK(t, err)
+
+		got, err := ioutil.ReadAll(NewSparseReader(f, fi))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(want, got), "test %d: wrong content read from sparse file", i)
+
+		// read the file in pieces which do not match the regions, in
+		// reverse order
+		rd := NewSparseReader(f, fi)
+		if st := fi.Sys().(*syscall.Stat_t); st.Blocks*512 < st.Size {
+			_, ok := rd.(*sparseReaderAt)
+			rtest.Assert(t, ok, "test %d: sparse file is not read by a sparseReaderAt but %T", i, rd)
+		}
+		ra, ok := rd.(io.ReaderAt)
+		rtest.Assert(t, ok, "test %d: sparse reader does not implement io.ReaderAt", i)
+		got = make([]byte, test.size)
+		const pieceSize = blockSize/3 + 7
+		for off := (test.size - 1) / pieceSize * pieceSize; off >= 0; off -= pieceSize {
+			end := off + pieceSize
+			if end > test.size {
+				end = test.size
+			}
+			n, err := ra.ReadAt(got[off:end], off)
+			rtest.OK(t, err)
+			rtest.Equals(t, int(end-off), n)
+		}
+		rtest.Assert(t, bytes.Equal(want, got), "test %d: wrong content read from sparse file with ReadAt", i)
+
+		// reading beyond the end of the file returns io.EOF
+		n, err := ra.ReadAt(make([]byte, 10), test.size-5)
+		rtest.Equals(t, 5, n)
+		rtest.Equals(t, io.EOF, err)
+
+		rtest.OK(t, f.Close())
+	}
+}
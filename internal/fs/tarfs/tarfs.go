@@ -0,0 +1,662 @@
+// Package tarfs implements a read-only file system which presents the
+// content of a tar archive, so that it can be saved by the archiver without
+// unpacking it first.
+package tarfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// File is the tar archive read by the file system. The index of the archive
+// is built by reading it sequentially, the data of the files is read with
+// ReadAt when they are opened.
+type File interface {
+	io.Reader
+	io.Seeker
+	io.ReaderAt
+}
+
+// FS is a read-only file system which contains the entries of a tar archive
+// below the root directory. The metadata of the entries is returned as a
+// *restic.Node by the Sys() method of their FileInfo, such that a snapshot of
+// the file system contains the same metadata as a snapshot of the unpacked
+// archive.
+type FS struct {
+	f     File
+	root  *entry
+	inode uint64
+}
+
+// statically ensure that FS implements fs.FS.
+var _ fs.FS = &FS{}
+
+// entry is an item in the file system. Hard links to the same file share an
+// inode.
+type entry struct {
+	name     string
+	inode    *inode
+	children map[string]*entry
+}
+
+type inode struct {
+	node *restic.Node
+	// offset is the start of the tar header of the entry which contains the
+	// data of a regular file.
+	offset int64
+}
+
+// blockSize is the size of the blocks in a tar archive.
+const blockSize = 512
+
+// compressionMagic contains the magic numbers at the start of compressed
+// files, which are not supported as the content of the files is read at
+// random offsets.
+var compressionMagic = []struct {
+	name  string
+	magic []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"bzip2", []byte("BZh")},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"lz4", []byte{0x04, 0x22, 0x4d, 0x18}},
+}
+
+// checkCompression returns an error if the data at offset start of f is
+// compressed. It is only called if f cannot be read as a tar archive, as the
+// name of the first entry may start with the same bytes.
+func checkCompression(f File, start int64) error {
+	buf := make([]byte, 6)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return errors.Wrap(err, "ReadAt")
+	}
+
+	for _, c := range compressionMagic {
+		if bytes.HasPrefix(buf[:n], c.magic) {
+			return errors.Errorf("the archive is compressed with %v, which is not supported, decompress it first", c.name)
+		}
+	}
+	return nil
+}
+
+// New reads the index of the tar archive f, starting at the current offset.
+// The file system reads the content of the files from f, so it must not be
+// closed while the file system is in use. Compressed archives are rejected.
+func New(f File) (*FS, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, errors.Wrap(err, "Seek")
+	}
+
+	tfs := &FS{f: f}
+	tfs.root = tfs.newDir("/", time.Now())
+
+	tr := tar.NewReader(f)
+	offset := start
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if offset == start {
+				if cerr := checkCompression(f, start); cerr != nil {
+					return nil, cerr
+				}
+			}
+			return nil, errors.Wrap(err, "tar.Next")
+		}
+
+		dataOffset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, errors.Wrap(err, "Seek")
+		}
+
+		err = tfs.add(hdr, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		// compute the start of the next header, the data of sparse files
+		// needs to be read to find its end
+		end := dataOffset
+		if isSparse(hdr) {
+			_, err = io.Copy(ioutil.Discard, tr)
+			if err != nil {
+				return nil, errors.Wrap(err, "read sparse file")
+			}
+			end, err = f.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, errors.Wrap(err, "Seek")
+			}
+		} else if hasData(hdr) {
+			end += hdr.Size
+		}
+		offset = start + (end-start+blockSize-1)/blockSize*blockSize
+	}
+
+	return tfs, nil
+}
+
+// hasData returns true if the data following the header of hdr is part of
+// the entry, archive/tar ignores the size for all other types.
+func hasData(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		return false
+	}
+	return true
+}
+
+// isSparse returns true if hdr describes a sparse file, for which the size of
+// the data in the archive differs from the size of the file.
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+func (tfs *FS) newInode(node *restic.Node) *inode {
+	tfs.inode++
+	node.Inode = tfs.inode
+	return &inode{node: node}
+}
+
+// newDir returns a directory which is not contained in the archive, but is
+// needed as the parent of other entries.
+func (tfs *FS) newDir(name string, modTime time.Time) *entry {
+	node := &restic.Node{
+		Type:       "dir",
+		Mode:       os.ModeDir | 0755,
+		ModTime:    modTime,
+		AccessTime: modTime,
+		ChangeTime: modTime,
+		UID:        uint32(os.Getuid()),
+		GID:        uint32(os.Getgid()),
+	}
+
+	return &entry{
+		name:     path.Base(name),
+		inode:    tfs.newInode(node),
+		children: make(map[string]*entry),
+	}
+}
+
+// add adds the entry for hdr, which starts at offset in the archive.
+func (tfs *FS) add(hdr *tar.Header, offset int64) error {
+	name := path.Clean("/" + hdr.Name)
+
+	var ino *inode
+	switch hdr.Typeflag {
+	case tar.TypeXGlobalHeader:
+		return nil
+	case tar.TypeLink:
+		target, err := tfs.lookup(path.Clean("/"+hdr.Linkname), false)
+		if err != nil || target.inode.node.Type != "file" {
+			return errors.Errorf("hard link %v: target %v not found in archive", hdr.Name, hdr.Linkname)
+		}
+		ino = target.inode
+		ino.node.Links++
+	default:
+		node, err := nodeFromHeader(hdr)
+		if err != nil {
+			return errors.Wrap(err, hdr.Name)
+		}
+		if node == nil {
+			debug.Log("skipping entry %v with unsupported type %q", hdr.Name, hdr.Typeflag)
+			return nil
+		}
+		ino = tfs.newInode(node)
+		ino.offset = offset
+	}
+
+	if name == "/" {
+		if ino.node.Type == "dir" {
+			tfs.root.inode = ino
+		}
+		return nil
+	}
+
+	parent, err := tfs.mkdirAll(path.Dir(name), hdr.ModTime)
+	if err != nil {
+		return errors.Wrap(err, hdr.Name)
+	}
+
+	e := &entry{
+		name:  path.Base(name),
+		inode: ino,
+	}
+	if ino.node.Type == "dir" {
+		e.children = make(map[string]*entry)
+		// keep the content if the directory is contained several times
+		if prev, ok := parent.children[e.name]; ok && prev.children != nil {
+			e.children = prev.children
+		}
+	}
+	parent.children[e.name] = e
+
+	return nil
+}
+
+// mkdirAll returns the directory dir, missing directories are created with
+// the modification time modTime.
+func (tfs *FS) mkdirAll(dir string, modTime time.Time) (*entry, error) {
+	e := tfs.root
+	if dir == "/" {
+		return e, nil
+	}
+
+	for _, name := range strings.Split(dir[1:], "/") {
+		child, ok := e.children[name]
+		if !ok {
+			child = tfs.newDir(name, modTime)
+			e.children[name] = child
+		}
+		if child.children == nil {
+			return nil, errors.Errorf("%v is not a directory", child.name)
+		}
+		e = child
+	}
+
+	return e, nil
+}
+
+// nodeFromHeader returns the node for hdr, or nil if the type of the entry is
+// not supported.
+func nodeFromHeader(hdr *tar.Header) (*restic.Node, error) {
+	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	fi := hdr.FileInfo()
+
+	node := &restic.Node{
+		Mode:       fi.Mode() & mask,
+		ModTime:    hdr.ModTime,
+		AccessTime: hdr.AccessTime,
+		ChangeTime: hdr.ChangeTime,
+		UID:        uint32(hdr.Uid),
+		GID:        uint32(hdr.Gid),
+		User:       hdr.Uname,
+		Group:      hdr.Gname,
+		Links:      1,
+	}
+
+	// tar archives often only contain the modification time
+	if node.AccessTime.IsZero() {
+		node.AccessTime = node.ModTime
+	}
+	if node.ChangeTime.IsZero() {
+		node.ChangeTime = node.ModTime
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeCont, tar.TypeGNUSparse:
+		node.Type = "file"
+		node.Mode &^= os.ModeType
+		node.Size = uint64(hdr.Size)
+	case tar.TypeDir:
+		node.Type = "dir"
+		node.Links = 0
+	case tar.TypeSymlink:
+		node.Type = "symlink"
+		node.LinkTarget = hdr.Linkname
+	case tar.TypeChar:
+		node.Type = "chardev"
+		node.Device = mkdev(hdr.Devmajor, hdr.Devminor)
+	case tar.TypeBlock:
+		node.Type = "dev"
+		node.Device = mkdev(hdr.Devmajor, hdr.Devminor)
+	case tar.TypeFifo:
+		node.Type = "fifo"
+		node.Links = 0
+	default:
+		return nil, nil
+	}
+
+	attrs, err := extendedAttributes(hdr.PAXRecords)
+	if err != nil {
+		return nil, err
+	}
+	if node.Type != "symlink" {
+		node.ExtendedAttributes = attrs
+	}
+
+	return node, nil
+}
+
+// mkdev returns the device number for major and minor in the format used by
+// Linux.
+func mkdev(major, minor int64) uint64 {
+	ma, mi := uint64(major), uint64(minor)
+	return (mi & 0xff) | ((ma & 0xfff) << 8) | ((mi &^ 0xff) << 12) | ((ma &^ 0xfff) << 32)
+}
+
+// extendedAttributes returns the extended attributes and ACLs contained in the
+// PAX records, in the formats written by GNU tar, star and bsdtar.
+func extendedAttributes(records map[string]string) ([]restic.ExtendedAttribute, error) {
+	var attrs []restic.ExtendedAttribute
+	for key, value := range records {
+		switch {
+		case strings.HasPrefix(key, "SCHILY.xattr."):
+			attrs = append(attrs, restic.ExtendedAttribute{
+				Name:  strings.TrimPrefix(key, "SCHILY.xattr."),
+				Value: []byte(value),
+			})
+
+		case strings.HasPrefix(key, "LIBARCHIVE.xattr."):
+			name, err := url.QueryUnescape(strings.TrimPrefix(key, "LIBARCHIVE.xattr."))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid extended attribute %v", key)
+			}
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				data, err = base64.RawStdEncoding.DecodeString(value)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid extended attribute %v", key)
+			}
+			attrs = append(attrs, restic.ExtendedAttribute{Name: name, Value: data})
+
+		case key == "SCHILY.acl.access" || key == "SCHILY.acl.default":
+			a, err := restic.ParseACLText(value)
+			if err != nil {
+				return nil, err
+			}
+			name := restic.ACLAccessAttribute
+			if key == "SCHILY.acl.default" {
+				name = restic.ACLDefaultAttribute
+			}
+			attrs = append(attrs, restic.ExtendedAttribute{Name: name, Value: a.Encode()})
+		}
+	}
+
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].Name < attrs[j].Name
+	})
+
+	return attrs, nil
+}
+
+// lookup returns the entry for the absolute path name. If follow is true,
+// symbolic links are resolved, also in the parent directories.
+func (tfs *FS) lookup(name string, follow bool) (*entry, error) {
+	return tfs.resolve(name, follow, 0)
+}
+
+// maxSymlinks is the maximum number of symbolic links which are resolved
+// for a single path, like the limit of the Linux kernel.
+const maxSymlinks = 40
+
+func (tfs *FS) resolve(name string, follow bool, depth int) (*entry, error) {
+	if depth > maxSymlinks {
+		return nil, syscall.ELOOP
+	}
+
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return tfs.root, nil
+	}
+
+	parts := strings.Split(name[1:], "/")
+	e := tfs.root
+	for i, part := range parts {
+		if e.children == nil {
+			return nil, syscall.ENOTDIR
+		}
+
+		child, ok := e.children[part]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		last := i == len(parts)-1
+		if child.inode.node.Type == "symlink" && (!last || follow) {
+			dir := "/" + strings.Join(parts[:i], "/")
+			target := child.inode.node.LinkTarget
+			if !path.IsAbs(target) {
+				target = path.Join(dir, target)
+			}
+			rest := strings.Join(parts[i+1:], "/")
+
+			resolved, err := tfs.resolve(path.Join(target, rest), follow, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			return resolved, nil
+		}
+
+		e = child
+	}
+
+	return e, nil
+}
+
+// VolumeName returns leading volume name, for the tar file system it's always
+// the empty string.
+func (tfs *FS) VolumeName(path string) string {
+	return ""
+}
+
+// Open opens a file or directory for reading.
+func (tfs *FS) Open(name string) (fs.File, error) {
+	return tfs.open(name, true)
+}
+
+// OpenFile is the generalized open call; most users will use Open
+// or Create instead.  It opens the named file with specified flag
+// (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
+// methods on the returned File can be used for I/O.
+// If there is an error, it will be of type *PathError.
+func (tfs *FS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
+	if flag & ^(fs.O_RDONLY|fs.O_NOFOLLOW) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.Errorf("invalid combination of flags 0x%x", flag)}
+	}
+
+	return tfs.open(name, flag&fs.O_NOFOLLOW == 0)
+}
+
+func (tfs *FS) open(name string, follow bool) (fs.File, error) {
+	e, err := tfs.lookup(name, follow)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	f := &file{name: name, fi: e.fileInfo()}
+	switch {
+	case e.children != nil:
+		f.entries = e.sortedChildren()
+	case e.inode.node.Type == "file":
+		rd, err := tfs.openData(e.inode)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+		f.rd = rd
+	case e.inode.node.Type == "symlink":
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ELOOP}
+	}
+
+	return f, nil
+}
+
+// openData returns a reader for the data of the regular file ino. The header
+// of the entry is parsed again, as the data of sparse files is not stored
+// sequentially.
+func (tfs *FS) openData(ino *inode) (io.Reader, error) {
+	tr := tar.NewReader(io.NewSectionReader(tfs.f, ino.offset, 1<<62))
+	_, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "tar.Next")
+	}
+	return tr, nil
+}
+
+// Stat returns a FileInfo describing the named file, symbolic links are
+// resolved. If there is an error, it will be of type *PathError.
+func (tfs *FS) Stat(name string) (os.FileInfo, error) {
+	e, err := tfs.lookup(name, true)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return e.fileInfo(), nil
+}
+
+// Lstat returns the FileInfo structure describing the named file.
+// If the file is a symbolic link, the returned FileInfo
+// describes the symbolic link.  Lstat makes no attempt to follow the link.
+// If there is an error, it will be of type *PathError.
+func (tfs *FS) Lstat(name string) (os.FileInfo, error) {
+	e, err := tfs.lookup(name, false)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return e.fileInfo(), nil
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls Clean on the result; in particular, all
+// empty strings are ignored.
+func (tfs *FS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Separator returns the OS and FS dependent separator for dirs/subdirs/files.
+func (tfs *FS) Separator() string {
+	return "/"
+}
+
+// IsAbs reports whether the path is absolute.
+func (tfs *FS) IsAbs(p string) bool {
+	return path.IsAbs(p)
+}
+
+// Abs returns an absolute representation of path, relative paths are
+// interpreted relative to the root directory.
+func (tfs *FS) Abs(p string) (string, error) {
+	return path.Clean("/" + p), nil
+}
+
+// Clean returns the cleaned path. For details, see filepath.Clean.
+func (tfs *FS) Clean(p string) string {
+	return path.Clean(p)
+}
+
+// Base returns the last element of p.
+func (tfs *FS) Base(p string) string {
+	return path.Base(p)
+}
+
+// Dir returns p without the last element.
+func (tfs *FS) Dir(p string) string {
+	return path.Dir(p)
+}
+
+func (e *entry) fileInfo() fileInfo {
+	node := *e.inode.node
+	node.Name = e.name
+	return fileInfo{node: &node}
+}
+
+func (e *entry) sortedChildren() []os.FileInfo {
+	entries := make([]os.FileInfo, 0, len(e.children))
+	for _, child := range e.children {
+		entries = append(entries, child.fileInfo())
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// fileInfo implements os.FileInfo for an entry, Sys() returns the node.
+type fileInfo struct {
+	node *restic.Node
+}
+
+func (fi fileInfo) Name() string       { return fi.node.Name }
+func (fi fileInfo) Size() int64        { return int64(fi.node.Size) }
+func (fi fileInfo) Mode() os.FileMode  { return fi.node.Mode }
+func (fi fileInfo) ModTime() time.Time { return fi.node.ModTime }
+func (fi fileInfo) IsDir() bool        { return fi.node.Type == "dir" }
+func (fi fileInfo) Sys() interface{}   { return fi.node }
+
+// file is an opened file or directory.
+type file struct {
+	name    string
+	fi      fileInfo
+	rd      io.Reader
+	entries []os.FileInfo
+}
+
+// statically ensure that file implements fs.File.
+var _ fs.File = &file{}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.rd == nil {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	return f.rd.Read(p)
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+func (f *file) Fd() uintptr {
+	return 0
+}
+
+func (f *file) Readdirnames(n int) ([]string, error) {
+	entries, err := f.Readdir(n)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, fi := range entries {
+		names = append(names, fi.Name())
+	}
+	return names, nil
+}
+
+func (f *file) Readdir(n int) ([]os.FileInfo, error) {
+	if f.fi.node.Type != "dir" {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if n > 0 {
+		return nil, errors.New("not implemented")
+	}
+	return f.entries, nil
+}
+
+func (f *file) Seek(int64, int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *file) Stat() (os.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
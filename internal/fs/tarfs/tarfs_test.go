@@ -0,0 +1,191 @@
+package tarfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testTime = time.Unix(1600000000, 0).UTC()
+
+func writeTestArchive(t testing.TB, entries []*tar.Header, data map[string][]byte) *bytes.Reader {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range entries {
+		content := data[hdr.Name]
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(content))
+		}
+		if hdr.ModTime.IsZero() {
+			hdr.ModTime = testTime
+		}
+		rtest.OK(t, tw.WriteHeader(hdr))
+		_, err := tw.Write(content)
+		rtest.OK(t, err)
+	}
+	rtest.OK(t, tw.Close())
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func lstatNode(t testing.TB, tfs *FS, name string) *restic.Node {
+	fi, err := tfs.Lstat(name)
+	rtest.OK(t, err)
+	node, err := restic.NodeFromFileInfo(name, fi)
+	rtest.OK(t, err)
+	return node
+}
+
+func readFile(t testing.TB, tfs *FS, name string) string {
+	f, err := tfs.OpenFile(name, fs.O_RDONLY, 0)
+	rtest.OK(t, err)
+	buf, err := ioutil.ReadAll(f)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	return string(buf)
+}
+
+func TestFS(t *testing.T) {
+	longName := "dir/" + strings.Repeat("x", 150)
+	acl := "user::rw-\nuser:1000:r--\ngroup::r--\nmask::r--\nother::---\n"
+
+	rd := writeTestArchive(t, []*tar.Header{
+		{Name: "./", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0750, Uid: 1000, Gid: 100, Uname: "user", Gname: "users"},
+		{
+			Name: "dir/file", Typeflag: tar.TypeReg, Mode: 04755, Uid: 1000, Gid: 100, Uname: "user", Gname: "users",
+			AccessTime: testTime.Add(time.Hour),
+			ChangeTime: testTime.Add(2 * time.Hour),
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{
+				"SCHILY.xattr.user.foo": "bar",
+				"SCHILY.acl.access":     acl,
+			},
+		},
+		{Name: "dir/hardlink", Typeflag: tar.TypeLink, Linkname: "dir/file"},
+		{Name: longName, Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir/file", Mode: 0777},
+		{Name: "implicit/sub/file", Typeflag: tar.TypeReg, Mode: 0600},
+		{Name: "null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3, Mode: 0666},
+		{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644},
+	}, map[string][]byte{
+		"dir/file":          []byte("content of file"),
+		longName:            []byte("content of long file"),
+		"implicit/sub/file": []byte("content of implicit file"),
+	})
+
+	tfs, err := New(rd)
+	rtest.OK(t, err)
+
+	f, err := tfs.Open("/")
+	rtest.OK(t, err)
+	names, err := f.Readdirnames(-1)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"dir", "fifo", "implicit", "link", "null"}, names)
+
+	root := lstatNode(t, tfs, "/")
+	rtest.Equals(t, os.ModeDir|0700, root.Mode)
+
+	dir := lstatNode(t, tfs, "/dir")
+	rtest.Equals(t, "dir", dir.Type)
+	rtest.Equals(t, os.ModeDir|0750, dir.Mode)
+	rtest.Equals(t, "user", dir.User)
+	rtest.Equals(t, uint32(100), dir.GID)
+
+	file := lstatNode(t, tfs, "/dir/file")
+	rtest.Equals(t, "file", file.Type)
+	rtest.Equals(t, "file", file.Name)
+	rtest.Equals(t, os.ModeSetuid|0755, file.Mode)
+	rtest.Equals(t, uint64(15), file.Size)
+	rtest.Equals(t, uint64(2), file.Links)
+	rtest.Equals(t, uint32(1000), file.UID)
+	rtest.Assert(t, file.ModTime.Equal(testTime), "wrong mtime %v", file.ModTime)
+	rtest.Assert(t, file.AccessTime.Equal(testTime.Add(time.Hour)), "wrong atime %v", file.AccessTime)
+	rtest.Assert(t, file.ChangeTime.Equal(testTime.Add(2*time.Hour)), "wrong ctime %v", file.ChangeTime)
+	rtest.Equals(t, []byte("bar"), file.GetExtendedAttribute("user.foo"))
+	access, _ := file.ACLs()
+	rtest.Assert(t, access != nil, "ACL is missing")
+	rtest.Equals(t, acl, access.String())
+	rtest.Equals(t, "content of file", readFile(t, tfs, "/dir/file"))
+
+	hardlink := lstatNode(t, tfs, "/dir/hardlink")
+	rtest.Equals(t, file.Inode, hardlink.Inode)
+	rtest.Equals(t, uint64(2), hardlink.Links)
+	rtest.Equals(t, "content of file", readFile(t, tfs, "/dir/hardlink"))
+
+	rtest.Equals(t, "content of long file", readFile(t, tfs, "/"+longName))
+	rtest.Equals(t, "content of implicit file", readFile(t, tfs, "/implicit/sub/file"))
+
+	implicit := lstatNode(t, tfs, "/implicit/sub")
+	rtest.Equals(t, "dir", implicit.Type)
+	rtest.Equals(t, os.ModeDir|0755, implicit.Mode)
+
+	link := lstatNode(t, tfs, "/link")
+	rtest.Equals(t, "symlink", link.Type)
+	rtest.Equals(t, "dir/file", link.LinkTarget)
+	fi, err := tfs.Stat("/link")
+	rtest.OK(t, err)
+	rtest.Equals(t, "file", fi.Name())
+	_, err = tfs.OpenFile("/link", fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	rtest.Assert(t, err != nil, "opening a symlink with O_NOFOLLOW did not fail")
+
+	null := lstatNode(t, tfs, "/null")
+	rtest.Equals(t, "chardev", null.Type)
+	rtest.Equals(t, uint64(0x103), null.Device)
+
+	fifo := lstatNode(t, tfs, "/fifo")
+	rtest.Equals(t, "fifo", fifo.Type)
+
+	_, err = tfs.Lstat("/missing")
+	rtest.Assert(t, os.IsNotExist(err), "Lstat of missing file returned wrong error %v", err)
+	_, err = tfs.Lstat("/dir/file/foo")
+	rtest.Assert(t, err != nil, "Lstat below a file did not fail")
+}
+
+func TestFSInvalidHardlink(t *testing.T) {
+	rd := writeTestArchive(t, []*tar.Header{
+		{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "missing"},
+	}, nil)
+
+	_, err := New(rd)
+	rtest.Assert(t, err != nil, "hard link to missing file was accepted")
+}
+
+func TestFSSymlinkLoop(t *testing.T) {
+	rd := writeTestArchive(t, []*tar.Header{
+		{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "b"},
+		{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "a"},
+	}, nil)
+
+	tfs, err := New(rd)
+	rtest.OK(t, err)
+
+	_, err = tfs.Stat("/a")
+	rtest.Assert(t, err != nil, "Stat of symlink loop did not fail")
+	_, err = tfs.Lstat("/a")
+	rtest.OK(t, err)
+}
+
+func TestFSCompressed(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	gzw := gzip.NewWriter(buf)
+	_, err := io.Copy(gzw, writeTestArchive(t, []*tar.Header{
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string][]byte{"file": []byte("foobar")}))
+	rtest.OK(t, err)
+	rtest.OK(t, gzw.Close())
+
+	_, err = New(bytes.NewReader(buf.Bytes()))
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "gzip"),
+		"expected an error for a gzip compressed archive, got %v", err)
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestUpgradeRepoV2(t *testing.T) {
+	repo, cleanup := repository.TestRepositoryWithVersion(t, 1)
+	defer cleanup()
+
+	if repo.Config().Version != 1 {
+		t.Fatal("test repo has wrong version")
+	}
+
+	m := &UpgradeRepoV2{}
+
+	ok, err := m.Check(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "migration check returned false")
+
+	err = m.Apply(context.Background(), repo)
+	rtest.OK(t, err)
+
+	cfg, err := restic.LoadConfig(context.Background(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(2), cfg.Version)
+	rtest.Equals(t, repo.Config().ID, cfg.ID)
+	rtest.Equals(t, repo.Config().ChunkerPolynomial, cfg.ChunkerPolynomial)
+}
@@ -13,7 +13,7 @@ import (
 
 func TestParseHeaderEntry(t *testing.T) {
 	h := headerEntry{
-		Type:   0, // Blob.
+		Type:   0, // Blob
 		Length: 100,
 	}
 	for i := range h.ID {
@@ -23,25 +23,61 @@ func TestParseHeaderEntry(t *testing.T) {
 	buf := new(bytes.Buffer)
 	_ = binary.Write(buf, binary.LittleEndian, &h)
 
-	b, err := parseHeaderEntry(buf.Bytes())
+	b, size, err := parseHeaderEntry(buf.Bytes())
 	rtest.OK(t, err)
 	rtest.Equals(t, restic.DataBlob, b.Type)
+	rtest.Equals(t, plainEntrySize, size)
 	t.Logf("%v %v", h.ID, b.ID)
-	rtest.Assert(t, bytes.Equal(h.ID[:], b.ID[:]), "id mismatch")
+	rtest.Equals(t, h.ID[:], b.ID[:])
 	rtest.Equals(t, uint(h.Length), b.Length)
+	rtest.Equals(t, uint(0), b.UncompressedLength)
+
+	c := compressedHeaderEntry{
+		Type:               2, // compressed Blob
+		Length:             100,
+		UncompressedLength: 200,
+	}
+	for i := range c.ID {
+		c.ID[i] = byte(i)
+	}
+
+	buf = new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, &c)
+
+	b, size, err = parseHeaderEntry(buf.Bytes())
+	rtest.OK(t, err)
+	rtest.Equals(t, restic.DataBlob, b.Type)
+	rtest.Equals(t, entrySize, size)
+	t.Logf("%v %v", c.ID, b.ID)
+	rtest.Equals(t, c.ID[:], b.ID[:])
+	rtest.Equals(t, uint(c.Length), b.Length)
+	rtest.Equals(t, uint(c.UncompressedLength), b.UncompressedLength)
+
+	_, _, err = parseHeaderEntry(buf.Bytes()[:plainEntrySize])
+	rtest.Assert(t, err != nil, "no error for short compressed entry")
+}
+
+func TestParseHeaderEntryErrors(t *testing.T) {
+	h := headerEntry{
+		Type:   0, // Blob
+		Length: 100,
+	}
+	for i := range h.ID {
+		h.ID[i] = byte(i)
+	}
 
 	h.Type = 0xae
-	buf.Reset()
+	buf := new(bytes.Buffer)
 	_ = binary.Write(buf, binary.LittleEndian, &h)
 
-	b, err = parseHeaderEntry(buf.Bytes())
+	_, _, err := parseHeaderEntry(buf.Bytes())
 	rtest.Assert(t, err != nil, "no error for invalid type")
 
 	h.Type = 0
 	buf.Reset()
 	_ = binary.Write(buf, binary.LittleEndian, &h)
 
-	b, err = parseHeaderEntry(buf.Bytes()[:EntrySize-1])
+	_, _, err = parseHeaderEntry(buf.Bytes()[:plainEntrySize-1])
 	rtest.Assert(t, err != nil, "no error for short input")
 }
 
@@ -58,7 +94,7 @@ func (rd *countingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
 func TestReadHeaderEagerLoad(t *testing.T) {
 
 	testReadHeader := func(dataSize, entryCount, expectedReadInvocationCount int) {
-		expectedHeader := rtest.Random(0, entryCount*int(EntrySize)+crypto.Extension)
+		expectedHeader := rtest.Random(0, entryCount*int(entrySize)+crypto.Extension)
 
 		buf := &bytes.Buffer{}
 		buf.Write(rtest.Random(0, dataSize))                                             // pack blobs data
@@ -83,8 +119,8 @@ func TestReadHeaderEagerLoad(t *testing.T) {
 	testReadHeader(100, eagerEntries+1, 2)
 
 	// file size == eager header load size
-	eagerLoadSize := int((eagerEntries * EntrySize) + crypto.Extension)
-	headerSize := int(1*EntrySize) + crypto.Extension
+	eagerLoadSize := int((eagerEntries * entrySize) + crypto.Extension)
+	headerSize := int(1*entrySize) + crypto.Extension
 	dataSize := eagerLoadSize - headerSize - binary.Size(uint32(0))
 	testReadHeader(dataSize-1, 1, 1)
 	testReadHeader(dataSize, 1, 1)
@@ -96,8 +132,9 @@ func TestReadHeaderEagerLoad(t *testing.T) {
 
 func TestReadRecords(t *testing.T) {
 	testReadRecords := func(dataSize, entryCount, totalRecords int) {
-		totalHeader := rtest.Random(0, totalRecords*int(EntrySize)+crypto.Extension)
-		off := len(totalHeader) - (entryCount*int(EntrySize) + crypto.Extension)
+		totalHeader := rtest.Random(0, totalRecords*int(entrySize)+crypto.Extension)
+		bufSize := entryCount*int(entrySize) + crypto.Extension + headerLengthSize
+		off := len(totalHeader) - (entryCount*int(entrySize) + crypto.Extension)
 		if off < 0 {
 			off = 0
 		}
@@ -110,10 +147,10 @@ func TestReadRecords(t *testing.T) {
 
 		rd := bytes.NewReader(buf.Bytes())
 
-		header, count, err := readRecords(rd, int64(rd.Len()), entryCount)
+		header, hlen, err := readRecords(rd, int64(rd.Len()), bufSize)
 		rtest.OK(t, err)
 		rtest.Equals(t, expectedHeader, header)
-		rtest.Equals(t, totalRecords, count)
+		rtest.Equals(t, len(totalHeader), hlen)
 	}
 
 	// basic
@@ -127,8 +164,8 @@ func TestReadRecords(t *testing.T) {
 	testReadRecords(100, eagerEntries, eagerEntries+1)
 
 	// file size == eager header load size
-	eagerLoadSize := int((eagerEntries * EntrySize) + crypto.Extension)
-	headerSize := int(1*EntrySize) + crypto.Extension
+	eagerLoadSize := int((eagerEntries * entrySize) + crypto.Extension)
+	headerSize := int(1*entrySize) + crypto.Extension
 	dataSize := eagerLoadSize - headerSize - binary.Size(uint32(0))
 	testReadRecords(dataSize-1, 1, 1)
 	testReadRecords(dataSize, 1, 1)
@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/binary"
 	"encoding/json"
 	"io"
 	"testing"
@@ -20,26 +19,32 @@ import (
 var testLens = []int{23, 31650, 25860, 10928, 13769, 19862, 5211, 127, 13690, 30231}
 
 type Buf struct {
-	data []byte
-	id   restic.ID
+	data               []byte
+	id                 restic.ID
+	uncompressedLength int
 }
 
-func newPack(t testing.TB, k *crypto.Key, lengths []int) ([]Buf, []byte, uint) {
+func newPack(t testing.TB, k *crypto.Key, lengths []int, compressed bool) ([]Buf, []byte, uint) {
 	bufs := []Buf{}
 
-	for _, l := range lengths {
+	for i, l := range lengths {
 		b := make([]byte, l)
 		_, err := io.ReadFull(rand.Reader, b)
 		rtest.OK(t, err)
 		h := sha256.Sum256(b)
-		bufs = append(bufs, Buf{data: b, id: h})
+		buf := Buf{data: b, id: h}
+		// mark every other blob as compressed, the packer doesn't look at the data
+		if compressed && i%2 == 0 {
+			buf.uncompressedLength = 2 * l
+		}
+		bufs = append(bufs, buf)
 	}
 
 	// pack blobs
 	var buf bytes.Buffer
 	p := pack.NewPacker(k, &buf)
 	for _, b := range bufs {
-		_, err := p.Add(restic.TreeBlob, b.id, b.data)
+		_, err := p.Add(restic.TreeBlob, b.id, b.data, b.uncompressedLength)
 		rtest.OK(t, err)
 	}
 
@@ -51,11 +56,13 @@ func newPack(t testing.TB, k *crypto.Key, lengths []int) ([]Buf, []byte, uint) {
 
 func verifyBlobs(t testing.TB, bufs []Buf, k *crypto.Key, rd io.ReaderAt, packSize uint) {
 	written := 0
+	blobs := make([]restic.Blob, 0, len(bufs))
 	for _, buf := range bufs {
 		written += len(buf.data)
+		blobs = append(blobs, restic.Blob{Length: uint(len(buf.data)), UncompressedLength: uint(buf.uncompressedLength)})
 	}
 	// header length + header + header crypto
-	headerSize := binary.Size(uint32(0)) + restic.CiphertextLength(len(bufs)*int(pack.EntrySize))
+	headerSize := pack.CalculateHeaderSize(blobs)
 	written += headerSize
 
 	// check length
@@ -71,6 +78,7 @@ func verifyBlobs(t testing.TB, bufs []Buf, k *crypto.Key, rd io.ReaderAt, packSi
 	for i, b := range bufs {
 		e := entries[i]
 		rtest.Equals(t, b.id, e.ID)
+		rtest.Equals(t, uint(b.uncompressedLength), e.UncompressedLength)
 
 		if len(buf) < int(e.Length) {
 			buf = make([]byte, int(e.Length))
@@ -89,9 +97,11 @@ func TestCreatePack(t *testing.T) {
 	// create random keys
 	k := crypto.NewRandomKey()
 
-	bufs, packData, packSize := newPack(t, k, testLens)
-	rtest.Equals(t, uint(len(packData)), packSize)
-	verifyBlobs(t, bufs, k, bytes.NewReader(packData), packSize)
+	for _, compressed := range []bool{false, true} {
+		bufs, packData, packSize := newPack(t, k, testLens, compressed)
+		rtest.Equals(t, uint(len(packData)), packSize)
+		verifyBlobs(t, bufs, k, bytes.NewReader(packData), packSize)
+	}
 }
 
 var blobTypeJSON = []struct {
@@ -121,7 +131,7 @@ func TestUnpackReadSeeker(t *testing.T) {
 	// create random keys
 	k := crypto.NewRandomKey()
 
-	bufs, packData, packSize := newPack(t, k, testLens)
+	bufs, packData, packSize := newPack(t, k, testLens, true)
 
 	b := mem.New()
 	id := restic.Hash(packData)
@@ -134,7 +144,7 @@ func TestUnpackReadSeeker(t *testing.T) {
 func TestShortPack(t *testing.T) {
 	k := crypto.NewRandomKey()
 
-	bufs, packData, packSize := newPack(t, k, []int{23})
+	bufs, packData, packSize := newPack(t, k, []int{23}, false)
 
 	b := mem.New()
 	id := restic.Hash(packData)
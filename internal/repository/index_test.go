@@ -188,7 +188,8 @@ var docExample = []byte(`
 		  "id": "d3dc577b4ffd38cc4b32122cabf8655a0223ed22edfd93b353dc0c3f2b0fdf66",
 		  "type": "data",
 		  "offset": 150,
-		  "length": 123
+		  "length": 123,
+		  "uncompressed_length": 234
 		}
 	  ]
 	}
@@ -222,22 +223,23 @@ var docOldExample = []byte(`
 `)
 
 var exampleTests = []struct {
-	id, packID     restic.ID
-	tpe            restic.BlobType
-	offset, length uint
+	id, packID         restic.ID
+	tpe                restic.BlobType
+	offset, length     uint
+	uncompressedLength uint
 }{
 	{
 		restic.TestParseID("3ec79977ef0cf5de7b08cd12b874cd0f62bbaf7f07f3497a5b1bbcc8cb39b1ce"),
 		restic.TestParseID("73d04e6125cf3c28a299cc2f3cca3b78ceac396e4fcf9575e34536b26782413c"),
-		restic.DataBlob, 0, 25,
+		restic.DataBlob, 0, 25, 0,
 	}, {
 		restic.TestParseID("9ccb846e60d90d4eb915848add7aa7ea1e4bbabfc60e573db9f7bfb2789afbae"),
 		restic.TestParseID("73d04e6125cf3c28a299cc2f3cca3b78ceac396e4fcf9575e34536b26782413c"),
-		restic.TreeBlob, 38, 100,
+		restic.TreeBlob, 38, 100, 0,
 	}, {
 		restic.TestParseID("d3dc577b4ffd38cc4b32122cabf8655a0223ed22edfd93b353dc0c3f2b0fdf66"),
 		restic.TestParseID("73d04e6125cf3c28a299cc2f3cca3b78ceac396e4fcf9575e34536b26782413c"),
-		restic.DataBlob, 150, 123,
+		restic.DataBlob, 150, 123, 234,
 	},
 }
 
@@ -273,6 +275,7 @@ func TestIndexUnserialize(t *testing.T) {
 		rtest.Equals(t, test.tpe, blob.Type)
 		rtest.Equals(t, test.offset, blob.Offset)
 		rtest.Equals(t, test.length, blob.Length)
+		rtest.Equals(t, test.uncompressedLength, blob.UncompressedLength)
 	}
 
 	rtest.Equals(t, oldIdx, idx.Supersedes())
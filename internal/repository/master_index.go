@@ -80,6 +80,19 @@ func (mi *MasterIndex) addPending(bh restic.BlobHandle) bool {
 	return true
 }
 
+// Pending returns a copy of the set of pending blobs, which have been saved
+// but are not yet contained in a pack file stored in the backend.
+func (mi *MasterIndex) Pending() restic.BlobSet {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	pending := restic.NewBlobSet()
+	for bh := range mi.pendingBlobs {
+		pending.Insert(bh)
+	}
+	return pending
+}
+
 // Has queries all known Indexes for the ID and returns the first match.
 // Also returns true if the ID is pending.
 func (mi *MasterIndex) Has(bh restic.BlobHandle) bool {
@@ -134,7 +147,7 @@ func (mi *MasterIndex) PackSize(ctx context.Context, onlyHdr bool) map[restic.ID
 		if !onlyHdr {
 			size += int64(blob.Length)
 		}
-		packSize[blob.PackID] = size + int64(pack.EntrySize)
+		packSize[blob.PackID] = size + int64(pack.CalculateEntrySize(blob.Blob))
 	}
 
 	return packSize
@@ -133,6 +133,11 @@ func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, kee
 					return err
 				}
 
+				plaintext, err = DecompressBlob(entry, plaintext)
+				if err != nil {
+					return err
+				}
+
 				id := restic.Hash(plaintext)
 				if !id.Equal(entry.ID) {
 					debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
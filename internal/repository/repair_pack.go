@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SalvagedBlob is a blob which was recovered from a damaged pack file.
+type SalvagedBlob struct {
+	restic.BlobHandle
+	Plaintext []byte
+}
+
+// SalvagePack recovers all blobs which can still be read from the damaged
+// pack file in data. The blobs listed in the pack header, if it is readable,
+// and the blobs in knownBlobs, e.g. the index entries for the pack, are
+// checked first. Afterwards ciphertexts which can be authenticated using the
+// repository key are searched for at the start of the pack file, at the offsets
+// of the listed blobs and directly after each blob, so that blobs following a
+// damaged blob are still found when their location is unknown. Only blobs
+// whose plaintext matches their ID are returned.
+func (r *Repository) SalvagePack(ctx context.Context, data []byte, knownBlobs []restic.Blob) ([]SalvagedBlob, error) {
+	blobs := append([]restic.Blob{}, knownBlobs...)
+	blobsEnd := len(data)
+
+	entries, hdrSize, err := pack.List(r.key, bytes.NewReader(data), int64(len(data)))
+	if err == nil {
+		blobs = append(blobs, entries...)
+		blobsEnd = len(data) - int(hdrSize)
+	} else {
+		debug.Log("pack header is unreadable: %v", err)
+		// the header may be damaged while its length is still intact
+		if len(data) >= pack.HeaderSize {
+			hlen := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+			if hlen >= 0 && hlen+4 <= len(data) {
+				blobsEnd = len(data) - hlen - 4
+			}
+		}
+	}
+
+	sort.SliceStable(blobs, func(i, j int) bool {
+		return blobs[i].Offset < blobs[j].Offset
+	})
+
+	var salvaged []SalvagedBlob
+	// scanned contains the offsets which need not be scanned, candidates
+	// the offsets at which a ciphertext may start
+	scanned := make(map[int]struct{})
+	candidates := []int{0}
+	for _, blob := range blobs {
+		start := int(blob.Offset)
+		end := start + int(blob.Length)
+		if end > blobsEnd {
+			continue
+		}
+		candidates = append(candidates, start, end)
+
+		plaintext, err := r.salvageBlob(blob, data[start:end])
+		if err != nil {
+			debug.Log("blob %v at offset %v is damaged: %v", blob.ID, start, err)
+			continue
+		}
+		salvaged = append(salvaged, SalvagedBlob{BlobHandle: blob.BlobHandle, Plaintext: plaintext})
+		scanned[start] = struct{}{}
+	}
+
+	sort.Ints(candidates)
+	for _, pos := range candidates {
+		found, err := r.scanForBlobs(ctx, data[:blobsEnd], pos, scanned)
+		if err != nil {
+			return nil, err
+		}
+		salvaged = append(salvaged, found...)
+	}
+
+	// remove duplicates
+	seen := restic.NewBlobSet()
+	result := salvaged[:0]
+	for _, blob := range salvaged {
+		if seen.Has(blob.BlobHandle) {
+			continue
+		}
+		seen.Insert(blob.BlobHandle)
+		result = append(result, blob)
+	}
+
+	return result, nil
+}
+
+// salvageBlob decrypts and decompresses the blob stored in buf and checks
+// that the plaintext matches the blob ID.
+func (r *Repository) salvageBlob(blob restic.Blob, buf []byte) ([]byte, error) {
+	if len(buf) < r.key.NonceSize()+r.key.Overhead() {
+		return nil, errors.New("blob is too short")
+	}
+
+	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
+	plaintext, err := r.key.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err = DecompressBlob(blob, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	if !restic.Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.New("hash does not match id")
+	}
+	return plaintext, nil
+}
+
+// scanForBlobs searches buf for a sequence of authenticated ciphertexts,
+// starting at offset pos. Each ciphertext is expected to directly follow the
+// previous one, the search stops at the first offset at which no ciphertext is
+// found or which is contained in scanned. All offsets searched are added to
+// scanned.
+func (r *Repository) scanForBlobs(ctx context.Context, buf []byte, pos int, scanned map[int]struct{}) ([]SalvagedBlob, error) {
+	var found []SalvagedBlob
+	for pos+r.key.NonceSize()+r.key.Overhead() <= len(buf) {
+		if _, ok := scanned[pos]; ok {
+			break
+		}
+		scanned[pos] = struct{}{}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		n, ok := r.key.FindCiphertext(buf[pos:])
+		if !ok {
+			break
+		}
+
+		nonce, ciphertext := buf[pos:pos+r.key.NonceSize()], buf[pos+r.key.NonceSize():pos+n]
+		plaintext, err := r.key.Open(nil, nonce, ciphertext, nil)
+		if err == nil {
+			blob, ok := r.identifyBlob(plaintext)
+			if ok {
+				debug.Log("found blob %v at offset %v by scanning", blob, pos)
+				found = append(found, blob)
+			} else {
+				debug.Log("ignoring unknown data at offset %v", pos)
+			}
+		}
+		pos += n
+	}
+
+	return found, nil
+}
+
+// identifyBlob determines ID and type of a decrypted blob for which no
+// metadata is available. Only blobs known to the index are accepted, as the
+// ID of other data cannot be verified. This also excludes the encrypted pack
+// header, which is found when the header length is damaged.
+func (r *Repository) identifyBlob(plaintext []byte) (SalvagedBlob, bool) {
+	candidates := [][]byte{plaintext}
+	if r.compressionEnabled() {
+		decompressed, err := getZstdDecoder().DecodeAll(plaintext, nil)
+		if err == nil {
+			candidates = [][]byte{decompressed, plaintext}
+		}
+	}
+
+	for _, data := range candidates {
+		id := restic.Hash(data)
+		for _, t := range []restic.BlobType{restic.DataBlob, restic.TreeBlob} {
+			h := restic.BlobHandle{ID: id, Type: t}
+			if r.Index().Has(h) {
+				return SalvagedBlob{BlobHandle: h, Plaintext: data}, true
+			}
+		}
+	}
+
+	return SalvagedBlob{}, false
+}
@@ -0,0 +1,122 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// createSalvageTestPack saves a few blobs into a single pack file and
+// returns the raw pack file together with the blobs contained in it.
+func createSalvageTestPack(t *testing.T, repo *repository.Repository) (restic.ID, []byte, map[restic.BlobHandle][]byte) {
+	ctx := context.TODO()
+	blobs := make(map[restic.BlobHandle][]byte)
+	for i, size := range []int{23, 1000, 5000, 20000} {
+		data := rtest.Random(i, size)
+		id, _, err := repo.SaveBlob(ctx, restic.DataBlob, data, restic.ID{}, false)
+		rtest.OK(t, err)
+		blobs[restic.BlobHandle{ID: id, Type: restic.DataBlob}] = data
+	}
+	rtest.OK(t, repo.Flush(ctx))
+
+	var packID restic.ID
+	rtest.OK(t, repo.List(ctx, restic.PackFile, func(id restic.ID, size int64) error {
+		packID = id
+		return nil
+	}))
+
+	var buf []byte
+	h := restic.Handle{Type: restic.PackFile, Name: packID.String()}
+	rtest.OK(t, repo.Backend().Load(ctx, h, 0, 0, func(rd io.Reader) (err error) {
+		buf, err = ioutil.ReadAll(rd)
+		return err
+	}))
+
+	return packID, buf, blobs
+}
+
+func checkSalvagedBlobs(t *testing.T, salvaged []repository.SalvagedBlob, want map[restic.BlobHandle][]byte) {
+	rtest.Equals(t, len(want), len(salvaged))
+	for _, blob := range salvaged {
+		data, ok := want[blob.BlobHandle]
+		rtest.Assert(t, ok, "unexpected blob %v salvaged", blob.BlobHandle)
+		rtest.Equals(t, data, blob.Plaintext)
+	}
+}
+
+func testSalvagePack(t *testing.T, version uint) {
+	r, cleanup := repository.TestRepositoryWithVersion(t, version)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	packID, buf, blobs := createSalvageTestPack(t, repo)
+	var indexBlobs []restic.Blob
+	for h := range blobs {
+		for _, pb := range repo.Index().Lookup(h) {
+			rtest.Assert(t, pb.PackID.Equal(packID), "blob %v stored in unexpected pack %v", h, pb.PackID)
+			indexBlobs = append(indexBlobs, pb.Blob)
+		}
+	}
+
+	// undamaged pack
+	salvaged, err := repo.SalvagePack(context.TODO(), buf, nil)
+	rtest.OK(t, err)
+	checkSalvagedBlobs(t, salvaged, blobs)
+
+	// damaged header, the blobs are found by scanning
+	damaged := append([]byte{}, buf...)
+	damaged[len(damaged)-10] ^= 0x01
+	salvaged, err = repo.SalvagePack(context.TODO(), damaged, nil)
+	rtest.OK(t, err)
+	checkSalvagedBlobs(t, salvaged, blobs)
+
+	// damaged header length followed by a large damaged region, the blobs are
+	// found by scanning, the pack header must not be salvaged as a blob
+	damaged = append(append([]byte{}, buf...), rtest.Random(5, 4*1024*1024)...)
+	damaged[len(damaged)-1] = 0xff
+	salvaged, err = repo.SalvagePack(context.TODO(), damaged, nil)
+	rtest.OK(t, err)
+	checkSalvagedBlobs(t, salvaged, blobs)
+
+	// damaged blob, all other blobs must be recovered
+	damaged = append([]byte{}, buf...)
+	sort.Slice(indexBlobs, func(i, j int) bool {
+		return indexBlobs[i].Offset < indexBlobs[j].Offset
+	})
+	// damage a blob in the middle of the pack
+	damagedBlob := indexBlobs[1]
+	damaged[damagedBlob.Offset+damagedBlob.Length/2] ^= 0x01
+
+	want := make(map[restic.BlobHandle][]byte)
+	for h, data := range blobs {
+		if h != damagedBlob.BlobHandle {
+			want[h] = data
+		}
+	}
+
+	for _, known := range [][]restic.Blob{nil, indexBlobs} {
+		salvaged, err = repo.SalvagePack(context.TODO(), damaged, known)
+		rtest.OK(t, err)
+		checkSalvagedBlobs(t, salvaged, want)
+	}
+
+	// damaged header and blob, the blob boundaries are only known from the index
+	damaged[len(damaged)-10] ^= 0x01
+	salvaged, err = repo.SalvagePack(context.TODO(), damaged, indexBlobs)
+	rtest.OK(t, err)
+	checkSalvagedBlobs(t, salvaged, want)
+}
+
+func TestSalvagePack(t *testing.T) {
+	for _, version := range []uint{1, 2} {
+		t.Run("", func(t *testing.T) {
+			testSalvagePack(t, version)
+		})
+	}
+}
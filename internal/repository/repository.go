@@ -21,6 +21,7 @@ import (
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/ui/progress"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/minio/sha256-simd"
 	"golang.org/x/sync/errgroup"
 )
@@ -34,21 +35,77 @@ type Repository struct {
 	idx     *MasterIndex
 	Cache   *cache.Cache
 
+	opts Options
+
 	noAutoIndexUpdate bool
-	minPackSize       uint
 
 	treePM *packerManager
 	dataPM *packerManager
+
+	allocEnc sync.Once
+	enc      *zstd.Encoder
+}
+
+// Options contains the settings a repository is opened with.
+type Options struct {
+	Compression CompressionMode
+	MinPackSize uint
+}
+
+// CompressionMode configures if data should be compressed.
+type CompressionMode uint
+
+// Constants for the different compression levels.
+const (
+	CompressionAuto    CompressionMode = 0
+	CompressionOff     CompressionMode = 1
+	CompressionMax     CompressionMode = 2
+	CompressionInvalid CompressionMode = 3
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *CompressionMode) Set(s string) error {
+	switch s {
+	case "auto":
+		*c = CompressionAuto
+	case "off":
+		*c = CompressionOff
+	case "max":
+		*c = CompressionMax
+	default:
+		*c = CompressionInvalid
+		return fmt.Errorf("invalid compression mode %q, must be one of (auto|off|max)", s)
+	}
+
+	return nil
+}
+
+func (c *CompressionMode) String() string {
+	switch *c {
+	case CompressionAuto:
+		return "auto"
+	case CompressionOff:
+		return "off"
+	case CompressionMax:
+		return "max"
+	default:
+		return "invalid"
+	}
+}
+
+// Type returns the type name used in the help output of pflag.
+func (c *CompressionMode) Type() string {
+	return "mode"
 }
 
 // New returns a new repository with backend be.
-func New(be restic.Backend, minPackSize uint) *Repository {
+func New(be restic.Backend, opts Options) *Repository {
 	repo := &Repository{
-		be:          be,
-		idx:         NewMasterIndex(),
-		dataPM:      newPackerManager(be, nil),
-		treePM:      newPackerManager(be, nil),
-		minPackSize: minPackSize,
+		be:     be,
+		opts:   opts,
+		idx:    NewMasterIndex(),
+		dataPM: newPackerManager(be, nil),
+		treePM: newPackerManager(be, nil),
 	}
 
 	return repo
@@ -62,7 +119,7 @@ func (r *Repository) DisableAutoIndexUpdate() {
 
 // MinPackSize returns the configured minimum pack size.
 func (r *Repository) MinPackSize() uint {
-	return r.minPackSize
+	return r.opts.MinPackSize
 }
 
 // Config returns the repository configuration.
@@ -228,15 +285,26 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 			continue
 		}
 
+		plaintext, err = DecompressBlob(blob.Blob, plaintext)
+		if err != nil {
+			lastError = errors.Errorf("decompressing blob %v failed: %v", id, err)
+			continue
+		}
+
 		// check hash
 		if !restic.Hash(plaintext).Equal(id) {
 			lastError = errors.Errorf("blob %v returned invalid hash", id)
 			continue
 		}
 
+		if len(plaintext) > cap(buf) {
+			return plaintext, nil
+		}
+
 		// move decrypted data to the start of the buffer
+		buf = buf[:len(plaintext)]
 		copy(buf, plaintext)
-		return buf[:len(plaintext)], nil
+		return buf, nil
 	}
 
 	if lastError != nil {
@@ -262,12 +330,100 @@ func (r *Repository) LookupBlobSize(id restic.ID, tpe restic.BlobType) (uint, bo
 	return r.idx.LookupSize(restic.BlobHandle{ID: id, Type: tpe})
 }
 
-// SaveAndEncrypt encrypts data and stores it to the backend as type t. If data
-// is small enough, it will be packed together with other small blobs.
-// The caller must ensure that the id matches the data.
+// getZstdEncoder returns the encoder used to compress blobs, it is allocated
+// on first use.
+func (r *Repository) getZstdEncoder() *zstd.Encoder {
+	r.allocEnc.Do(func() {
+		level := zstd.SpeedDefault
+		if r.opts.Compression == CompressionMax {
+			level = zstd.SpeedBestCompression
+		}
+
+		opts := []zstd.EOption{
+			// Set the compression level configured.
+			zstd.WithEncoderLevel(level),
+			// Disable CRC, we have enough checks in place, makes the
+			// compressed data four bytes shorter.
+			zstd.WithEncoderCRC(false),
+			// Set a window of 512kbyte, so we have good lookbehind for usual
+			// blob sizes.
+			zstd.WithWindowSize(512 * 1024),
+		}
+
+		enc, err := zstd.NewWriter(nil, opts...)
+		if err != nil {
+			panic(err)
+		}
+		r.enc = enc
+	})
+	return r.enc
+}
+
+var (
+	allocDec sync.Once
+	dec      *zstd.Decoder
+)
+
+func getZstdDecoder() *zstd.Decoder {
+	allocDec.Do(func() {
+		opts := []zstd.DOption{
+			// Use all available cores.
+			zstd.WithDecoderConcurrency(0),
+			// Limit the maximum decompressed memory. Set to a very high,
+			// conservative value.
+			zstd.WithDecoderMaxMemory(16 * 1024 * 1024 * 1024),
+		}
+
+		d, err := zstd.NewReader(nil, opts...)
+		if err != nil {
+			panic(err)
+		}
+		dec = d
+	})
+	return dec
+}
+
+// DecompressBlob decompresses the decrypted content of blob and returns the
+// plaintext. For blobs which are not compressed, data is returned unchanged.
+func DecompressBlob(blob restic.Blob, data []byte) ([]byte, error) {
+	if !blob.IsCompressed() {
+		return data, nil
+	}
+
+	plaintext, err := getZstdDecoder().DecodeAll(data, make([]byte, 0, blob.DataLength()))
+	if err != nil {
+		return nil, err
+	}
+
+	if uint(len(plaintext)) != blob.DataLength() {
+		return nil, errors.Errorf("decompressed length mismatch, want %v, got %v", blob.DataLength(), len(plaintext))
+	}
+
+	return plaintext, nil
+}
+
+// compressionEnabled returns true iff blobs may be compressed, which is the
+// case for repository version 2 and later.
+func (r *Repository) compressionEnabled() bool {
+	return r.cfg.Version > 1
+}
+
+// SaveAndEncrypt compresses (if enabled), encrypts data and stores it to the
+// backend as type t. If data is small enough, it will be packed together with
+// other small blobs. The caller must ensure that the id matches the data.
 func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data []byte, id restic.ID) error {
 	debug.Log("save id %v (%v, %d bytes)", id, t, len(data))
 
+	uncompressedLength := 0
+	if r.compressionEnabled() {
+		// trees are always compressed, data blobs only if the user did not
+		// disable compression
+		if r.opts.Compression != CompressionOff || t != restic.DataBlob {
+			uncompressedLength = len(data)
+			data = r.getZstdEncoder().EncodeAll(data, nil)
+		}
+	}
+
 	nonce := crypto.NewRandomNonce()
 
 	ciphertext := make([]byte, 0, restic.CiphertextLength(len(data)))
@@ -294,13 +450,13 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	}
 
 	// save ciphertext
-	_, err = packer.Add(t, id, ciphertext)
+	_, err = packer.Add(t, id, ciphertext, uncompressedLength)
 	if err != nil {
 		return err
 	}
 
 	// if the pack is not full enough, put back to the list
-	if packer.Size() < r.minPackSize {
+	if packer.Size() < r.opts.MinPackSize {
 		debug.Log("pack is not full enough (%d bytes)", packer.Size())
 		pm.insertPacker(packer)
 		return nil
@@ -641,7 +797,15 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 
 // Init creates a new master key with the supplied password, initializes and
 // saves the repository config.
-func (r *Repository) Init(ctx context.Context, password string, chunkerPolynomial *chunker.Pol) error {
+func (r *Repository) Init(ctx context.Context, version uint, password string, chunkerPolynomial *chunker.Pol) error {
+	if version > restic.MaxRepoVersion {
+		return fmt.Errorf("repository version %v too high", version)
+	}
+
+	if version < restic.MinRepoVersion {
+		return fmt.Errorf("repository version %v too low", version)
+	}
+
 	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
 		return err
@@ -650,7 +814,7 @@ func (r *Repository) Init(ctx context.Context, password string, chunkerPolynomia
 		return errors.New("repository master key and config already initialized")
 	}
 
-	cfg, err := restic.CreateConfig()
+	cfg, err := restic.CreateConfig(version)
 	if err != nil {
 		return err
 	}
@@ -515,3 +515,37 @@ func TestDownloadAndHashErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveCompressed(t *testing.T) {
+	for _, version := range []uint{1, 2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			repo, cleanup := repository.TestRepositoryWithVersion(t, version)
+			defer cleanup()
+
+			// highly compressible data
+			data := bytes.Repeat([]byte("restic"), 100*1024)
+			id := restic.Hash(data)
+
+			_, _, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, id, false)
+			rtest.OK(t, err)
+			rtest.OK(t, repo.Flush(context.Background()))
+
+			pbs := repo.Index().Lookup(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+			rtest.Equals(t, 1, len(pbs))
+			rtest.Equals(t, version > 1, pbs[0].IsCompressed())
+			if version > 1 {
+				rtest.Assert(t, pbs[0].Length < uint(len(data)),
+					"compressed blob is not smaller than its content: %v >= %v", pbs[0].Length, len(data))
+			}
+			rtest.Equals(t, uint(len(data)), pbs[0].DataLength())
+
+			size, found := repo.LookupBlobSize(id, restic.DataBlob)
+			rtest.Assert(t, found, "blob not found in index")
+			rtest.Equals(t, uint(len(data)), size)
+
+			buf, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, nil)
+			rtest.OK(t, err)
+			rtest.Assert(t, bytes.Equal(buf, data), "data does not match")
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/restic"
+)
+
+var zeroChunkOnce sync.Once
+var zeroChunkID restic.ID
+
+// ZeroChunk returns the ID of an all-zero chunk of size chunker.MinSize. The
+// chunker always splits runs of zero bytes into chunks of this size, so such
+// runs are stored as a sequence of this blob, apart from the chunks at the
+// start and end of the run.
+func ZeroChunk() restic.ID {
+	zeroChunkOnce.Do(func() {
+		zeroChunkID = restic.Hash(make([]byte, chunker.MinSize))
+	})
+	return zeroChunkID
+}
@@ -0,0 +1,345 @@
+package restic
+
+// Adapted from https://github.com/maxymania/go-system/blob/master/posix_acl/posix_acl.go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Linux stores POSIX ACLs in these extended attributes. The access ACL
+// controls the access to the item itself, the default ACL is inherited by the
+// items created within a directory.
+const (
+	ACLAccessAttribute  = "system.posix_acl_access"
+	ACLDefaultAttribute = "system.posix_acl_default"
+)
+
+// IsACLAttribute returns true if the extended attribute name contains a POSIX
+// ACL.
+func IsACLAttribute(name string) bool {
+	return name == ACLAccessAttribute || name == ACLDefaultAttribute
+}
+
+// ACLTag is the type of an ACL entry.
+type ACLTag uint16
+
+// The ACL entry types, only entries with the tag ACLUser or ACLGroup have an
+// ID.
+const (
+	ACLUserOwner  ACLTag = 0x0001
+	ACLUser       ACLTag = 0x0002
+	ACLGroupOwner ACLTag = 0x0004
+	ACLGroup      ACLTag = 0x0008
+	ACLMask       ACLTag = 0x0010
+	ACLOther      ACLTag = 0x0020
+)
+
+// ACLEntry is a single entry of a POSIX ACL. Perm contains the bits 4 (read),
+// 2 (write) and 1 (execute).
+type ACLEntry struct {
+	Tag  ACLTag
+	ID   uint32
+	Perm uint16
+}
+
+// ACL is a POSIX ACL in the format used by Linux for the extended attributes
+// ACLAccessAttribute and ACLDefaultAttribute.
+type ACL struct {
+	Version uint32
+	Entries []ACLEntry
+}
+
+// aclEntrySize is the size of an encoded ACL entry.
+const aclEntrySize = 8
+
+// ParseACL decodes the value of an ACL extended attribute.
+func ParseACL(data []byte) (*ACL, error) {
+	if len(data) < 4 || (len(data)-4)%aclEntrySize != 0 {
+		return nil, errors.Errorf("invalid ACL of length %d", len(data))
+	}
+
+	a := &ACL{
+		Version: binary.LittleEndian.Uint32(data),
+	}
+	for buf := data[4:]; len(buf) > 0; buf = buf[aclEntrySize:] {
+		a.Entries = append(a.Entries, ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(buf)),
+			Perm: binary.LittleEndian.Uint16(buf[2:]),
+			ID:   binary.LittleEndian.Uint32(buf[4:]),
+		})
+	}
+
+	return a, nil
+}
+
+// aclVersion is the version of the ACLs stored in extended attributes.
+const aclVersion = 2
+
+// ParseACLText parses an ACL in the text format used by getfacl and tar, the
+// entries are separated by newlines or commas and text after "#" is ignored.
+// The qualifier of user and group entries is a numeric ID or a name. Names
+// are resolved on the local system unless the numeric ID is appended as a
+// fourth field, as written by star and GNU tar, e.g. "user:alice:rw-:1000".
+func ParseACLText(text string) (*ACL, error) {
+	a := &ACL{Version: aclVersion}
+
+	lines := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+	for _, line := range lines {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		e, err := parseACLEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		a.Entries = append(a.Entries, e)
+	}
+
+	return a, nil
+}
+
+func parseACLEntry(s string) (ACLEntry, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 && len(fields) != 4 {
+		return ACLEntry{}, errors.Errorf("invalid ACL entry %q", s)
+	}
+
+	var e ACLEntry
+	for i, c := range fields[2] {
+		if i >= 3 {
+			return ACLEntry{}, errors.Errorf("invalid permissions in ACL entry %q", s)
+		}
+		switch c {
+		case 'r':
+			e.Perm |= 4
+		case 'w':
+			e.Perm |= 2
+		case 'x':
+			e.Perm |= 1
+		case '-':
+		default:
+			return ACLEntry{}, errors.Errorf("invalid permissions in ACL entry %q", s)
+		}
+	}
+
+	qualifier := fields[1]
+	if len(fields) == 4 {
+		qualifier = fields[3]
+	}
+
+	lookup := lookupUID
+	switch fields[0] {
+	case "user", "u":
+		e.Tag = ACLUserOwner
+		if fields[1] != "" {
+			e.Tag = ACLUser
+		}
+	case "group", "g":
+		e.Tag = ACLGroupOwner
+		if fields[1] != "" {
+			e.Tag = ACLGroup
+		}
+		lookup = lookupGID
+	case "mask", "m":
+		e.Tag = ACLMask
+	case "other", "o":
+		e.Tag = ACLOther
+	default:
+		return ACLEntry{}, errors.Errorf("invalid tag in ACL entry %q", s)
+	}
+
+	if e.Tag != ACLUser && e.Tag != ACLGroup {
+		// entries without an ID use the same value as the Linux kernel
+		e.ID = 0xffffffff
+		return e, nil
+	}
+
+	if id, err := strconv.ParseUint(qualifier, 10, 32); err == nil {
+		e.ID = uint32(id)
+		return e, nil
+	}
+
+	id, ok := lookup(qualifier)
+	if !ok {
+		return ACLEntry{}, errors.Errorf("unknown user or group in ACL entry %q", s)
+	}
+	e.ID = id
+	return e, nil
+}
+
+// Encode returns the value of the extended attribute for a.
+func (a *ACL) Encode() []byte {
+	buf := make([]byte, 4+len(a.Entries)*aclEntrySize)
+	binary.LittleEndian.PutUint32(buf, a.Version)
+	for i, e := range a.Entries {
+		b := buf[4+i*aclEntrySize:]
+		binary.LittleEndian.PutUint16(b, uint16(e.Tag))
+		binary.LittleEndian.PutUint16(b[2:], e.Perm)
+		binary.LittleEndian.PutUint32(b[4:], e.ID)
+	}
+	return buf
+}
+
+// String returns the entry in the text format used by getfacl, e.g.
+// "user:1000:rw-".
+func (e ACLEntry) String() string {
+	perm := []byte("---")
+	if e.Perm&4 != 0 {
+		perm[0] = 'r'
+	}
+	if e.Perm&2 != 0 {
+		perm[1] = 'w'
+	}
+	if e.Perm&1 != 0 {
+		perm[2] = 'x'
+	}
+
+	switch e.Tag {
+	case ACLUserOwner:
+		return "user::" + string(perm)
+	case ACLUser:
+		return fmt.Sprintf("user:%v:%s", e.ID, perm)
+	case ACLGroupOwner:
+		return "group::" + string(perm)
+	case ACLGroup:
+		return fmt.Sprintf("group:%v:%s", e.ID, perm)
+	case ACLMask:
+		return "mask::" + string(perm)
+	case ACLOther:
+		return "other::" + string(perm)
+	}
+	return "?:" + string(perm)
+}
+
+// String returns the ACL in the text format used by getfacl, one entry per
+// line.
+func (a *ACL) String() string {
+	var buf bytes.Buffer
+	for _, e := range a.Entries {
+		buf.WriteString(e.String())
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Short returns the ACL as a single line, the entries are separated by commas.
+func (a *ACL) Short() string {
+	entries := make([]string, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		entries = append(entries, e.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// sortedEntries returns a sorted copy of the entries of a. The ID of entries
+// without an ID is cleared.
+func (a *ACL) sortedEntries() []ACLEntry {
+	entries := make([]ACLEntry, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		if e.Tag != ACLUser && e.Tag != ACLGroup {
+			e.ID = 0
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tag != entries[j].Tag {
+			return entries[i].Tag < entries[j].Tag
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Equal returns true if a and other grant the same permissions. In contrast
+// to comparing the encoded ACLs, the order of the entries is ignored.
+func (a *ACL) Equal(other *ACL) bool {
+	if a.Version != other.Version || len(a.Entries) != len(other.Entries) {
+		return false
+	}
+
+	entries, otherEntries := a.sortedEntries(), other.sortedEntries()
+	for i := range entries {
+		if entries[i] != otherEntries[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SameACL returns true if the values a and b of the extended attribute name
+// are POSIX ACLs which grant the same permissions.
+func SameACL(name string, a, b []byte) bool {
+	if !IsACLAttribute(name) {
+		return false
+	}
+
+	aclA, err := ParseACL(a)
+	if err != nil {
+		return false
+	}
+	aclB, err := ParseACL(b)
+	if err != nil {
+		return false
+	}
+	return aclA.Equal(aclB)
+}
+
+// MapIDs returns a copy of a in which the IDs of the user and group entries
+// are translated by uids and gids. IDs not contained in the maps are kept.
+func (a *ACL) MapIDs(uids, gids map[uint32]uint32) *ACL {
+	n := &ACL{
+		Version: a.Version,
+		Entries: make([]ACLEntry, 0, len(a.Entries)),
+	}
+	for _, e := range a.Entries {
+		switch e.Tag {
+		case ACLUser:
+			if id, ok := uids[e.ID]; ok {
+				e.ID = id
+			}
+		case ACLGroup:
+			if id, ok := gids[e.ID]; ok {
+				e.ID = id
+			}
+		}
+		n.Entries = append(n.Entries, e)
+	}
+	return n
+}
+
+// ACLs returns the parsed access and default ACL of the node, which are nil if
+// the node does not have the respective ACL or if it cannot be parsed.
+func (node Node) ACLs() (access, def *ACL) {
+	for _, attr := range node.ExtendedAttributes {
+		if !IsACLAttribute(attr.Name) {
+			continue
+		}
+
+		a, err := ParseACL(attr.Value)
+		if err != nil {
+			continue
+		}
+
+		switch attr.Name {
+		case ACLAccessAttribute:
+			access = a
+		case ACLDefaultAttribute:
+			def = a
+		}
+	}
+	return access, def
+}
@@ -0,0 +1,194 @@
+package restic_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testACL = []byte{2, 0, 0, 0, 1, 0, 6, 0, 255, 255, 255, 255, 2, 0, 7, 0, 0, 0, 0, 0, 2, 0, 7, 0, 254, 255, 0, 0, 4, 0, 7, 0, 255, 255, 255, 255, 16, 0, 7, 0, 255, 255, 255, 255, 32, 0, 4, 0, 255, 255, 255, 255}
+
+var testACLEntries = []restic.ACLEntry{
+	{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+	{Tag: restic.ACLUser, ID: 0, Perm: 7},
+	{Tag: restic.ACLUser, ID: 65534, Perm: 7},
+	{Tag: restic.ACLGroupOwner, ID: 0xffffffff, Perm: 7},
+	{Tag: restic.ACLMask, ID: 0xffffffff, Perm: 7},
+	{Tag: restic.ACLOther, ID: 0xffffffff, Perm: 4},
+}
+
+func TestParseACL(t *testing.T) {
+	var tests = []struct {
+		name string
+		data []byte
+		want string
+		err  bool
+	}{
+		{
+			name: "decode string",
+			data: testACL,
+			want: "user::rw-\nuser:0:rwx\nuser:65534:rwx\ngroup::rwx\nmask::rwx\nother::r--\n",
+		},
+		{
+			name: "decode group",
+			data: []byte{2, 0, 0, 0, 8, 0, 1, 0, 254, 255, 0, 0},
+			want: "group:65534:--x\n",
+		},
+		{
+			name: "decode fail",
+			data: []byte("abctest"),
+			err:  true,
+		},
+		{
+			name: "decode empty fail",
+			data: []byte(""),
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := restic.ParseACL(test.data)
+			if test.err {
+				rtest.Assert(t, err != nil, "expected error for %v, got nil", test.data)
+				return
+			}
+			rtest.OK(t, err)
+			rtest.Equals(t, test.want, a.String())
+		})
+	}
+}
+
+func TestACLEncode(t *testing.T) {
+	var tests = []struct {
+		name    string
+		entries []restic.ACLEntry
+		want    []byte
+	}{
+		{
+			name:    "encode values",
+			entries: testACLEntries,
+			want:    testACL,
+		},
+		{
+			name: "encode empty",
+			want: []byte{2, 0, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &restic.ACL{Version: 2, Entries: test.entries}
+			if got := a.Encode(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Encode() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestACLEqual(t *testing.T) {
+	a := &restic.ACL{Version: 2, Entries: testACLEntries}
+
+	reordered := &restic.ACL{Version: 2}
+	for i := len(testACLEntries) - 1; i >= 0; i-- {
+		e := testACLEntries[i]
+		if e.Tag == restic.ACLMask {
+			// the ID of entries without an ID is ignored
+			e.ID = 0
+		}
+		reordered.Entries = append(reordered.Entries, e)
+	}
+	rtest.Assert(t, a.Equal(reordered), "reordered ACL is not equal")
+
+	changed := &restic.ACL{Version: 2, Entries: append([]restic.ACLEntry(nil), testACLEntries...)}
+	changed.Entries[2].Perm = 4
+	rtest.Assert(t, !a.Equal(changed), "ACL with changed permissions is equal")
+
+	rtest.Assert(t, !a.Equal(&restic.ACL{Version: 2, Entries: testACLEntries[:3]}), "shorter ACL is equal")
+}
+
+func TestACLMapIDs(t *testing.T) {
+	a := &restic.ACL{Version: 2, Entries: []restic.ACLEntry{
+		{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+		{Tag: restic.ACLUser, ID: 1000, Perm: 7},
+		{Tag: restic.ACLGroup, ID: 1000, Perm: 5},
+		{Tag: restic.ACLGroup, ID: 2000, Perm: 4},
+	}}
+
+	mapped := a.MapIDs(map[uint32]uint32{1000: 1500}, map[uint32]uint32{2000: 2500})
+	rtest.Equals(t, "user::rw-,user:1500:rwx,group:1000:r-x,group:2500:r--", mapped.Short())
+	// the original is not modified
+	rtest.Equals(t, "user::rw-,user:1000:rwx,group:1000:r-x,group:2000:r--", a.Short())
+}
+
+func TestNodeEqualsACL(t *testing.T) {
+	reordered := &restic.ACL{Version: 2}
+	for i := len(testACLEntries) - 1; i >= 0; i-- {
+		reordered.Entries = append(reordered.Entries, testACLEntries[i])
+	}
+
+	node1 := restic.Node{Name: "foo", ExtendedAttributes: []restic.ExtendedAttribute{
+		{Name: restic.ACLAccessAttribute, Value: testACL},
+	}}
+	node2 := restic.Node{Name: "foo", ExtendedAttributes: []restic.ExtendedAttribute{
+		{Name: restic.ACLAccessAttribute, Value: reordered.Encode()},
+	}}
+	rtest.Assert(t, node1.Equals(node2), "nodes with reordered ACL entries are not equal")
+
+	// other extended attributes are still compared byte by byte
+	node1.ExtendedAttributes[0].Name = "user.foo"
+	node2.ExtendedAttributes[0].Name = "user.foo"
+	rtest.Assert(t, !node1.Equals(node2), "nodes with different extended attributes are equal")
+}
+
+func TestParseACLText(t *testing.T) {
+	var tests = []struct {
+		text string
+		want []restic.ACLEntry
+		err  bool
+	}{
+		{
+			text: "user::rw-\nuser:0:rwx\nuser:65534:rwx\ngroup::rwx\nmask::rwx\nother::r--\n",
+			want: testACLEntries,
+		},
+		{
+			text: "# file: foo\nuser::rw-,user:alice:rwx:0,group::r-x,group:nogroup:r--:65534,other::---",
+			want: []restic.ACLEntry{
+				{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+				{Tag: restic.ACLUser, ID: 0, Perm: 7},
+				{Tag: restic.ACLGroupOwner, ID: 0xffffffff, Perm: 5},
+				{Tag: restic.ACLGroup, ID: 65534, Perm: 4},
+				{Tag: restic.ACLOther, ID: 0xffffffff, Perm: 0},
+			},
+		},
+		{text: "user::rw"},
+		{text: "user::rwxr", err: true},
+		{text: "foo::rwx", err: true},
+		{text: "user:0:abc", err: true},
+		{text: "user", err: true},
+		{text: "user:nonexisting-user-restic-test:rwx", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			a, err := restic.ParseACLText(test.text)
+			if test.err {
+				rtest.Assert(t, err != nil, "expected error for %q, got nil", test.text)
+				return
+			}
+			rtest.OK(t, err)
+			if test.want != nil {
+				rtest.Equals(t, test.want, a.Entries)
+			}
+		})
+	}
+
+	// the text format written by String can be parsed again
+	a, err := restic.ParseACL(testACL)
+	rtest.OK(t, err)
+	b, err := restic.ParseACLText(a.String())
+	rtest.OK(t, err)
+	rtest.Equals(t, testACL, b.Encode())
+}
@@ -32,7 +32,7 @@ func TestConfig(t *testing.T) {
 		return restic.ID{}, nil
 	}
 
-	cfg1, err := restic.CreateConfig()
+	cfg1, err := restic.CreateConfig(restic.StableRepoVersion)
 	rtest.OK(t, err)
 
 	_, err = saver(save).SaveJSONUnpacked(restic.ConfigFile, cfg1)
@@ -54,3 +54,14 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigLoadUnsupportedVersion(t *testing.T) {
+	load := func(ctx context.Context, tpe restic.FileType, id restic.ID, arg interface{}) error {
+		cfg := arg.(*restic.Config)
+		*cfg = restic.Config{Version: restic.MaxRepoVersion + 1}
+		return nil
+	}
+
+	_, err := restic.LoadConfig(context.TODO(), loader(load))
+	rtest.Assert(t, err != nil, "loading config with unsupported version did not fail")
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/user"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -34,6 +35,7 @@ type Node struct {
 	ModTime            time.Time           `json:"mtime,omitempty"`
 	AccessTime         time.Time           `json:"atime,omitempty"`
 	ChangeTime         time.Time           `json:"ctime,omitempty"`
+	BirthTime          *time.Time          `json:"btime,omitempty"` // creation time, if supported by the file system
 	UID                uint32              `json:"uid"`
 	GID                uint32              `json:"gid"`
 	User               string              `json:"user,omitempty"`
@@ -44,7 +46,8 @@ type Node struct {
 	Links              uint64              `json:"links,omitempty"`
 	LinkTarget         string              `json:"linktarget,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
-	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
+	InodeFlags         uint32              `json:"inode_flags,omitempty"` // Linux inode flags set by chattr, see fs.InodeFlagsUser
+	Device             uint64              `json:"device,omitempty"`      // in case of Type == "dev", stat.st_rdev
 	Content            IDs                 `json:"content"`
 	Subtree            *ID                 `json:"subtree,omitempty"`
 
@@ -84,8 +87,17 @@ func (node Node) String() string {
 }
 
 // NodeFromFileInfo returns a new node from the given path and FileInfo. It
-// returns the first error that is encountered, together with a node.
+// returns the first error that is encountered, together with a node. File
+// systems which do not represent local files can return a *Node from
+// fi.Sys(), a copy of it is returned then.
 func NodeFromFileInfo(path string, fi os.FileInfo) (*Node, error) {
+	if n, ok := fi.Sys().(*Node); ok {
+		node := *n
+		node.Path = path
+		node.Name = fi.Name()
+		return &node, nil
+	}
+
 	mask := os.ModePerm | os.ModeType | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
 	node := &Node{
 		Path:    path,
@@ -198,7 +210,7 @@ func (node Node) restoreMetadata(path string) error {
 
 	if node.Type != "symlink" {
 		if err := fs.Chmod(path, node.Mode); err != nil {
-			if firsterr != nil {
+			if firsterr == nil {
 				firsterr = errors.Wrap(err, "Chmod")
 			}
 		}
@@ -206,14 +218,23 @@ func (node Node) restoreMetadata(path string) error {
 
 	if err := node.RestoreTimestamps(path); err != nil {
 		debug.Log("error restoring timestamps for dir %v: %v", path, err)
-		if firsterr != nil {
+		if firsterr == nil {
 			firsterr = err
 		}
 	}
 
 	if err := node.restoreExtendedAttributes(path); err != nil {
 		debug.Log("error restoring extended attributes for %v: %v", path, err)
-		if firsterr != nil {
+		if firsterr == nil {
+			firsterr = err
+		}
+	}
+
+	// the inode flags are restored last, as flags like immutable prevent
+	// changing the other metadata
+	if err := node.restoreInodeFlags(path); err != nil {
+		debug.Log("error restoring inode flags for %v: %v", path, err)
+		if firsterr == nil {
 			firsterr = err
 		}
 	}
@@ -221,13 +242,53 @@ func (node Node) restoreMetadata(path string) error {
 	return firsterr
 }
 
+// restoreInodeFlags sets the inode flags recorded in the snapshot. Items
+// without flags are skipped, as most items do not have any flags set and
+// snapshots created on other systems do not record them.
+func (node Node) restoreInodeFlags(path string) error {
+	if node.InodeFlags == 0 || (node.Type != "file" && node.Type != "dir") {
+		return nil
+	}
+
+	err := fs.SetInodeFlags(path, node.InodeFlags, fs.InodeFlagsUser)
+	// setting flags like immutable requires CAP_LINUX_IMMUTABLE, like for
+	// lchown we only report permission errors if we run as root
+	if err != nil && os.Geteuid() > 0 && errors.Is(err, syscall.EPERM) {
+		debug.Log("not running as root, ignoring permission error for inode flags of %v: %v", path, err)
+		return nil
+	}
+	return err
+}
+
+// ExtendedAttributeError is returned by RestoreMetadata if some extended
+// attributes could not be restored, while the remaining metadata was restored
+// successfully.
+type ExtendedAttributeError struct {
+	Errors []error
+}
+
+func (e *ExtendedAttributeError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// restoreExtendedAttributes tries to restore all extended attributes, a
+// failure for one attribute does not prevent restoring the others.
 func (node Node) restoreExtendedAttributes(path string) error {
+	var errs []error
 	for _, attr := range node.ExtendedAttributes {
 		err := Setxattr(path, attr.Name, attr.Value)
 		if err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
+
+	if len(errs) > 0 {
+		return &ExtendedAttributeError{Errors: errs}
+	}
 	return nil
 }
 
@@ -381,6 +442,10 @@ func (node Node) Equals(other Node) bool {
 	if !node.ChangeTime.Equal(other.ChangeTime) {
 		return false
 	}
+	if (node.BirthTime == nil) != (other.BirthTime == nil) ||
+		(node.BirthTime != nil && !node.BirthTime.Equal(*other.BirthTime)) {
+		return false
+	}
 	if node.UID != other.UID {
 		return false
 	}
@@ -417,6 +482,9 @@ func (node Node) Equals(other Node) bool {
 	if !node.sameExtendedAttributes(other) {
 		return false
 	}
+	if node.InodeFlags != other.InodeFlags {
+		return false
+	}
 	if node.Subtree != nil {
 		if other.Subtree == nil {
 			return false
@@ -482,7 +550,7 @@ func (node Node) sameExtendedAttributes(other Node) bool {
 
 		}
 
-		if !bytes.Equal(v.value, attr.Value) {
+		if !bytes.Equal(v.value, attr.Value) && !SameACL(attr.Name, v.value, attr.Value) {
 			// attribute has different value
 			debug.Log("attribute %v has different value", attr.Name)
 			return false
@@ -613,6 +681,32 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 	return nil
 }
 
+// FillInodeFlags records the creation time and, for regular files and
+// directories, the inode flags of the local item at path described by fi.
+// This needs additional system calls for each item, so it is not done by
+// NodeFromFileInfo. Errors are ignored, as the flags cannot be read for
+// example from files without read permission.
+func (node *Node) FillInodeFlags(path string, fi os.FileInfo) {
+	if _, ok := toStatT(fi.Sys()); !ok {
+		return
+	}
+
+	if btime, ok := fs.BirthTime(path); ok {
+		node.BirthTime = &btime
+	}
+
+	if node.Type != "file" && node.Type != "dir" {
+		return
+	}
+
+	flags, err := fs.GetInodeFlags(path)
+	if err != nil {
+		debug.Log("unable to read inode flags of %v: %v", path, err)
+		return
+	}
+	node.InodeFlags = flags & fs.InodeFlagsUser
+}
+
 func (node *Node) fillExtendedAttributes(path string) error {
 	if node.Type == "symlink" {
 		return nil
@@ -0,0 +1,43 @@
+package restic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestNodeInodeFlags(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0600))
+	rtest.OK(t, fs.SetInodeFlags(filename, fs.InodeFlagNodump, fs.InodeFlagNodump))
+
+	fi, err := os.Lstat(filename)
+	rtest.OK(t, err)
+	node, err := NodeFromFileInfo(filename, fi)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint32(0), node.InodeFlags)
+	rtest.Assert(t, node.BirthTime == nil, "birth time recorded without FillInodeFlags")
+
+	node.FillInodeFlags(filename, fi)
+	if node.InodeFlags&fs.InodeFlagNodump == 0 {
+		t.Skip("inode flags are not supported")
+	}
+	if node.BirthTime != nil {
+		rtest.Assert(t, !node.BirthTime.After(node.ChangeTime), "birth time %v is after the change time %v", node.BirthTime, node.ChangeTime)
+	}
+
+	restored := filepath.Join(tempdir, "restored")
+	rtest.OK(t, ioutil.WriteFile(restored, []byte("foo"), 0600))
+	rtest.OK(t, node.RestoreMetadata(restored))
+
+	flags, err := fs.GetInodeFlags(restored)
+	rtest.OK(t, err)
+	rtest.Equals(t, node.InodeFlags, flags&fs.InodeFlagsUser)
+}
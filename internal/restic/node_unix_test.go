@@ -4,10 +4,13 @@ package restic
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"testing"
 	"time"
+
+	rtest "github.com/restic/restic/internal/test"
 )
 
 func stat(t testing.TB, filename string) (fi os.FileInfo, ok bool) {
@@ -133,3 +136,22 @@ func TestNodeFromFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreMetadataChmodError(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// chmod follows the dangling symlink and fails, while lchown succeeds
+	path := filepath.Join(tempdir, "link")
+	rtest.OK(t, os.Symlink(filepath.Join(tempdir, "missing"), path))
+
+	node := Node{
+		Name: "link",
+		Type: "file",
+		Mode: 0600,
+		UID:  uint32(os.Getuid()),
+		GID:  uint32(os.Getgid()),
+	}
+	err := node.RestoreMetadata(path)
+	rtest.Assert(t, err != nil, "expected an error for the failed chmod")
+}
@@ -0,0 +1,157 @@
+package restic
+
+import (
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// OwnerMapping translates the owner of nodes, for example when restoring them
+// on a system on which users and groups have different IDs. All methods can be
+// called on a nil OwnerMapping, the IDs stored in the nodes are then used
+// unchanged.
+type OwnerMapping struct {
+	// ByName selects that the user and group names stored in the nodes are
+	// resolved on the current system. The numeric IDs are used for nodes
+	// without names and for names which do not exist on the system.
+	ByName bool
+
+	// UIDs and GIDs map the IDs stored in the nodes to other IDs, they take
+	// precedence over ByName.
+	UIDs map[uint32]uint32
+	GIDs map[uint32]uint32
+}
+
+// Empty returns true if m does not change the owner of any node.
+func (m *OwnerMapping) Empty() bool {
+	return m == nil || (!m.ByName && len(m.UIDs) == 0 && len(m.GIDs) == 0)
+}
+
+// Map returns a copy of node with the translated owner. The user and group
+// names are cleared if the corresponding ID was changed by UIDs or GIDs, as
+// the name is not known on the current system.
+func (m *OwnerMapping) Map(node *Node) *Node {
+	if m.Empty() {
+		return node
+	}
+
+	n := *node
+	if uid, ok := m.UIDs[node.UID]; ok {
+		n.UID = uid
+		n.User = ""
+	} else if m.ByName && node.User != "" {
+		if uid, ok := lookupUID(node.User); ok {
+			n.UID = uid
+		}
+	}
+
+	if gid, ok := m.GIDs[node.GID]; ok {
+		n.GID = gid
+		n.Group = ""
+	} else if m.ByName && node.Group != "" {
+		if gid, ok := lookupGID(node.Group); ok {
+			n.GID = gid
+		}
+	}
+
+	n.ExtendedAttributes = m.mapACLs(node.ExtendedAttributes)
+
+	return &n
+}
+
+// mapACLs returns a copy of attrs in which the IDs within POSIX ACLs are
+// translated by UIDs and GIDs. As ACLs only contain numeric IDs, ByName does
+// not apply to them. If no ACL is changed, attrs is returned unchanged.
+func (m *OwnerMapping) mapACLs(attrs []ExtendedAttribute) []ExtendedAttribute {
+	if len(m.UIDs) == 0 && len(m.GIDs) == 0 {
+		return attrs
+	}
+
+	var mapped []ExtendedAttribute
+	for i, attr := range attrs {
+		if !IsACLAttribute(attr.Name) {
+			continue
+		}
+
+		acl, err := ParseACL(attr.Value)
+		if err != nil {
+			continue
+		}
+
+		if mapped == nil {
+			mapped = append([]ExtendedAttribute(nil), attrs...)
+		}
+		mapped[i].Value = acl.MapIDs(m.UIDs, m.GIDs).Encode()
+	}
+
+	if mapped == nil {
+		return attrs
+	}
+	return mapped
+}
+
+var (
+	uidByNameCache      = make(map[string]*uint32)
+	uidByNameCacheMutex = sync.RWMutex{}
+)
+
+// Cached uid lookup by user name. Returns false when the user does not exist.
+func lookupUID(username string) (uint32, bool) {
+	uidByNameCacheMutex.RLock()
+	uid, ok := uidByNameCache[username]
+	uidByNameCacheMutex.RUnlock()
+
+	if !ok {
+		u, err := user.Lookup(username)
+		if err == nil {
+			uid = parseID(u.Uid)
+		}
+
+		uidByNameCacheMutex.Lock()
+		uidByNameCache[username] = uid
+		uidByNameCacheMutex.Unlock()
+	}
+
+	if uid == nil {
+		return 0, false
+	}
+	return *uid, true
+}
+
+var (
+	gidByNameCache      = make(map[string]*uint32)
+	gidByNameCacheMutex = sync.RWMutex{}
+)
+
+// Cached gid lookup by group name. Returns false when the group does not exist.
+func lookupGID(group string) (uint32, bool) {
+	gidByNameCacheMutex.RLock()
+	gid, ok := gidByNameCache[group]
+	gidByNameCacheMutex.RUnlock()
+
+	if !ok {
+		g, err := user.LookupGroup(group)
+		if err == nil {
+			gid = parseID(g.Gid)
+		}
+
+		gidByNameCacheMutex.Lock()
+		gidByNameCache[group] = gid
+		gidByNameCacheMutex.Unlock()
+	}
+
+	if gid == nil {
+		return 0, false
+	}
+	return *gid, true
+}
+
+// parseID returns nil for IDs which are not numeric, for example Windows SIDs.
+func parseID(s string) *uint32 {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil
+	}
+	v := uint32(id)
+	return &v
+}
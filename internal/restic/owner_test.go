@@ -0,0 +1,84 @@
+package restic_test
+
+import (
+	"os/user"
+	"strconv"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOwnerMapping(t *testing.T) {
+	node := &restic.Node{
+		Name:  "foo",
+		UID:   1000,
+		GID:   100,
+		User:  "restic-nonexisting-user",
+		Group: "restic-nonexisting-group",
+	}
+
+	var m *restic.OwnerMapping
+	rtest.Assert(t, m.Empty(), "nil mapping is not empty")
+	rtest.Equals(t, node, m.Map(node))
+
+	m = &restic.OwnerMapping{
+		ByName: true,
+		UIDs:   map[uint32]uint32{1000: 2000},
+		GIDs:   map[uint32]uint32{200: 300},
+	}
+	mapped := m.Map(node)
+	rtest.Equals(t, uint32(2000), mapped.UID)
+	rtest.Equals(t, "", mapped.User)
+	// the group name does not exist, thus the numeric ID is kept
+	rtest.Equals(t, uint32(100), mapped.GID)
+	rtest.Equals(t, node.Group, mapped.Group)
+	// the original node must not be modified
+	rtest.Equals(t, uint32(1000), node.UID)
+}
+
+func TestOwnerMappingByName(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skipf("unable to determine the current user: %v", err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		t.Skipf("user ID %q is not numeric", u.Uid)
+	}
+
+	node := &restic.Node{Name: "foo", UID: uint32(uid) + 1, User: u.Username}
+
+	m := &restic.OwnerMapping{}
+	rtest.Equals(t, uint32(uid)+1, m.Map(node).UID)
+
+	m.ByName = true
+	rtest.Equals(t, uint32(uid), m.Map(node).UID)
+}
+
+func TestOwnerMappingACL(t *testing.T) {
+	acl := &restic.ACL{Version: 2, Entries: []restic.ACLEntry{
+		{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+		{Tag: restic.ACLUser, ID: 1000, Perm: 6},
+		{Tag: restic.ACLGroup, ID: 200, Perm: 4},
+	}}
+	node := &restic.Node{
+		Name: "foo",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("bar")},
+			{Name: restic.ACLAccessAttribute, Value: acl.Encode()},
+		},
+	}
+
+	m := &restic.OwnerMapping{
+		UIDs: map[uint32]uint32{1000: 2000},
+		GIDs: map[uint32]uint32{200: 300},
+	}
+	access, _ := m.Map(node).ACLs()
+	rtest.Assert(t, access != nil, "mapped node has no ACL")
+	rtest.Equals(t, "user::rw-,user:2000:rw-,group:300:r--", access.Short())
+
+	// the original node must not be modified
+	access, _ = node.ACLs()
+	rtest.Equals(t, "user::rw-,user:1000:rw-,group:200:r--", access.Short())
+}
@@ -71,4 +71,8 @@ type MasterIndex interface {
 	// the context is cancelled, the background goroutine terminates. This
 	// blocks any modification of the index.
 	Each(ctx context.Context) <-chan PackedBlob
+
+	// Pending returns the blobs which have been saved, but which are not yet
+	// contained in a pack file stored in the backend.
+	Pending() BlobSet
 }
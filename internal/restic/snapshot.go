@@ -26,6 +26,9 @@ type Snapshot struct {
 	Excludes []string  `json:"excludes,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
+	// Checkpoint is set for the snapshots which are saved periodically while
+	// a backup is running, they are removed once the backup has completed.
+	Checkpoint bool `json:"checkpoint,omitempty"`
 
 	id *ID // plaintext ID, used during restore
 }
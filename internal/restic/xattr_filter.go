@@ -0,0 +1,77 @@
+package restic
+
+import (
+	"path"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// XattrFilter selects the extended attributes which are saved or restored by
+// their name. Patterns use the syntax of path.Match, e.g. "security.*" selects
+// all attributes in the security namespace. All methods can be called on a
+// nil XattrFilter, all attributes are then selected.
+type XattrFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewXattrFilter returns a filter which selects the attributes matching one
+// of the include patterns, or all attributes if include is empty, unless they
+// match one of the exclude patterns.
+func NewXattrFilter(include, exclude []string) (*XattrFilter, error) {
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("invalid extended attribute pattern %q: %v", pattern, err)
+		}
+	}
+
+	return &XattrFilter{include: include, exclude: exclude}, nil
+}
+
+// Empty returns true if f selects all attributes.
+func (f *XattrFilter) Empty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0)
+}
+
+// Match returns true if the attribute name is selected.
+func (f *XattrFilter) Match(name string) bool {
+	if f.Empty() {
+		return true
+	}
+
+	if len(f.include) > 0 && !matchXattr(f.include, name) {
+		return false
+	}
+	return !matchXattr(f.exclude, name)
+}
+
+func matchXattr(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns a copy of node which only contains the selected extended
+// attributes. If all attributes are selected, node is returned unchanged.
+func (f *XattrFilter) Apply(node *Node) *Node {
+	if f.Empty() {
+		return node
+	}
+
+	var attrs []ExtendedAttribute
+	for _, attr := range node.ExtendedAttributes {
+		if f.Match(attr.Name) {
+			attrs = append(attrs, attr)
+		}
+	}
+	if len(attrs) == len(node.ExtendedAttributes) {
+		return node
+	}
+
+	n := *node
+	n.ExtendedAttributes = attrs
+	return &n
+}
@@ -0,0 +1,60 @@
+package restic_test
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestXattrFilter(t *testing.T) {
+	var tests = []struct {
+		include, exclude []string
+		name             string
+		match            bool
+	}{
+		{nil, nil, "security.selinux", true},
+		{nil, []string{"security.*"}, "security.selinux", false},
+		{nil, []string{"security.*"}, "user.foo", true},
+		{[]string{"user.*"}, nil, "user.foo", true},
+		{[]string{"user.*"}, nil, "trusted.foo", false},
+		{[]string{"user.*"}, []string{"user.secret"}, "user.secret", false},
+		{[]string{"user.*", "system.posix_acl_*"}, nil, "system.posix_acl_access", true},
+	}
+
+	for _, test := range tests {
+		f, err := restic.NewXattrFilter(test.include, test.exclude)
+		rtest.OK(t, err)
+		if f.Match(test.name) != test.match {
+			t.Errorf("include %v exclude %v: Match(%q) = %v, want %v",
+				test.include, test.exclude, test.name, !test.match, test.match)
+		}
+	}
+
+	var f *restic.XattrFilter
+	rtest.Assert(t, f.Match("security.selinux"), "nil filter does not match")
+
+	_, err := restic.NewXattrFilter([]string{"user.["}, nil)
+	rtest.Assert(t, err != nil, "invalid pattern not rejected")
+}
+
+func TestXattrFilterApply(t *testing.T) {
+	node := &restic.Node{
+		Name: "foo",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("foo")},
+			{Name: "security.selinux", Value: []byte("system_u:object_r:user_home_t:s0")},
+		},
+	}
+
+	f, err := restic.NewXattrFilter(nil, []string{"trusted.*"})
+	rtest.OK(t, err)
+	rtest.Equals(t, node, f.Apply(node))
+
+	f, err = restic.NewXattrFilter(nil, []string{"security.*"})
+	rtest.OK(t, err)
+	filtered := f.Apply(node)
+	rtest.Equals(t, []restic.ExtendedAttribute{{Name: "user.foo", Value: []byte("foo")}}, filtered.ExtendedAttributes)
+	// the original node must not be modified
+	rtest.Equals(t, 2, len(node.ExtendedAttributes))
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -36,6 +37,7 @@ type fileInfo struct {
 	size       int64
 	location   string      // file on local filesystem relative to restorer basedir
 	blobs      interface{} // blobs of the file
+	matches    []bool      // blobs already stored in the existing file, nil if the file is recreated
 }
 
 type fileBlobInfo struct {
@@ -43,6 +45,12 @@ type fileBlobInfo struct {
 	offset int64     // blob offset in the file
 }
 
+// a part of a file which could not be restored
+type damagedRange struct {
+	offset, length int64
+	err            error
+}
+
 // information about a data pack required to restore one or more files
 type packInfo struct {
 	id    restic.ID              // the pack id
@@ -56,6 +64,21 @@ type fileRestorer struct {
 	packLoader func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error
 
 	filesWriter *filesWriter
+	zeroChunk   restic.ID
+	sparse      bool
+
+	startPack    func(restic.ID)
+	completePack func(restic.ID)
+	completeBlob func(string, uint64)
+
+	// ignoreMissing configures that blobs which are missing or cannot be
+	// loaded are replaced by zeros instead of aborting the restore, the
+	// damaged ranges are passed to reportDamage.
+	ignoreMissing bool
+	reportDamage  func(location string, offset, length int64, err error)
+
+	damageLock sync.Mutex
+	damage     map[*fileInfo][]damagedRange
 
 	dst   string
 	files []*fileInfo
@@ -72,13 +95,31 @@ func newFileRestorer(dst string,
 		idx:         idx,
 		packLoader:  packLoader,
 		filesWriter: newFilesWriter(workerCount),
+		zeroChunk:   repository.ZeroChunk(),
 		dst:         dst,
 		Error:       restorerAbortOnAllErrors,
+
+		startPack:    func(restic.ID) {},
+		completePack: func(restic.ID) {},
+		completeBlob: func(string, uint64) {},
+		reportDamage: func(string, int64, int64, error) {},
+
+		damage: make(map[*fileInfo][]damagedRange),
 	}
 }
 
-func (r *fileRestorer) addFile(location string, content restic.IDs, size int64) {
-	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size})
+// addFile adds a file to restore. For an existing file which is restored in
+// place, matches lists which blobs are already stored correctly in the file.
+// Such files must already have the correct size.
+func (r *fileRestorer) addFile(location string, content restic.IDs, size int64, matches []bool) {
+	r.files = append(r.files, &fileInfo{
+		location: location,
+		blobs:    content,
+		size:     size,
+		matches:  matches,
+		// existing files must not be truncated
+		inProgress: matches != nil,
+	})
 }
 
 func (r *fileRestorer) targetPath(location string) string {
@@ -109,30 +150,50 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, dryrun bool) error {
 	// approximation to shorten restore times by up to 19% in some test.
 	var packOrder restic.IDs
 
+	addPack := func(packID restic.ID, file *fileInfo) {
+		pack, ok := packs[packID]
+		if !ok {
+			pack = &packInfo{
+				id:    packID,
+				files: make(map[*fileInfo]struct{}),
+			}
+			packs[packID] = pack
+			packOrder = append(packOrder, packID)
+		}
+		pack.files[file] = struct{}{}
+	}
+
 	// create packInfo from fileInfo
 	for _, file := range r.files {
 		fileBlobs := file.blobs.(restic.IDs)
+		if r.ignoreMissing && r.hasMissingBlobs(fileBlobs) {
+			r.planDamagedFile(file, fileBlobs, addPack)
+			continue
+		}
+
 		largeFile := len(fileBlobs) > largeFileBlobCount
 		var packsMap map[restic.ID][]fileBlobInfo
 		if largeFile {
 			packsMap = make(map[restic.ID][]fileBlobInfo)
 		}
 		fileOffset := int64(0)
+		blobIndex := 0
+		hasData := false
 		err := r.forEachBlob(fileBlobs, func(packID restic.ID, blob restic.Blob) {
+			skip := r.skipBlob(file, blobIndex, blob.ID)
+			blobIndex++
+			if skip {
+				// the blob is not downloaded at all
+				fileOffset += int64(blob.DataLength())
+				r.completeBlob(file.location, uint64(blob.DataLength()))
+				return
+			}
+			hasData = true
 			if largeFile {
 				packsMap[packID] = append(packsMap[packID], fileBlobInfo{id: blob.ID, offset: fileOffset})
-				fileOffset += int64(blob.Length) - crypto.Extension
+				fileOffset += int64(blob.DataLength())
 			}
-			pack, ok := packs[packID]
-			if !ok {
-				pack = &packInfo{
-					id:    packID,
-					files: make(map[*fileInfo]struct{}),
-				}
-				packs[packID] = pack
-				packOrder = append(packOrder, packID)
-			}
-			pack.files[file] = struct{}{}
+			addPack(packID, file)
 		})
 		if err != nil {
 			// repository index is messed up, can't do anything
@@ -141,6 +202,14 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, dryrun bool) error {
 		if largeFile {
 			file.blobs = packsMap
 		}
+
+		if !hasData && !dryrun && file.matches == nil {
+			// the file only consists of holes, no pack will create it
+			err = r.filesWriter.writeToFile(r.targetPath(file.location), nil, 0, file.size, true)
+			if err = r.sanitizeError(file, err); err != nil {
+				return err
+			}
+		}
 	}
 
 	wg, ctx := errgroup.WithContext(ctx)
@@ -151,9 +220,11 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, dryrun bool) error {
 			if dryrun {
 				fmt.Println("Downloading pack: ", pack.id)
 			} else {
+				r.startPack(pack.id)
 				if err := r.downloadPack(ctx, pack); err != nil {
 					return err
 				}
+				r.completePack(pack.id)
 			}
 		}
 		return nil
@@ -177,7 +248,189 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, dryrun bool) error {
 		return nil
 	})
 
-	return wg.Wait()
+	err := wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	return r.restoreDamagedFiles(dryrun)
+}
+
+// hasMissingBlobs returns true if any of the blobs is not contained in the
+// index.
+func (r *fileRestorer) hasMissingBlobs(blobIDs restic.IDs) bool {
+	for _, blobID := range blobIDs {
+		if len(r.idx(restic.BlobHandle{ID: blobID, Type: restic.DataBlob})) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// planDamagedFile adds the blobs of a file for which some blobs are missing
+// from the index to the packs. The offsets of the blobs before the first
+// missing blob are known, the offsets of the blobs after the last missing
+// blob are calculated backwards from the end of the file. Everything in
+// between is lost and replaced by zeros.
+func (r *fileRestorer) planDamagedFile(file *fileInfo, fileBlobs restic.IDs, addPack func(restic.ID, *fileInfo)) {
+	blobs := make([]restic.PackedBlob, len(fileBlobs))
+	first, last := -1, -1
+	for i, blobID := range fileBlobs {
+		packs := r.idx(restic.BlobHandle{ID: blobID, Type: restic.DataBlob})
+		if len(packs) == 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			continue
+		}
+		blobs[i] = packs[0]
+	}
+
+	packsMap := make(map[restic.ID][]fileBlobInfo)
+	addBlob := func(index int, offset int64) {
+		blob := blobs[index]
+		if r.skipBlob(file, index, blob.ID) {
+			r.completeBlob(file.location, uint64(blob.DataLength()))
+			return
+		}
+		packsMap[blob.PackID] = append(packsMap[blob.PackID], fileBlobInfo{id: blob.ID, offset: offset})
+		addPack(blob.PackID, file)
+	}
+
+	start := int64(0)
+	for i := 0; i < first; i++ {
+		addBlob(i, start)
+		start += int64(blobs[i].DataLength())
+	}
+
+	end := file.size
+	for i := len(fileBlobs) - 1; i > last; i-- {
+		end -= int64(blobs[i].DataLength())
+		addBlob(i, end)
+	}
+
+	if end < start {
+		// the sizes stored in the index do not match the file size
+		end = start
+	}
+	r.addDamage(file, start, end-start, errors.Errorf("blob %v not found in the repository", fileBlobs[first].Str()))
+
+	file.blobs = packsMap
+}
+
+// addDamage records that the given part of file could not be restored.
+func (r *fileRestorer) addDamage(file *fileInfo, offset, length int64, err error) {
+	debug.Log("damaged %v at offset %d, length %d: %v", file.location, offset, length, err)
+	r.damageLock.Lock()
+	r.damage[file] = append(r.damage[file], damagedRange{offset: offset, length: length, err: err})
+	r.damageLock.Unlock()
+}
+
+// restoreDamagedFiles reports the damaged parts of all files and fills them
+// with zeros. This also creates files for which no blob could be restored.
+func (r *fileRestorer) restoreDamagedFiles(dryrun bool) error {
+	for _, file := range r.files {
+		ranges := mergeDamagedRanges(r.damage[file])
+		if len(ranges) == 0 {
+			continue
+		}
+
+		for _, rng := range ranges {
+			r.reportDamage(file.location, rng.offset, rng.length, rng.err)
+			r.completeBlob(file.location, uint64(rng.length))
+		}
+
+		if dryrun {
+			continue
+		}
+
+		err := r.zeroRanges(file, ranges)
+		if err = r.sanitizeError(file, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// zeroRanges writes zeros to the ranges of file.
+func (r *fileRestorer) zeroRanges(file *fileInfo, ranges []damagedRange) error {
+	createSize := int64(-1)
+	if !file.inProgress {
+		file.inProgress = true
+		createSize = file.size
+	}
+
+	path := r.targetPath(file.location)
+	err := r.filesWriter.writeToFile(path, nil, 0, createSize, r.sparse)
+	if err != nil {
+		return err
+	}
+
+	var zeros []byte
+	for _, rng := range ranges {
+		for offset := rng.offset; offset < rng.offset+rng.length; {
+			n := rng.offset + rng.length - offset
+			if n > maxBufferSize {
+				n = maxBufferSize
+			}
+			if int64(len(zeros)) < n {
+				zeros = make([]byte, n)
+			}
+
+			err = r.filesWriter.writeToFile(path, zeros[:n], offset, -1, false)
+			if err != nil {
+				return err
+			}
+			offset += n
+		}
+	}
+
+	return nil
+}
+
+// mergeDamagedRanges sorts the ranges and merges overlapping or adjacent
+// ranges, the error of the first range is kept.
+func mergeDamagedRanges(ranges []damagedRange) []damagedRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].offset < ranges[j].offset
+	})
+
+	merged := []damagedRange{ranges[0]}
+	for _, rng := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if rng.offset <= last.offset+last.length {
+			if end := rng.offset + rng.length; end > last.offset+last.length {
+				last.length = end - last.offset
+			}
+			continue
+		}
+		merged = append(merged, rng)
+	}
+
+	return merged
+}
+
+// skipBlob returns true if the blob with the given index in file must not be
+// written. This is the case if it is already stored in the existing file, or
+// if it only contains zeros, which are represented by holes in sparse files.
+func (r *fileRestorer) skipBlob(file *fileInfo, index int, id restic.ID) bool {
+	if file.matches != nil {
+		return file.matches[index]
+	}
+	return r.sparse && id.Equal(r.zeroChunk)
+}
+
+func (r *fileRestorer) sanitizeError(file *fileInfo, err error) error {
+	if err != nil {
+		err = r.Error(file.location, err)
+	}
+	return err
 }
 
 const maxBufferSize = 4 * 1024 * 1024
@@ -187,9 +440,8 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 	// calculate pack byte range and blob->[]files->[]offsets mappings
 	start, end := int64(math.MaxInt64), int64(0)
 	blobs := make(map[restic.ID]struct {
-		offset int64                 // offset of the blob in the pack
-		length int                   // length of the blob
-		files  map[*fileInfo][]int64 // file -> offsets (plural!) of the blob in the file
+		blob  restic.Blob           // the blob as stored in the pack
+		files map[*fileInfo][]int64 // file -> offsets (plural!) of the blob in the file
 	})
 	for file := range pack.files {
 		addBlob := func(blob restic.Blob, fileOffset int64) {
@@ -201,8 +453,7 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 			}
 			blobInfo, ok := blobs[blob.ID]
 			if !ok {
-				blobInfo.offset = int64(blob.Offset)
-				blobInfo.length = int(blob.Length)
+				blobInfo.blob = blob
 				blobInfo.files = make(map[*fileInfo][]int64)
 				blobs[blob.ID] = blobInfo
 			}
@@ -210,11 +461,13 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 		}
 		if fileBlobs, ok := file.blobs.(restic.IDs); ok {
 			fileOffset := int64(0)
+			blobIndex := 0
 			err := r.forEachBlob(fileBlobs, func(packID restic.ID, blob restic.Blob) {
-				if packID.Equal(pack.id) {
+				if packID.Equal(pack.id) && !r.skipBlob(file, blobIndex, blob.ID) {
 					addBlob(blob, fileOffset)
 				}
-				fileOffset += int64(blob.Length) - crypto.Extension
+				blobIndex++
+				fileOffset += int64(blob.DataLength())
 			})
 			if err != nil {
 				// restoreFiles should have caught this error before
@@ -238,15 +491,13 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 		sortedBlobs = append(sortedBlobs, blobID)
 	}
 	sort.Slice(sortedBlobs, func(i, j int) bool {
-		return blobs[sortedBlobs[i]].offset < blobs[sortedBlobs[j]].offset
+		return blobs[sortedBlobs[i]].blob.Offset < blobs[sortedBlobs[j]].blob.Offset
 	})
 
-	sanitizeError := func(file *fileInfo, err error) error {
-		if err != nil {
-			err = r.Error(file.location, err)
-		}
-		return err
-	}
+	// the blobs which have been processed, the load may be retried
+	processed := restic.NewIDSet()
+	// set if restoring the files failed, as opposed to loading the pack
+	var abortErr error
 
 	h := restic.Handle{Type: restic.PackFile, Name: pack.id.String()}
 	err := r.packLoader(ctx, h, int(end-start), start, func(rd io.Reader) error {
@@ -259,24 +510,32 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 		var blobData, buf []byte
 		for _, blobID := range sortedBlobs {
 			blob := blobs[blobID]
-			_, err := bufRd.Discard(int(blob.offset - currentBlobEnd))
+			_, err := bufRd.Discard(int(int64(blob.blob.Offset) - currentBlobEnd))
 			if err != nil {
 				return err
 			}
-			buf, err = r.downloadBlob(bufRd, blobID, blob.length, buf)
+			buf, err = r.downloadBlob(bufRd, blobID, int(blob.blob.Length), buf)
 			if err != nil {
 				return err
 			}
-			blobData, err = r.decryptBlob(blobID, buf)
+			currentBlobEnd = int64(blob.blob.Offset + blob.blob.Length)
+			blobData, err = r.decryptBlob(blob.blob, buf)
 			if err != nil {
-				for file := range blob.files {
-					if errFile := sanitizeError(file, err); errFile != nil {
+				for file, offsets := range blob.files {
+					if r.ignoreMissing {
+						for _, offset := range offsets {
+							r.addDamage(file, offset, int64(blob.blob.DataLength()), err)
+						}
+						continue
+					}
+					if errFile := r.sanitizeError(file, err); errFile != nil {
+						abortErr = errFile
 						return errFile
 					}
 				}
+				processed.Insert(blobID)
 				continue
 			}
-			currentBlobEnd = blob.offset + int64(blob.length)
 			for file, offsets := range blob.files {
 				for _, offset := range offsets {
 					writeToFile := func() error {
@@ -295,21 +554,46 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 							file.inProgress = true
 							createSize = file.size
 						}
-						return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize)
+						return r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, r.sparse)
+					}
+					err := writeToFile()
+					if err == nil {
+						r.completeBlob(file.location, uint64(len(blobData)))
 					}
-					err := sanitizeError(file, writeToFile())
+					err = r.sanitizeError(file, err)
 					if err != nil {
+						abortErr = err
 						return err
 					}
 				}
 			}
+			processed.Insert(blobID)
 		}
 		return nil
 	})
 
+	if abortErr != nil {
+		return abortErr
+	}
+
+	if err != nil && r.ignoreMissing {
+		// all blobs which have not been written are lost
+		for blobID, blob := range blobs {
+			if processed.Has(blobID) {
+				continue
+			}
+			for file, offsets := range blob.files {
+				for _, offset := range offsets {
+					r.addDamage(file, offset, int64(blob.blob.DataLength()), err)
+				}
+			}
+		}
+		return nil
+	}
+
 	if err != nil {
 		for file := range pack.files {
-			if errFile := sanitizeError(file, err); errFile != nil {
+			if errFile := r.sanitizeError(file, err); errFile != nil {
 				return errFile
 			}
 		}
@@ -338,19 +622,24 @@ func (r *fileRestorer) downloadBlob(rd io.Reader, blobID restic.ID, length int,
 	return buf, nil
 }
 
-func (r *fileRestorer) decryptBlob(blobID restic.ID, buf []byte) ([]byte, error) {
+func (r *fileRestorer) decryptBlob(blob restic.Blob, buf []byte) ([]byte, error) {
 	// TODO reconcile with Repository#loadBlob implementation
 
 	// decrypt
 	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
 	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
 	if err != nil {
-		return nil, errors.Errorf("decrypting blob %v failed: %v", blobID, err)
+		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
+	}
+
+	plaintext, err = repository.DecompressBlob(blob, plaintext)
+	if err != nil {
+		return nil, errors.Errorf("decompressing blob %v failed: %v", blob.ID, err)
 	}
 
 	// check hash
-	if !restic.Hash(plaintext).Equal(blobID) {
-		return nil, errors.Errorf("blob %v returned invalid hash", blobID)
+	if !restic.Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
 	}
 
 	return plaintext, nil
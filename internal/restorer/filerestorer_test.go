@@ -9,6 +9,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
@@ -358,3 +359,124 @@ func testPartialDownloadError(t *testing.T, part int) {
 	rtest.OK(t, err)
 	verifyRestore(t, r, repo, dryrun)
 }
+
+func TestFileRestorerSparse(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	zeros := string(make([]byte, chunker.MinSize))
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{zeros, "zeros"},
+				{"data1-2", "pack1"},
+				{zeros, "zeros"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{zeros, "zeros"},
+				{zeros, "zeros"},
+			},
+		},
+	}
+
+	repo := newTestRepo(content)
+	for _, file := range repo.files {
+		file.size = int64(len(repo.fileContent(file)))
+	}
+
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		if h.Name == repo.packsNameToID["zeros"].String() {
+			t.Errorf("pack containing only the zero chunk was loaded")
+		}
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup)
+	r.files = repo.files
+	r.sparse = true
+
+	err := r.restoreFiles(context.TODO(), false)
+	rtest.OK(t, err)
+	verifyRestore(t, r, repo, false)
+}
+
+func TestFileRestorerIgnoreMissing(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	content := []TestFile{
+		{
+			name: "missing",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"missing-blob", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "broken",
+			blobs: []TestBlob{
+				{"data2-1", "broken"},
+				{"data2-2", "broken"},
+			},
+		},
+		{
+			name: "intact",
+			blobs: []TestBlob{
+				{"data3-1", "pack1"},
+			},
+		},
+	}
+
+	repo := newTestRepo(content)
+	for _, file := range repo.files {
+		file.size = int64(len(repo.fileContent(file)))
+	}
+	delete(repo.blobs, restic.Hash([]byte("missing-blob")))
+
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		if h.Name == repo.packsNameToID["broken"].String() {
+			return errors.New("pack is damaged")
+		}
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.Lookup)
+	r.files = repo.files
+	r.ignoreMissing = true
+
+	type damage struct {
+		location       string
+		offset, length int64
+	}
+	var damaged []damage
+	r.reportDamage = func(location string, offset, length int64, err error) {
+		rtest.Assert(t, err != nil, "no error reported for damaged file %v", location)
+		damaged = append(damaged, damage{location, offset, length})
+	}
+
+	err := r.restoreFiles(context.TODO(), false)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, []damage{
+		{"missing", 7, 12},
+		{"broken", 0, 14},
+	}, damaged)
+
+	for name, want := range map[string]string{
+		"missing": "data1-1" + string(make([]byte, 12)) + "data1-2",
+		"broken":  string(make([]byte, 14)),
+		"intact":  "data3-1",
+	} {
+		data, err := ioutil.ReadFile(r.targetPath(name))
+		rtest.OK(t, err)
+		rtest.Equals(t, want, string(data))
+	}
+}
@@ -34,7 +34,11 @@ func newFilesWriter(count int) *filesWriter {
 	}
 }
 
-func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64) error {
+// writeToFile writes blob at offset into the file at path. If createSize is
+// not negative, the file is created with this size. For sparse files, the size
+// is only set using truncate, so that the parts of the file which are not
+// written remain holes.
+func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool) error {
 	bucket := &w.buckets[uint(xxhash.Sum64String(path))%uint(len(w.buckets))]
 
 	acquireWriter := func() (*os.File, error) {
@@ -61,7 +65,15 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		bucket.files[path] = wr
 		bucket.users[path] = 1
 
-		if createSize >= 0 {
+		if createSize >= 0 && sparse {
+			err = wr.Truncate(createSize)
+			if err != nil {
+				delete(bucket.files, path)
+				delete(bucket.users, path)
+				_ = wr.Close()
+				return nil, err
+			}
+		} else if createSize >= 0 {
 			err := preallocateFile(wr, createSize)
 			if err != nil {
 				// Just log the preallocate error but don't let it cause the restore process to fail.
@@ -94,7 +106,9 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		return err
 	}
 
-	_, err = wr.WriteAt(blob, offset)
+	if len(blob) > 0 {
+		_, err = wr.WriteAt(blob, offset)
+	}
 
 	if err != nil {
 		// ignore subsequent errors
@@ -0,0 +1,100 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// restoreMetadataOnly restores the metadata of the items of snapshot sn which
+// already exist below dst. The content of files is neither downloaded nor
+// modified, missing items are not created.
+func (res *Restorer) restoreMetadataOnly(ctx context.Context, sn *restic.Snapshot, dst string, dryrun bool) error {
+	debug.Log("metadata-only pass for %q", dst)
+
+	visit := func(node *restic.Node, target, location string) error {
+		differences, err := res.compareMetadata(node, target)
+		if err != nil {
+			return err
+		}
+		if len(differences) > 0 {
+			res.ReportMismatch(location, differences)
+		}
+
+		switch {
+		case len(differences) == 1 && (differences[0] == "missing" || differences[0] == "type"):
+			// the item cannot be updated
+			return nil
+		case dryrun:
+			return nil
+		}
+
+		err = res.restoreNodeMetadataTo(node, target, location)
+		if err == nil {
+			res.CompleteItem(location, node)
+		}
+		return err
+	}
+
+	_, err := res.traverseTree(ctx, dst, string(filepath.Separator), *sn.Tree, treeVisitor{
+		enterDir:  func(node *restic.Node, target, location string) error { return nil },
+		visitNode: visit,
+		leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error {
+			return visit(node, target, location)
+		},
+	})
+	return err
+}
+
+// compareMetadata returns the list of differences between the metadata of node
+// and the existing item at target, which is "missing" if the item does not
+// exist and "type" if it has a different type. Otherwise, the list contains
+// "mode", "owner", "mtime" and "xattrs" for the respective differences.
+// Extended attributes which only exist at target are ignored, as they are not
+// removed when restoring the metadata.
+func (res *Restorer) compareMetadata(node *restic.Node, target string) ([]string, error) {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return []string{"missing"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := restic.NodeFromFileInfo(target, fi)
+	if err != nil {
+		return nil, err
+	}
+
+	node = res.metadataNode(node)
+	if existing.Type != node.Type {
+		return []string{"type"}, nil
+	}
+
+	// only the permission bits are restored, the type is compared above
+	const modeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+	var differences []string
+	if node.Type != "symlink" && existing.Mode&modeMask != node.Mode&modeMask {
+		differences = append(differences, "mode")
+	}
+	if existing.UID != node.UID || existing.GID != node.GID {
+		differences = append(differences, "owner")
+	}
+	if !existing.ModTime.Equal(node.ModTime) {
+		differences = append(differences, "mtime")
+	}
+	for _, attr := range node.ExtendedAttributes {
+		value := existing.GetExtendedAttribute(attr.Name)
+		if !bytes.Equal(value, attr.Value) && !restic.SameACL(attr.Name, value, attr.Value) {
+			differences = append(differences, "xattrs")
+			break
+		}
+	}
+
+	return differences, nil
+}
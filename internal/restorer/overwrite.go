@@ -0,0 +1,196 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// OverwriteBehavior controls how files which already exist at the restore
+// target are handled.
+type OverwriteBehavior int
+
+// Constants for all possible overwrite behaviors.
+const (
+	// OverwriteAlways recreates all existing files.
+	OverwriteAlways OverwriteBehavior = iota
+	// OverwriteIfChanged only writes the parts of existing files which
+	// differ from the snapshot.
+	OverwriteIfChanged
+	// OverwriteIfNewer only overwrites existing files which are older than
+	// the file in the snapshot.
+	OverwriteIfNewer
+	// OverwriteNever keeps all existing files.
+	OverwriteNever
+	OverwriteInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *OverwriteBehavior) Set(s string) error {
+	switch s {
+	case "always":
+		*c = OverwriteAlways
+	case "if-changed":
+		*c = OverwriteIfChanged
+	case "if-newer":
+		*c = OverwriteIfNewer
+	case "never":
+		*c = OverwriteNever
+	default:
+		*c = OverwriteInvalid
+		return fmt.Errorf("invalid overwrite behavior %q, must be one of (always|if-changed|if-newer|never)", s)
+	}
+
+	return nil
+}
+
+func (c *OverwriteBehavior) String() string {
+	switch *c {
+	case OverwriteAlways:
+		return "always"
+	case OverwriteIfChanged:
+		return "if-changed"
+	case OverwriteIfNewer:
+		return "if-newer"
+	case OverwriteNever:
+		return "never"
+	default:
+		return "invalid"
+	}
+}
+
+// Type returns the type name used in the help output of pflag.
+func (c *OverwriteBehavior) Type() string {
+	return "behavior"
+}
+
+// keepExisting returns true if the existing item at target must not be
+// replaced by node according to the overwrite behavior.
+func (res *Restorer) keepExisting(node *restic.Node, target string) (bool, error) {
+	if res.Overwrite == OverwriteAlways || res.Overwrite == OverwriteIfChanged {
+		return false, nil
+	}
+
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if res.Overwrite == OverwriteNever {
+		return true, nil
+	}
+	// OverwriteIfNewer
+	return !node.ModTime.After(fi.ModTime()), nil
+}
+
+// compareExisting compares the existing file at target with the file
+// described by node. The returned list contains for each blob of the file,
+// whether it is already stored correctly in the existing file. If the file
+// does not exist, nil is returned. unchanged is set if the file is presumed
+// to be unchanged based on its size and modification time.
+func (res *Restorer) compareExisting(ctx context.Context, node *restic.Node, target string) (matches []bool, unchanged bool, err error) {
+	fi, err := fs.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.Mode().IsRegular() {
+		// cannot restore the file in place
+		return nil, false, nil
+	}
+
+	// do not follow a symlink which replaced the file in the meantime
+	f, err := fs.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err = f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, false, nil
+	}
+	if uint64(fi.Size()) == node.Size && fi.ModTime().Equal(node.ModTime) {
+		return nil, true, nil
+	}
+
+	matches = make([]bool, len(node.Content))
+	var buf []byte
+	offset := int64(0)
+	for i, id := range node.Content {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+
+		size, found := res.repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			// the restore will fail later on, just recreate the file
+			return nil, false, nil
+		}
+
+		if cap(buf) < int(size) {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+
+		_, err = f.ReadAt(buf, offset)
+		if err == io.EOF {
+			// all remaining blobs are missing
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		matches[i] = restic.Hash(buf).Equal(id)
+		offset += int64(size)
+	}
+
+	debug.Log("%v: %d of %d blobs match", target, countTrue(matches), len(matches))
+	return matches, false, nil
+}
+
+// removeSpecialFile removes the item at target if it is neither a regular
+// file nor a directory. Otherwise restoring a file at target would follow an
+// existing symlink and write to the file it points to, which may be located
+// outside of the restore target.
+func (res *Restorer) removeSpecialFile(target string, dryrun bool) error {
+	fi, err := fs.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsRegular() || fi.IsDir() || dryrun {
+		return nil
+	}
+
+	debug.Log("removing existing %v at %q", fi.Mode(), target)
+	return fs.Remove(target)
+}
+
+func countTrue(list []bool) int {
+	count := 0
+	for _, v := range list {
+		if v {
+			count++
+		}
+	}
+	return count
+}
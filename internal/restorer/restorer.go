@@ -12,51 +12,168 @@ import (
 	"github.com/restic/restic/internal/restic"
 )
 
-// Restorer is used to restore a snapshot to a directory.
+// Restorer is used to restore one or more snapshots to a directory.
 type Restorer struct {
-	repo restic.Repository
-	sn   *restic.Snapshot
+	repo      restic.Repository
+	snapshots restic.Snapshots
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// Warn is called for problems which do not prevent restoring an item,
+	// for example extended attributes which cannot be set.
+	Warn func(location string, err error)
+
+	// Sparse configures whether files are restored as sparse files, parts of
+	// files which only contain zeros are then not written.
+	Sparse bool
+	// Overwrite configures how files which already exist in the target
+	// directory are handled.
+	Overwrite OverwriteBehavior
+	// OwnerMapping translates the owner of the restored items, it may be nil.
+	// It also translates the IDs within POSIX ACLs.
+	OwnerMapping *restic.OwnerMapping
+	// SkipACLs configures that the POSIX ACLs stored in the snapshot are not
+	// restored.
+	SkipACLs bool
+	// XattrFilter selects the extended attributes which are restored, it may
+	// be nil.
+	XattrFilter *restic.XattrFilter
+	// RestoreImmutableFlags configures that the inode flags immutable and
+	// append-only are restored. They are skipped by default, as afterwards
+	// the restored items cannot be changed or removed by later restores.
+	RestoreImmutableFlags bool
+	// StripComponents configures how many leading path components are
+	// removed from the location of all items within the snapshot. Items
+	// with fewer path components are not restored.
+	StripComponents int
+	// PathMappings rewrites the locations of the items within the snapshot,
+	// it is applied before StripComponents.
+	PathMappings []PathMapping
+	// Delete configures whether files and directories in the target directory
+	// which are not contained in the snapshot are removed.
+	Delete bool
+	// DeleteItem is called for each item which is removed from the target
+	// directory, for a dry run it is called for each item which would be
+	// removed.
+	DeleteItem func(location string, isDir bool)
+	// IgnoreMissing configures that parts of files which are missing from
+	// the repository or cannot be loaded are filled with zeros instead of
+	// aborting the restore. The damaged parts are passed to ReportDamage.
+	IgnoreMissing bool
+	// ReportDamage is called for each part of a file which could not be
+	// restored, if IgnoreMissing is set.
+	ReportDamage func(location string, offset, length int64, err error)
+	// MetadataOnly configures that only the metadata of existing items in the
+	// target directory is restored, no data is downloaded.
+	MetadataOnly bool
+	// ReportMismatch is called for each item whose metadata differs from the
+	// snapshot if MetadataOnly is set, see compareMetadata for the
+	// differences.
+	ReportMismatch func(location string, differences []string)
+
+	// ReportTotal is called once the number of files and bytes to restore is
+	// known.
+	ReportTotal func(files, bytes uint64)
+
+	// StartPack is called when a worker starts to download a pack file.
+	StartPack func(packID restic.ID)
+
+	// CompletePack is called when a pack file has been processed.
+	CompletePack func(packID restic.ID)
+
+	// CompleteBlob is called for all parts of files which have been
+	// restored, including the parts which did not need to be written.
+	//
+	// CompleteBlob may be called asynchronously from several different
+	// goroutines!
+	CompleteBlob func(location string, bytes uint64)
+
+	// CompleteItem is called for all items once they and their metadata have
+	// been restored successfully.
+	CompleteItem func(location string, node *restic.Node)
 }
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
 
 // NewRestorer creates a restorer preloaded with the content from the snapshot id.
 func NewRestorer(ctx context.Context, repo restic.Repository, id restic.ID) (*Restorer, error) {
+	return NewMultiRestorer(ctx, repo, restic.IDs{id})
+}
+
+// NewMultiRestorer creates a restorer for several snapshots. Each snapshot is
+// restored to a subdirectory of the target directory named after the short
+// snapshot ID, the files of all snapshots are restored together such that
+// each pack file is downloaded only once.
+func NewMultiRestorer(ctx context.Context, repo restic.Repository, ids restic.IDs) (*Restorer, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("no snapshot specified")
+	}
+
 	r := &Restorer{
 		repo:         repo,
 		Error:        restorerAbortOnAllErrors,
 		SelectFilter: func(string, string, *restic.Node) (bool, bool) { return true, true },
+		Warn:         func(string, error) {},
+		DeleteItem:   func(string, bool) {},
+		ReportDamage: func(string, int64, int64, error) {},
+		ReportTotal:  func(uint64, uint64) {},
+		StartPack:    func(restic.ID) {},
+		CompletePack: func(restic.ID) {},
+		CompleteBlob: func(string, uint64) {},
+		CompleteItem: func(string, *restic.Node) {},
+
+		ReportMismatch: func(string, []string) {},
 	}
 
-	var err error
-
-	r.sn, err = restic.LoadSnapshot(ctx, repo, id)
-	if err != nil {
-		return nil, err
+	for _, id := range ids {
+		sn, err := restic.LoadSnapshot(ctx, repo, id)
+		if err != nil {
+			return nil, err
+		}
+		r.snapshots = append(r.snapshots, sn)
 	}
 
 	return r, nil
 }
 
+// snapshotDir returns the directory within the target directory to which sn
+// is restored, relative to the target directory.
+func (res *Restorer) snapshotDir(sn *restic.Snapshot) string {
+	if len(res.snapshots) == 1 {
+		return ""
+	}
+	return sn.ID().Str()
+}
+
 type treeVisitor struct {
 	enterDir  func(node *restic.Node, target, location string) error
 	visitNode func(node *restic.Node, target, location string) error
-	leaveDir  func(node *restic.Node, target, location string) error
+	// leaveDir is called with the names of all items contained in the
+	// directory in the snapshot, expectedFilenames is nil if the content of
+	// the directory was not visited.
+	leaveDir func(node *restic.Node, target, location string, expectedFilenames []string) error
 }
 
 // traverseTree traverses a tree from the repo and calls treeVisitor.
-// target is the path in the file system, location within the snapshot.
-func (res *Restorer) traverseTree(ctx context.Context, target, location string, treeID restic.ID, visitor treeVisitor) (hasRestored bool, err error) {
-	debug.Log("%v %v %v", target, location, treeID)
+// dst is the target directory in the file system, location the path of the
+// tree within the snapshot.
+func (res *Restorer) traverseTree(ctx context.Context, dst, location string, treeID restic.ID, visitor treeVisitor) (hasRestored bool, err error) {
+	_, hasRestored, err = res.traverseTreeInner(ctx, dst, location, treeID, visitor)
+	return hasRestored, err
+}
+
+// traverseTreeInner works like traverseTree, it additionally returns the
+// names of all items contained in the tree.
+func (res *Restorer) traverseTreeInner(ctx context.Context, dst, location string, treeID restic.ID, visitor treeVisitor) (filenames []string, hasRestored bool, err error) {
+	debug.Log("%v %v %v", dst, location, treeID)
 	tree, err := res.repo.LoadTree(ctx, treeID)
 	if err != nil {
 		debug.Log("error loading tree %v: %v", treeID, err)
-		return hasRestored, res.Error(location, err)
+		return nil, hasRestored, res.Error(location, err)
 	}
 
+	filenames = make([]string, 0, len(tree.Nodes))
 	for _, node := range tree.Nodes {
 
 		// ensure that the node name does not contain anything that refers to a
@@ -66,24 +183,32 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 			debug.Log("node %q has invalid name %q", node.Name, nodeName)
 			err := res.Error(location, errors.Errorf("invalid child node name %s", node.Name))
 			if err != nil {
-				return hasRestored, err
+				return nil, hasRestored, err
 			}
 			continue
 		}
 
-		nodeTarget := filepath.Join(target, nodeName)
 		nodeLocation := filepath.Join(location, nodeName)
+		// items which are not restored themselves, for example because all of
+		// their path components are stripped, are still traversed
+		targetLocation, restoreNode := res.rewriteLocation(nodeLocation)
+		nodeTarget := filepath.Join(dst, targetLocation)
 
-		if target == nodeTarget || !fs.HasPathPrefix(target, nodeTarget) {
-			debug.Log("target: %v %v", target, nodeTarget)
+		if restoreNode && (dst == nodeTarget || !fs.HasPathPrefix(dst, nodeTarget)) {
+			debug.Log("target: %v %v", dst, nodeTarget)
 			debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
 			err := res.Error(nodeLocation, errors.New("node has invalid path"))
 			if err != nil {
-				return hasRestored, err
+				return nil, hasRestored, err
 			}
 			continue
 		}
 
+		// the name of items which are not restored, for example sockets or
+		// items rejected by the filter, must still be known to not delete
+		// them from the target directory
+		filenames = append(filenames, nodeName)
+
 		// sockets cannot be restored
 		if node.Type == "socket" {
 			continue
@@ -91,6 +216,7 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
 		debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
+		selectedForRestore = selectedForRestore && restoreNode
 
 		if selectedForRestore {
 			hasRestored = true
@@ -105,25 +231,26 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 
 		if node.Type == "dir" {
 			if node.Subtree == nil {
-				return hasRestored, errors.Errorf("Dir without subtree in tree %v", treeID.Str())
+				return nil, hasRestored, errors.Errorf("Dir without subtree in tree %v", treeID.Str())
 			}
 
 			if selectedForRestore {
 				err = sanitizeError(visitor.enterDir(node, nodeTarget, nodeLocation))
 				if err != nil {
-					return hasRestored, err
+					return nil, hasRestored, err
 				}
 			}
 
 			// keep track of restored child status
 			// so metadata of the current directory are restored on leaveDir
 			childHasRestored := false
+			var childFilenames []string
 
 			if childMayBeSelected {
-				childHasRestored, err = res.traverseTree(ctx, nodeTarget, nodeLocation, *node.Subtree, visitor)
+				childFilenames, childHasRestored, err = res.traverseTreeInner(ctx, dst, nodeLocation, *node.Subtree, visitor)
 				err = sanitizeError(err)
 				if err != nil {
-					return hasRestored, err
+					return nil, hasRestored, err
 				}
 				// inform the parent directory to restore parent metadata on leaveDir if needed
 				if childHasRestored {
@@ -133,10 +260,10 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 
 			// metadata need to be restore when leaving the directory in both cases
 			// selected for restore or any child of any subtree have been restored
-			if selectedForRestore || childHasRestored {
-				err = sanitizeError(visitor.leaveDir(node, nodeTarget, nodeLocation))
+			if restoreNode && (selectedForRestore || childHasRestored) {
+				err = sanitizeError(visitor.leaveDir(node, nodeTarget, nodeLocation, childFilenames))
 				if err != nil {
-					return hasRestored, err
+					return nil, hasRestored, err
 				}
 			}
 
@@ -146,12 +273,12 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 		if selectedForRestore {
 			err = sanitizeError(visitor.visitNode(node, nodeTarget, nodeLocation))
 			if err != nil {
-				return hasRestored, err
+				return nil, hasRestored, err
 			}
 		}
 	}
 
-	return hasRestored, nil
+	return filenames, hasRestored, nil
 }
 
 func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, target, location string) error {
@@ -170,13 +297,50 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
-	err := node.RestoreMetadata(target)
+	err := res.metadataNode(node).RestoreMetadata(target)
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
 	}
+
+	// the remaining metadata was restored, the file itself is fine
+	var xattrErr *restic.ExtendedAttributeError
+	if errors.As(err, &xattrErr) {
+		for _, err := range xattrErr.Errors {
+			res.Warn(location, err)
+		}
+		return nil
+	}
 	return err
 }
 
+// metadataNode returns the node with the metadata which is restored for node,
+// with the translated owner, only the extended attributes selected by
+// XattrFilter, without ACLs if SkipACLs is set and without the immutable and
+// append-only flags unless RestoreImmutableFlags is set.
+func (res *Restorer) metadataNode(node *restic.Node) *restic.Node {
+	node = res.XattrFilter.Apply(res.OwnerMapping.Map(node))
+
+	const immutableFlags = fs.InodeFlagImmutable | fs.InodeFlagAppend
+	if !res.RestoreImmutableFlags && node.InodeFlags&immutableFlags != 0 {
+		n := *node
+		n.InodeFlags &^= immutableFlags
+		node = &n
+	}
+
+	if !res.SkipACLs {
+		return node
+	}
+
+	n := *node
+	n.ExtendedAttributes = nil
+	for _, attr := range node.ExtendedAttributes {
+		if !restic.IsACLAttribute(attr.Name) {
+			n.ExtendedAttributes = append(n.ExtendedAttributes, attr)
+		}
+	}
+	return &n
+}
+
 func (res *Restorer) restoreHardlinkAt(node *restic.Node, target, path, location string) error {
 	if err := fs.Remove(path); !os.IsNotExist(err) {
 		return errors.Wrap(err, "RemoveCreateHardlink")
@@ -202,8 +366,9 @@ func (res *Restorer) restoreEmptyFileAt(node *restic.Node, target, location stri
 	return res.restoreNodeMetadataTo(node, target, location)
 }
 
-// RestoreTo creates the directories and files in the snapshot below dst.
-// Before an item is created, res.Filter is called.
+// RestoreTo creates the directories and files in the snapshot below dst. If
+// several snapshots are restored, each one is restored to its own
+// subdirectory of dst. Before an item is created, res.Filter is called.
 func (res *Restorer) RestoreTo(ctx context.Context, dst string, dryrun bool) error {
 	var err error
 	if !filepath.IsAbs(dst) {
@@ -213,15 +378,90 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string, dryrun bool) err
 		}
 	}
 
-	idx := restic.NewHardlinkIndex()
+	if res.Delete && res.rewritesPaths() {
+		return errors.New("deleting files is not supported if paths are rewritten")
+	}
+
+	if res.MetadataOnly {
+		if res.Delete {
+			return errors.New("deleting files is not supported when only restoring metadata")
+		}
+		for _, sn := range res.snapshots {
+			err = res.restoreMetadataOnly(ctx, sn, filepath.Join(dst, res.snapshotDir(sn)), dryrun)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
+	// the files of all snapshots are restored together, such that blobs
+	// needed by several snapshots are only downloaded once
 	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), res.repo.Index().Lookup)
 	filerestorer.Error = res.Error
+	filerestorer.sparse = res.Sparse
+	filerestorer.startPack = res.StartPack
+	filerestorer.completePack = res.CompletePack
+	filerestorer.completeBlob = res.CompleteBlob
+	filerestorer.ignoreMissing = res.IgnoreMissing
+	filerestorer.reportDamage = res.ReportDamage
+
+	// number of files and bytes to restore, for the progress report
+	var totalFiles, totalBytes uint64
+
+	// the state of the restore of each snapshot, the hardlink index maps
+	// the inode of hardlinked files to the path of the first restored link,
+	// keep contains the existing items which are kept according to the
+	// overwrite behavior
+	type snapshotState struct {
+		dst  string
+		idx  *restic.HardlinkIndex
+		keep map[string]struct{}
+	}
+	states := make([]snapshotState, 0, len(res.snapshots))
 
+	for _, sn := range res.snapshots {
+		state := snapshotState{
+			dst:  filepath.Join(dst, res.snapshotDir(sn)),
+			idx:  restic.NewHardlinkIndex(),
+			keep: make(map[string]struct{}),
+		}
+		states = append(states, state)
+
+		err = res.collectFiles(ctx, sn, state.dst, state.idx, state.keep, filerestorer, &totalFiles, &totalBytes, dryrun)
+		if err != nil {
+			return err
+		}
+	}
+
+	res.ReportTotal(totalFiles, totalBytes)
+
+	err = filerestorer.restoreFiles(ctx, dryrun)
+	if err != nil {
+		return err
+	}
+
+	if dryrun {
+		return nil
+	}
+
+	for i, sn := range res.snapshots {
+		err = res.restoreMetadata(ctx, sn, states[i].dst, states[i].idx, states[i].keep)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// collectFiles creates the directories of the snapshot sn below dst and adds
+// all files to restore to filerestorer.
+func (res *Restorer) collectFiles(ctx context.Context, sn *restic.Snapshot, dst string, idx *restic.HardlinkIndex, keep map[string]struct{}, filerestorer *fileRestorer, totalFiles, totalBytes *uint64, dryrun bool) error {
 	debug.Log("first pass for %q", dst)
 
 	// first tree pass: create directories and collect all files to restore
-	_, err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+	rootFilenames, _, err := res.traverseTreeInner(ctx, dst, string(filepath.Separator), *sn.Tree, treeVisitor{
 		enterDir: func(node *restic.Node, target, location string) error {
 			debug.Log("first pass, enterDir: mkdir %q, leaveDir should restore metadata", location)
 			// create dir with default permissions
@@ -243,10 +483,29 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string, dryrun bool) err
 				}
 			}
 
+			keepExisting, err := res.keepExisting(node, target)
+			if err != nil {
+				return err
+			}
+			if node.Type == "file" {
+				*totalFiles++
+			}
+
+			if keepExisting {
+				debug.Log("keeping existing %q", location)
+				keep[location] = struct{}{}
+				return nil
+			}
+
 			if node.Type != "file" {
 				return nil
 			}
 
+			err = res.removeSpecialFile(target, dryrun)
+			if err != nil {
+				return err
+			}
+
 			if node.Size == 0 {
 				return nil // deal with empty files later
 			}
@@ -255,76 +514,213 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string, dryrun bool) err
 				if idx.Has(node.Inode, node.DeviceID) {
 					return nil
 				}
-				idx.Add(node.Inode, node.DeviceID, location)
+				idx.Add(node.Inode, node.DeviceID, target)
 			}
 
-			filerestorer.addFile(location, node.Content, int64(node.Size))
+			*totalBytes += node.Size
+
+			var matches []bool
+			if res.Overwrite == OverwriteIfChanged {
+				var unchanged bool
+				matches, unchanged, err = res.compareExisting(ctx, node, target)
+				if err != nil {
+					return err
+				}
+				if unchanged {
+					// only the metadata is restored in the second pass
+					debug.Log("existing %q is unchanged", location)
+					res.CompleteBlob(location, node.Size)
+					return nil
+				}
+				if matches != nil && !dryrun {
+					// restore the file in place
+					err = os.Truncate(target, int64(node.Size))
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// the location of the file within the target directory
+			fileLocation, _ := res.rewriteLocation(location)
+			filerestorer.addFile(filepath.Join(res.snapshotDir(sn), fileLocation), node.Content, int64(node.Size), matches)
 
 			return nil
 		},
-		leaveDir: func(node *restic.Node, target, location string) error {
-			return nil
+		leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error {
+			return res.removeUnexpectedFiles(target, location, expectedFilenames, dryrun)
 		},
 	})
 	if err != nil {
 		return err
 	}
 
-	err = filerestorer.restoreFiles(ctx, dryrun)
+	err = res.removeUnexpectedFiles(dst, string(filepath.Separator), rootFilenames, dryrun)
 	if err != nil {
-		return err
+		return res.Error(string(filepath.Separator), err)
 	}
 
-	if dryrun {
-		return nil
-	}
+	return nil
+}
 
+// restoreMetadata restores the special files and the metadata of all items of
+// the snapshot sn below dst, after the content of the files was restored.
+func (res *Restorer) restoreMetadata(ctx context.Context, sn *restic.Snapshot, dst string, idx *restic.HardlinkIndex, keep map[string]struct{}) error {
 	debug.Log("second pass for %q", dst)
 
 	// second tree pass: restore special files and filesystem metadata
-	_, err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+	_, err := res.traverseTree(ctx, dst, string(filepath.Separator), *sn.Tree, treeVisitor{
 		enterDir: func(node *restic.Node, target, location string) error {
 			return nil
 		},
 		visitNode: func(node *restic.Node, target, location string) error {
 			debug.Log("second pass, visitNode: restore node %q", location)
-			if node.Type != "file" {
-				return res.restoreNodeTo(ctx, node, target, location)
+			err := res.restoreNode(ctx, node, target, location, idx, keep)
+			if err == nil {
+				res.CompleteItem(location, node)
 			}
-
-			// create empty files, but not hardlinks to empty files
-			if node.Size == 0 && (node.Links < 2 || !idx.Has(node.Inode, node.DeviceID)) {
-				if node.Links > 1 {
-					idx.Add(node.Inode, node.DeviceID, location)
-				}
-				return res.restoreEmptyFileAt(node, target, location)
-			}
-
-			if idx.Has(node.Inode, node.DeviceID) && idx.GetFilename(node.Inode, node.DeviceID) != location {
-				return res.restoreHardlinkAt(node, filerestorer.targetPath(idx.GetFilename(node.Inode, node.DeviceID)), target, location)
-			}
-
-			return res.restoreNodeMetadataTo(node, target, location)
+			return err
 		},
-		leaveDir: func(node *restic.Node, target, location string) error {
+		leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error {
 			debug.Log("second pass, leaveDir restore metadata %q", location)
-			return res.restoreNodeMetadataTo(node, target, location)
+			err := res.restoreNodeMetadataTo(node, target, location)
+			if err == nil {
+				res.CompleteItem(location, node)
+			}
+			return err
 		},
 	})
 	return err
 }
 
-// Snapshot returns the snapshot this restorer is configured to use.
+// restoreNode restores a node which is not a directory in the second pass of
+// RestoreTo.
+func (res *Restorer) restoreNode(ctx context.Context, node *restic.Node, target, location string, idx *restic.HardlinkIndex, keep map[string]struct{}) error {
+	if _, ok := keep[location]; ok {
+		return nil
+	}
+
+	if node.Type != "file" {
+		return res.restoreNodeTo(ctx, node, target, location)
+	}
+
+	// create empty files, but not hardlinks to empty files
+	if node.Size == 0 && (node.Links < 2 || !idx.Has(node.Inode, node.DeviceID)) {
+		if node.Links > 1 {
+			idx.Add(node.Inode, node.DeviceID, target)
+		}
+		return res.restoreEmptyFileAt(node, target, location)
+	}
+
+	if idx.Has(node.Inode, node.DeviceID) && idx.GetFilename(node.Inode, node.DeviceID) != target {
+		return res.restoreHardlinkAt(node, idx.GetFilename(node.Inode, node.DeviceID), target, location)
+	}
+
+	return res.restoreNodeMetadataTo(node, target, location)
+}
+
+// removeUnexpectedFiles removes all items from the directory target which are
+// not contained in expectedFilenames, if res.Delete is set. Items rejected by
+// res.SelectFilter are kept.
+func (res *Restorer) removeUnexpectedFiles(target, location string, expectedFilenames []string, dryrun bool) error {
+	if !res.Delete || expectedFilenames == nil {
+		return nil
+	}
+
+	f, err := fs.Open(target)
+	if os.IsNotExist(err) {
+		// nothing to delete, for example for a dry run
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Open")
+	}
+	entries, err := f.Readdirnames(-1)
+	_ = f.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Readdirnames %v failed", target)
+	}
+
+	keep := make(map[string]struct{}, len(expectedFilenames))
+	for _, name := range expectedFilenames {
+		keep[name] = struct{}{}
+	}
+
+	for _, name := range entries {
+		if _, ok := keep[name]; ok {
+			continue
+		}
+
+		nodeTarget := filepath.Join(target, name)
+		nodeLocation := filepath.Join(location, name)
+
+		fi, err := fs.Lstat(nodeTarget)
+		if err != nil {
+			return err
+		}
+		node := &restic.Node{Name: name, Type: "file", Mode: fi.Mode()}
+		if fi.IsDir() {
+			node.Type = "dir"
+		}
+
+		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
+		if !selectedForRestore {
+			if childMayBeSelected {
+				// some items within the directory may be selected
+				err = res.removeUnexpectedFiles(nodeTarget, nodeLocation, []string{}, dryrun)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		debug.Log("removing %q which is not contained in the snapshot", nodeLocation)
+		res.DeleteItem(nodeLocation, fi.IsDir())
+		if dryrun {
+			continue
+		}
+
+		err = fs.RemoveAll(nodeTarget)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns the snapshot this restorer is configured to use. If
+// several snapshots are restored, the first one is returned.
 func (res *Restorer) Snapshot() *restic.Snapshot {
-	return res.sn
+	return res.snapshots[0]
+}
+
+// Snapshots returns all snapshots this restorer is configured to use.
+func (res *Restorer) Snapshots() restic.Snapshots {
+	return res.snapshots
 }
 
 // VerifyFiles reads all snapshot files and verifies their contents
 func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
+	count := 0
+	for _, sn := range res.snapshots {
+		n, err := res.verifySnapshotFiles(ctx, sn, filepath.Join(dst, res.snapshotDir(sn)))
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// verifySnapshotFiles verifies the contents of the files of snapshot sn
+// restored to dst.
+func (res *Restorer) verifySnapshotFiles(ctx context.Context, sn *restic.Snapshot, dst string) (int, error) {
 	// TODO multithreaded?
 
 	count := 0
-	_, err := res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+	_, err := res.traverseTree(ctx, dst, string(filepath.Separator), *sn.Tree, treeVisitor{
 		enterDir: func(node *restic.Node, target, location string) error { return nil },
 		visitNode: func(node *restic.Node, target, location string) error {
 			if node.Type != "file" {
@@ -363,7 +759,7 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 
 			return file.Close()
 		},
-		leaveDir: func(node *restic.Node, target, location string) error { return nil },
+		leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error { return nil },
 	})
 
 	return count, err
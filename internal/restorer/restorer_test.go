@@ -3,11 +3,14 @@ package restorer
 import (
 	"bytes"
 	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,6 +28,7 @@ type Snapshot struct {
 
 type File struct {
 	Data    string
+	Blobs   []string // if set, the content is stored as these blobs instead of Data
 	Links   uint64
 	Inode   uint64
 	Mode    os.FileMode
@@ -37,11 +41,11 @@ type Dir struct {
 	ModTime time.Time
 }
 
-func saveFile(t testing.TB, repo restic.Repository, node File) restic.ID {
+func saveFile(t testing.TB, repo restic.Repository, data string) restic.ID {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	id, _, err := repo.SaveBlob(ctx, restic.DataBlob, []byte(node.Data), restic.ID{}, false)
+	id, _, err := repo.SaveBlob(ctx, restic.DataBlob, []byte(data), restic.ID{}, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -67,8 +71,14 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 				lc = 1
 			}
 			fc := []restic.ID{}
-			if len(n.(File).Data) > 0 {
-				fc = append(fc, saveFile(t, repo, node))
+			data := node.Data
+			if node.Blobs != nil {
+				data = strings.Join(node.Blobs, "")
+				for _, blob := range node.Blobs {
+					fc = append(fc, saveFile(t, repo, blob))
+				}
+			} else if len(data) > 0 {
+				fc = append(fc, saveFile(t, repo, data))
 			}
 			mode := node.Mode
 			if mode == 0 {
@@ -82,7 +92,7 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 				UID:     uint32(os.Getuid()),
 				GID:     uint32(os.Getgid()),
 				Content: fc,
-				Size:    uint64(len(n.(File).Data)),
+				Size:    uint64(len(data)),
 				Inode:   fi,
 				Links:   lc,
 			})
@@ -520,10 +530,13 @@ func checkVisitOrder(list []TreeVisit) TraverseTreeCheck {
 			}
 		}
 
+		leaveDir := check("leaveDir")
 		return treeVisitor{
 			enterDir:  check("enterDir"),
 			visitNode: check("visitNode"),
-			leaveDir:  check("leaveDir"),
+			leaveDir: func(node *restic.Node, target, location string, expectedFilenames []string) error {
+				return leaveDir(node, target, location)
+			},
 		}
 	}
 }
@@ -801,3 +814,592 @@ func TestRestorerConsistentTimestampsAndPermissions(t *testing.T) {
 		checkConsistentInfo(t, test.path, f, test.modtime, test.mode)
 	}
 }
+
+func TestRestorerOverwrite(t *testing.T) {
+	snapshotTime := time.Date(2019, time.January, 9, 1, 46, 40, 0, time.UTC)
+	olderTime := snapshotTime.Add(-time.Hour)
+	newerTime := snapshotTime.Add(time.Hour)
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"new":     File{Data: "new file", ModTime: snapshotTime},
+			"older":   File{Data: "content older", ModTime: snapshotTime},
+			"newer":   File{Data: "content newer", ModTime: snapshotTime},
+			"samemod": File{Data: "content samemod", ModTime: snapshotTime},
+		},
+	})
+
+	// existing files, samemod has the same size and modification time as in
+	// the snapshot but a different content
+	existing := []struct {
+		name, data string
+		modtime    time.Time
+	}{
+		{"older", "local older", olderTime},
+		{"newer", "local newer", newerTime},
+		{"samemod", "content SAMEMOD", snapshotTime},
+	}
+
+	snapshotFiles := map[string]string{
+		"new":     "new file",
+		"older":   "content older",
+		"newer":   "content newer",
+		"samemod": "content samemod",
+	}
+
+	for _, test := range []struct {
+		overwrite OverwriteBehavior
+		files     map[string]string
+	}{
+		{OverwriteAlways, snapshotFiles},
+		{OverwriteIfChanged, map[string]string{
+			"new":     "new file",
+			"older":   "content older",
+			"newer":   "content newer",
+			"samemod": "content SAMEMOD",
+		}},
+		{OverwriteIfNewer, map[string]string{
+			"new":     "new file",
+			"older":   "content older",
+			"newer":   "local newer",
+			"samemod": "content SAMEMOD",
+		}},
+		{OverwriteNever, map[string]string{
+			"new":     "new file",
+			"older":   "local older",
+			"newer":   "local newer",
+			"samemod": "content SAMEMOD",
+		}},
+	} {
+		t.Run(test.overwrite.String(), func(t *testing.T) {
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			for _, file := range existing {
+				filename := filepath.Join(tempdir, file.name)
+				rtest.OK(t, ioutil.WriteFile(filename, []byte(file.data), 0644))
+				rtest.OK(t, os.Chtimes(filename, file.modtime, file.modtime))
+			}
+
+			res, err := NewRestorer(context.TODO(), repo, id)
+			rtest.OK(t, err)
+			res.Overwrite = test.overwrite
+
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+			for name, want := range test.files {
+				data, err := ioutil.ReadFile(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, want, string(data))
+			}
+		})
+	}
+}
+
+type loadCountingRepo struct {
+	restic.Repository
+	be *loadCountingBackend
+}
+
+func (r loadCountingRepo) Backend() restic.Backend {
+	return r.be
+}
+
+type loadCountingBackend struct {
+	restic.Backend
+	m     sync.Mutex
+	bytes int
+}
+
+func (b *loadCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type == restic.PackFile {
+		b.m.Lock()
+		b.bytes += length
+		b.m.Unlock()
+	}
+	return b.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestRestorerDeltaRestore(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	blobs := []string{
+		strings.Repeat("a", 1000),
+		strings.Repeat("b", 1000),
+		strings.Repeat("c", 1000),
+	}
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Blobs: blobs, ModTime: time.Now().Add(-time.Hour)},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// only the second blob differs, and the local file is longer
+	filename := filepath.Join(tempdir, "file")
+	local := blobs[0] + strings.Repeat("x", 1000) + blobs[2] + "trailing data"
+	rtest.OK(t, ioutil.WriteFile(filename, []byte(local), 0644))
+
+	be := &loadCountingBackend{Backend: repo.Backend()}
+	res, err := NewRestorer(context.TODO(), loadCountingRepo{Repository: repo, be: be}, id)
+	rtest.OK(t, err)
+	res.Overwrite = OverwriteIfChanged
+
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+	data, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+	rtest.Equals(t, strings.Join(blobs, ""), string(data))
+
+	// only the differing blob must have been downloaded
+	pbs := repo.Index().Lookup(restic.BlobHandle{ID: restic.Hash([]byte(blobs[1])), Type: restic.DataBlob})
+	rtest.Equals(t, 1, len(pbs))
+	rtest.Equals(t, int(pbs[0].Length), be.bytes)
+}
+
+func listFiles(t testing.TB, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	rtest.OK(t, err)
+	sort.Strings(files)
+	return files
+}
+
+func TestRestorerDelete(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: file\n"},
+			}},
+			"foo": File{Data: "content: foo\n"},
+		},
+	})
+
+	existing := []string{"extra", "dir/extra", "extradir/file", "excluded/file"}
+
+	for _, test := range []struct {
+		name    string
+		dryrun  bool
+		filter  func(item string, dstpath string, node *restic.Node) (bool, bool)
+		files   []string
+		deleted []string
+	}{
+		{
+			name:    "all",
+			files:   []string{"dir", "dir/file", "foo"},
+			deleted: []string{"/dir/extra", "/excluded", "/extra", "/extradir"},
+		},
+		{
+			name:   "dryrun",
+			dryrun: true,
+			files: []string{"dir", "dir/extra", "excluded", "excluded/file",
+				"extra", "extradir", "extradir/file"},
+			deleted: []string{"/dir/extra", "/excluded", "/extra", "/extradir"},
+		},
+		{
+			name: "exclude",
+			filter: func(item string, dstpath string, node *restic.Node) (bool, bool) {
+				selected := item != "/excluded"
+				return selected, selected && node.Type == "dir"
+			},
+			files:   []string{"dir", "dir/file", "excluded", "excluded/file", "foo"},
+			deleted: []string{"/dir/extra", "/extra", "/extradir"},
+		},
+		{
+			name: "include",
+			filter: func(item string, dstpath string, node *restic.Node) (bool, bool) {
+				switch {
+				case item == "/dir" || strings.HasPrefix(item, "/dir/"):
+					return true, true
+				case item == "/extradir":
+					return false, true
+				case item == "/extradir/file":
+					return true, false
+				}
+				return false, false
+			},
+			files:   []string{"dir", "dir/file", "excluded", "excluded/file", "extra", "extradir"},
+			deleted: []string{"/dir/extra", "/extradir/file"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			for _, name := range existing {
+				filename := filepath.Join(tempdir, filepath.FromSlash(name))
+				rtest.OK(t, os.MkdirAll(filepath.Dir(filename), 0755))
+				rtest.OK(t, ioutil.WriteFile(filename, []byte("local"), 0644))
+			}
+
+			res, err := NewRestorer(context.TODO(), repo, id)
+			rtest.OK(t, err)
+			res.Delete = true
+			if test.filter != nil {
+				res.SelectFilter = test.filter
+			}
+			var deleted []string
+			res.DeleteItem = func(location string, isDir bool) {
+				deleted = append(deleted, filepath.ToSlash(location))
+			}
+
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, test.dryrun))
+
+			sort.Strings(deleted)
+			rtest.Equals(t, test.deleted, deleted)
+			rtest.Equals(t, test.files, listFiles(t, tempdir))
+		})
+	}
+}
+
+func TestRestorerProgress(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: file\n"},
+				"same": File{Data: "content: file\n"},
+			}},
+			"empty": File{Data: ""},
+			"foo":   File{Data: "content: foo\n"},
+		},
+	})
+
+	res, err := NewRestorer(context.TODO(), repo, id)
+	rtest.OK(t, err)
+
+	var (
+		m                       sync.Mutex
+		totalFiles, totalBytes  uint64
+		restoredBytes           uint64
+		startedPacks, donePacks int
+		items                   []string
+	)
+	res.ReportTotal = func(files, bytes uint64) {
+		totalFiles, totalBytes = files, bytes
+	}
+	res.StartPack = func(restic.ID) {
+		m.Lock()
+		startedPacks++
+		m.Unlock()
+	}
+	res.CompletePack = func(restic.ID) {
+		m.Lock()
+		donePacks++
+		m.Unlock()
+	}
+	res.CompleteBlob = func(location string, bytes uint64) {
+		m.Lock()
+		restoredBytes += bytes
+		m.Unlock()
+	}
+	res.CompleteItem = func(location string, node *restic.Node) {
+		items = append(items, filepath.ToSlash(location))
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+	rtest.Equals(t, uint64(4), totalFiles)
+	rtest.Equals(t, uint64(2*len("content: file\n")+len("content: foo\n")), totalBytes)
+	rtest.Equals(t, totalBytes, restoredBytes)
+	rtest.Assert(t, startedPacks > 0 && startedPacks == donePacks,
+		"unexpected number of packs, %d started, %d completed", startedPacks, donePacks)
+
+	sort.Strings(items)
+	rtest.Equals(t, []string{"/dir", "/dir/file", "/dir/same", "/empty", "/foo"}, items)
+}
+
+func TestRestorerRewritePaths(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"srv": Dir{Nodes: map[string]Node{
+				"data": Dir{Nodes: map[string]Node{
+					"file":  File{Data: "content: file\n"},
+					"link1": File{Data: "content: link\n", Links: 2, Inode: 42},
+					"sub": Dir{Nodes: map[string]Node{
+						"link2": File{Data: "content: link\n", Links: 2, Inode: 42},
+					}},
+				}},
+				"other": File{Data: "content: other\n"},
+			}},
+		},
+	})
+
+	for _, test := range []struct {
+		name     string
+		strip    int
+		mappings []PathMapping
+		files    []string
+	}{
+		{
+			name:  "strip",
+			strip: 2,
+			files: []string{"file", "link1", "sub", "sub/link2"},
+		},
+		{
+			name:     "map",
+			mappings: []PathMapping{{Old: filepath.FromSlash("/srv/data"), New: filepath.FromSlash("/restored")}},
+			files:    []string{"restored", "restored/file", "restored/link1", "restored/sub", "restored/sub/link2", "srv", "srv/other"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			res, err := NewRestorer(context.TODO(), repo, id)
+			rtest.OK(t, err)
+			res.StripComponents = test.strip
+			res.PathMappings = test.mappings
+
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+			rtest.Equals(t, test.files, listFiles(t, tempdir))
+
+			count, err := res.VerifyFiles(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, len(test.files)-countDirs(t, tempdir), count)
+
+			// the hardlink must be restored at the rewritten location
+			dataDir := tempdir
+			if len(test.mappings) > 0 {
+				dataDir = filepath.Join(tempdir, "restored")
+			}
+			fi1, err := os.Stat(filepath.Join(dataDir, "link1"))
+			rtest.OK(t, err)
+			fi2, err := os.Stat(filepath.Join(dataDir, "sub", "link2"))
+			rtest.OK(t, err)
+			if runtime.GOOS != "windows" {
+				rtest.Assert(t, os.SameFile(fi1, fi2), "link1 and link2 are not hardlinked")
+			}
+		})
+	}
+}
+
+func countDirs(t testing.TB, dir string) int {
+	count := 0
+	for _, name := range listFiles(t, dir) {
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		rtest.OK(t, err)
+		if fi.IsDir() {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRestorerMultipleSnapshots(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	shared := strings.Repeat("shared", 1000)
+	_, id1 := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"shared": File{Data: shared},
+				"file":   File{Data: "content: first\n"},
+			}},
+		},
+	})
+	_, id2 := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"shared": File{Data: shared},
+				"file":   File{Data: "content: second\n"},
+			}},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	be := &loadCountingBackend{Backend: repo.Backend()}
+	res, err := NewMultiRestorer(context.TODO(), loadCountingRepo{Repository: repo, be: be}, restic.IDs{id1, id2})
+	rtest.OK(t, err)
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+	for id, content := range map[restic.ID]string{id1: "content: first\n", id2: "content: second\n"} {
+		dir := filepath.Join(tempdir, id.Str(), "dir")
+		rtest.Equals(t, []string{"file", "shared"}, listFiles(t, dir))
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+
+		data, err = ioutil.ReadFile(filepath.Join(dir, "shared"))
+		rtest.OK(t, err)
+		rtest.Equals(t, shared, string(data))
+	}
+
+	count, err := res.VerifyFiles(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, count)
+
+	// each blob must have been downloaded only once
+	expected := 0
+	for _, data := range []string{shared, "content: first\n", "content: second\n"} {
+		pbs := repo.Index().Lookup(restic.BlobHandle{ID: restic.Hash([]byte(data)), Type: restic.DataBlob})
+		rtest.Equals(t, 1, len(pbs))
+		expected += int(pbs[0].Length)
+	}
+	rtest.Equals(t, expected, be.bytes)
+}
+
+func TestRestorerMetadataOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not restored on Windows")
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	modTime := time.Date(2020, 3, 4, 5, 6, 7, 0, time.Local)
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Mode: 0750, ModTime: modTime, Nodes: map[string]Node{
+				"file":    File{Data: "content: file\n", Mode: 0640, ModTime: modTime},
+				"missing": File{Data: "content: missing\n", ModTime: modTime},
+			}},
+			"unchanged": File{Data: "content: unchanged\n", ModTime: modTime},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	res, err := NewRestorer(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+	// damage the metadata, the content of the file is modified to detect
+	// whether it is restored
+	file := filepath.Join(tempdir, "dir", "file")
+	rtest.OK(t, ioutil.WriteFile(file, []byte("modified: file\n"), 0640))
+	rtest.OK(t, os.Chmod(file, 0600))
+	rtest.OK(t, os.Chmod(filepath.Join(tempdir, "dir"), 0700))
+	rtest.OK(t, os.Remove(filepath.Join(tempdir, "dir", "missing")))
+
+	restoreMetadata := func(dryrun bool) map[string][]string {
+		be := &loadCountingBackend{Backend: repo.Backend()}
+		res, err := NewRestorer(context.TODO(), loadCountingRepo{Repository: repo, be: be}, id)
+		rtest.OK(t, err)
+		res.MetadataOnly = true
+
+		mismatches := make(map[string][]string)
+		res.ReportMismatch = func(location string, differences []string) {
+			mismatches[filepath.ToSlash(location)] = differences
+		}
+
+		rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, dryrun))
+		rtest.Equals(t, 0, be.bytes)
+		return mismatches
+	}
+
+	want := map[string][]string{
+		"/dir":         {"mode", "mtime"},
+		"/dir/file":    {"mode", "mtime"},
+		"/dir/missing": {"missing"},
+	}
+	// the dry run must not modify anything
+	rtest.Equals(t, want, restoreMetadata(true))
+	rtest.Equals(t, want, restoreMetadata(false))
+	rtest.Equals(t, map[string][]string{"/dir/missing": {"missing"}}, restoreMetadata(true))
+
+	fi, err := os.Stat(file)
+	rtest.OK(t, err)
+	checkConsistentInfo(t, file, fi, modTime, 0640)
+
+	data, err := ioutil.ReadFile(file)
+	rtest.OK(t, err)
+	rtest.Equals(t, "modified: file\n", string(data))
+
+	_, err = os.Stat(filepath.Join(tempdir, "dir", "missing"))
+	rtest.Assert(t, os.IsNotExist(err), "missing file was restored")
+}
+
+func TestRestorerMetadataNodeACLs(t *testing.T) {
+	acl := &restic.ACL{Version: 2, Entries: []restic.ACLEntry{
+		{Tag: restic.ACLUserOwner, ID: 0xffffffff, Perm: 6},
+		{Tag: restic.ACLUser, ID: 1000, Perm: 6},
+	}}
+	node := &restic.Node{
+		Name: "foo",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("bar")},
+			{Name: restic.ACLAccessAttribute, Value: acl.Encode()},
+			{Name: restic.ACLDefaultAttribute, Value: acl.Encode()},
+		},
+	}
+
+	res := &Restorer{
+		OwnerMapping: &restic.OwnerMapping{UIDs: map[uint32]uint32{1000: 2000}},
+	}
+	access, def := res.metadataNode(node).ACLs()
+	rtest.Equals(t, "user::rw-,user:2000:rw-", access.Short())
+	rtest.Equals(t, "user::rw-,user:2000:rw-", def.Short())
+
+	res.SkipACLs = true
+	rtest.Equals(t, []restic.ExtendedAttribute{{Name: "user.foo", Value: []byte("bar")}},
+		res.metadataNode(node).ExtendedAttributes)
+	rtest.Equals(t, 3, len(node.ExtendedAttributes))
+}
+
+func TestRestorerMetadataNodeXattrFilter(t *testing.T) {
+	node := &restic.Node{
+		Name: "foo",
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("bar")},
+			{Name: "security.selinux", Value: []byte("system_u:object_r:user_home_t:s0")},
+			{Name: "trusted.foo", Value: []byte("baz")},
+		},
+	}
+
+	filter, err := restic.NewXattrFilter(nil, []string{"security.*", "trusted.*"})
+	rtest.OK(t, err)
+	res := &Restorer{XattrFilter: filter}
+	rtest.Equals(t, []restic.ExtendedAttribute{{Name: "user.foo", Value: []byte("bar")}},
+		res.metadataNode(node).ExtendedAttributes)
+}
+
+func TestRestorerMetadataNodeImmutableFlags(t *testing.T) {
+	node := &restic.Node{
+		Name:       "foo",
+		Type:       "file",
+		InodeFlags: fs.InodeFlagImmutable | fs.InodeFlagAppend | fs.InodeFlagNodump,
+	}
+
+	res := &Restorer{}
+	rtest.Equals(t, uint32(fs.InodeFlagNodump), res.metadataNode(node).InodeFlags)
+	rtest.Equals(t, uint32(fs.InodeFlagImmutable|fs.InodeFlagAppend|fs.InodeFlagNodump), node.InodeFlags)
+
+	res = &Restorer{RestoreImmutableFlags: true}
+	rtest.Equals(t, node.InodeFlags, res.metadataNode(node).InodeFlags)
+}
@@ -4,6 +4,7 @@ package restorer
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -59,3 +60,87 @@ func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
 		rtest.Equals(t, s1.Ino, s2.Ino)
 	}
 }
+
+func TestRestorerOwnerMapping(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of files requires root privileges")
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: file\n"},
+			}},
+		},
+	})
+
+	res, err := NewRestorer(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	res.OwnerMapping = &restic.OwnerMapping{
+		UIDs: map[uint32]uint32{uint32(os.Getuid()): 4242},
+		GIDs: map[uint32]uint32{uint32(os.Getgid()): 4343},
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir, false))
+
+	for _, name := range []string{"dir", "dir/file"} {
+		fi, err := os.Lstat(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		stat := fi.Sys().(*syscall.Stat_t)
+		rtest.Equals(t, uint32(4242), stat.Uid)
+		rtest.Equals(t, uint32(4343), stat.Gid)
+	}
+}
+
+func TestRestorerOverwriteSymlink(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file":  File{Data: "content of file"},
+			"empty": File{Data: ""},
+		},
+	})
+
+	for _, overwrite := range []OverwriteBehavior{OverwriteAlways, OverwriteIfChanged} {
+		t.Run(overwrite.String(), func(t *testing.T) {
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			// symlinks in the target directory point to files outside of it
+			outside := filepath.Join(tempdir, "outside")
+			target := filepath.Join(tempdir, "target")
+			rtest.OK(t, os.MkdirAll(outside, 0700))
+			rtest.OK(t, os.MkdirAll(target, 0700))
+			for _, name := range []string{"file", "empty"} {
+				rtest.OK(t, ioutil.WriteFile(filepath.Join(outside, name), []byte("outside"), 0600))
+				rtest.OK(t, os.Symlink(filepath.Join(outside, name), filepath.Join(target, name)))
+			}
+
+			res, err := NewRestorer(context.TODO(), repo, id)
+			rtest.OK(t, err)
+			res.Overwrite = overwrite
+			rtest.OK(t, res.RestoreTo(context.TODO(), target, false))
+
+			for name, content := range map[string]string{"file": "content of file", "empty": ""} {
+				data, err := ioutil.ReadFile(filepath.Join(outside, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, "outside", string(data))
+
+				fi, err := os.Lstat(filepath.Join(target, name))
+				rtest.OK(t, err)
+				rtest.Assert(t, fi.Mode().IsRegular(), "%v was not replaced by a regular file", name)
+				data, err = ioutil.ReadFile(filepath.Join(target, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, content, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package restorer
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// PathMapping restores the items below Old within the snapshot at New
+// within the target directory.
+type PathMapping struct {
+	Old, New string
+}
+
+// ParsePathMapping parses a mapping of the form "/old/prefix=/new/prefix".
+func ParsePathMapping(s string) (PathMapping, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return PathMapping{}, errors.Errorf("invalid path mapping %q, expected /old/prefix=/new/prefix", s)
+	}
+
+	clean := func(p string) string {
+		return filepath.Join(string(filepath.Separator), filepath.FromSlash(p))
+	}
+	return PathMapping{Old: clean(parts[0]), New: clean(parts[1])}, nil
+}
+
+// rewritesPaths returns true if the items are not restored at their
+// location within the snapshot.
+func (res *Restorer) rewritesPaths() bool {
+	return res.StripComponents > 0 || len(res.PathMappings) > 0
+}
+
+// rewriteLocation returns the location within the target directory for the
+// item at location within the snapshot. The mapping with the longest matching
+// prefix is applied first, then the leading path components are stripped.
+// If the item itself must not be restored, for example because all of its
+// path components are stripped, false is returned.
+func (res *Restorer) rewriteLocation(location string) (string, bool) {
+	var mapping *PathMapping
+	for i, m := range res.PathMappings {
+		if fs.HasPathPrefix(m.Old, location) && (mapping == nil || len(m.Old) > len(mapping.Old)) {
+			mapping = &res.PathMappings[i]
+		}
+	}
+	if mapping != nil {
+		location = filepath.Join(mapping.New, location[len(mapping.Old):])
+	}
+
+	if res.StripComponents > 0 {
+		components := strings.Split(strings.Trim(location, string(filepath.Separator)), string(filepath.Separator))
+		if len(components) <= res.StripComponents {
+			return "", false
+		}
+		location = filepath.Join(append([]string{string(filepath.Separator)}, components[res.StripComponents:]...)...)
+	}
+
+	if location == string(filepath.Separator) {
+		return "", false
+	}
+	return location, true
+}
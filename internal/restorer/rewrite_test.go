@@ -0,0 +1,54 @@
+package restorer
+
+import (
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParsePathMapping(t *testing.T) {
+	m, err := ParsePathMapping("/srv/data/=restored")
+	rtest.OK(t, err)
+	rtest.Equals(t, PathMapping{Old: filepath.FromSlash("/srv/data"), New: filepath.FromSlash("/restored")}, m)
+
+	for _, s := range []string{"", "/srv", "=/foo", "/foo="} {
+		_, err := ParsePathMapping(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestRewriteLocation(t *testing.T) {
+	var tests = []struct {
+		strip    int
+		mappings []string
+		location string
+		want     string
+		restore  bool
+	}{
+		{0, nil, "/srv/data", "/srv/data", true},
+		{2, nil, "/srv/data/file", "/file", true},
+		{2, nil, "/srv/data", "", false},
+		{2, nil, "/srv", "", false},
+		{0, []string{"/srv/data=/restored"}, "/srv/data/file", "/restored/file", true},
+		{0, []string{"/srv/data=/restored"}, "/srv/database", "/srv/database", true},
+		{0, []string{"/srv=/a", "/srv/data=/b"}, "/srv/data/file", "/b/file", true},
+		{0, []string{"/srv=/a", "/srv/data=/b"}, "/srv/other", "/a/other", true},
+		{0, []string{"/srv/data=/"}, "/srv/data", "", false},
+		{0, []string{"/srv/data=/"}, "/srv/data/file", "/file", true},
+		{1, []string{"/srv/data=/x/y"}, "/srv/data/file", "/y/file", true},
+	}
+
+	for _, test := range tests {
+		res := &Restorer{StripComponents: test.strip}
+		for _, s := range test.mappings {
+			m, err := ParsePathMapping(s)
+			rtest.OK(t, err)
+			res.PathMappings = append(res.PathMappings, m)
+		}
+
+		location, restore := res.rewriteLocation(filepath.FromSlash(test.location))
+		rtest.Equals(t, test.restore, restore)
+		rtest.Equals(t, filepath.FromSlash(test.want), location)
+	}
+}
@@ -0,0 +1,389 @@
+package json
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+type packWorkerMessage struct {
+	packID restic.ID
+	done   bool
+}
+
+// Restore reports progress for the `restore` command in JSON.
+type Restore struct {
+	*ui.Message
+	*ui.StdioWrapper
+
+	MinUpdatePause time.Duration
+
+	term  *termstatus.Terminal
+	v     uint
+	start time.Time
+
+	totalCh     chan counter
+	processedCh chan counter
+	errCh       chan struct{}
+	packCh      chan packWorkerMessage
+	finished    chan struct{}
+	closed      chan struct{}
+
+	summary struct {
+		sync.Mutex
+		Files, Dirs uint64
+		Bytes       uint64
+		TotalFiles  uint64
+		TotalBytes  uint64
+		Errors      uint
+		Damaged     map[string]struct{}
+	}
+}
+
+// NewRestore returns a new restore progress reporter.
+func NewRestore(term *termstatus.Terminal, verbosity uint) *Restore {
+	return &Restore{
+		Message:      ui.NewMessage(term, verbosity),
+		StdioWrapper: ui.NewStdioWrapper(term),
+		term:         term,
+		v:            verbosity,
+		start:        time.Now(),
+
+		// limit to 60fps by default
+		MinUpdatePause: time.Second / 60,
+
+		totalCh:     make(chan counter),
+		processedCh: make(chan counter),
+		errCh:       make(chan struct{}),
+		packCh:      make(chan packWorkerMessage),
+		finished:    make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (r *Restore) print(status interface{}) {
+	r.term.Print(toJSONString(status))
+}
+
+func (r *Restore) error(status interface{}) {
+	r.term.Error(toJSONString(status))
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (r *Restore) Run(ctx context.Context) error {
+	var (
+		lastUpdate       time.Time
+		total, processed counter
+		errors           uint
+		started          bool
+		currentPacks     = make(map[restic.ID]struct{})
+		secondsRemaining uint64
+	)
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	defer close(r.closed)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.finished:
+			started = false
+		case t := <-r.totalCh:
+			total = t
+			started = true
+		case s := <-r.processedCh:
+			processed.Files += s.Files
+			processed.Dirs += s.Dirs
+			processed.Bytes += s.Bytes
+			started = true
+		case <-r.errCh:
+			errors++
+			started = true
+		case m := <-r.packCh:
+			if m.done {
+				delete(currentPacks, m.packID)
+			} else {
+				currentPacks[m.packID] = struct{}{}
+			}
+		case <-t.C:
+			if !started {
+				continue
+			}
+
+			if total.Bytes > 0 && processed.Bytes > 0 && processed.Bytes < total.Bytes {
+				secs := float64(time.Since(r.start) / time.Second)
+				todo := float64(total.Bytes - processed.Bytes)
+				secondsRemaining = uint64(secs / float64(processed.Bytes) * todo)
+			}
+		}
+
+		// limit update frequency
+		if time.Since(lastUpdate) < r.MinUpdatePause {
+			continue
+		}
+		lastUpdate = time.Now()
+
+		r.update(total, processed, errors, currentPacks, secondsRemaining)
+	}
+}
+
+// update prints a status message.
+func (r *Restore) update(total, processed counter, errors uint, currentPacks map[restic.ID]struct{}, secs uint64) {
+	status := restoreStatusUpdate{
+		MessageType:      "status",
+		SecondsElapsed:   uint64(time.Since(r.start) / time.Second),
+		SecondsRemaining: secs,
+		TotalFiles:       total.Files,
+		FilesRestored:    processed.Files,
+		TotalBytes:       total.Bytes,
+		BytesRestored:    processed.Bytes,
+		ErrorCount:       errors,
+	}
+
+	if total.Bytes > 0 {
+		status.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
+	}
+
+	for packID := range currentPacks {
+		status.CurrentPacks = append(status.CurrentPacks, packID.String())
+	}
+	sort.Strings(status.CurrentPacks)
+
+	r.print(status)
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (r *Restore) Error(location string, err error) error {
+	r.error(errorUpdate{
+		MessageType: "error",
+		Error:       err,
+		During:      "restore",
+		Item:        location,
+	})
+	r.summary.Lock()
+	r.summary.Errors++
+	r.summary.Unlock()
+	select {
+	case r.errCh <- struct{}{}:
+	case <-r.closed:
+	}
+	return nil
+}
+
+// Warn reports a problem which did not prevent restoring the item at location.
+func (r *Restore) Warn(location string, err error) {
+	r.error(restoreWarningOutput{
+		MessageType: "warning",
+		Item:        location,
+		Error:       err.Error(),
+	})
+}
+
+// ErrorCount returns the number of errors reported so far.
+func (r *Restore) ErrorCount() uint {
+	r.summary.Lock()
+	defer r.summary.Unlock()
+	return r.summary.Errors
+}
+
+// ReportDamage is called for each part of a file which could not be
+// restored and was filled with zeros instead.
+func (r *Restore) ReportDamage(location string, offset, length int64, err error) {
+	r.summary.Lock()
+	if r.summary.Damaged == nil {
+		r.summary.Damaged = make(map[string]struct{})
+	}
+	r.summary.Damaged[location] = struct{}{}
+	r.summary.Unlock()
+
+	r.print(restoreDamageOutput{
+		MessageType: "damaged",
+		Item:        location,
+		Offset:      offset,
+		Length:      length,
+		Error:       err.Error(),
+	})
+}
+
+// ReportMismatch is called for each item whose metadata differs from the
+// snapshot in a metadata-only restore.
+func (r *Restore) ReportMismatch(location string, differences []string) {
+	r.print(restoreMismatchOutput{
+		MessageType: "metadata_mismatch",
+		Item:        location,
+		Differences: differences,
+	})
+}
+
+// DamagedFiles returns the number of files which could not be restored
+// completely.
+func (r *Restore) DamagedFiles() uint {
+	r.summary.Lock()
+	defer r.summary.Unlock()
+	return uint(len(r.summary.Damaged))
+}
+
+// ReportTotal sets the number of files and bytes to restore.
+func (r *Restore) ReportTotal(files, bytes uint64) {
+	r.summary.Lock()
+	r.summary.TotalFiles = files
+	r.summary.TotalBytes = bytes
+	r.summary.Unlock()
+
+	select {
+	case r.totalCh <- counter{Files: files, Bytes: bytes}:
+	case <-r.closed:
+	}
+}
+
+// StartPack is called when a pack file is being downloaded by a worker.
+func (r *Restore) StartPack(packID restic.ID) {
+	select {
+	case r.packCh <- packWorkerMessage{packID: packID}:
+	case <-r.closed:
+	}
+}
+
+// CompletePack is called when a pack file has been processed.
+func (r *Restore) CompletePack(packID restic.ID) {
+	select {
+	case r.packCh <- packWorkerMessage{packID: packID, done: true}:
+	case <-r.closed:
+	}
+}
+
+// CompleteBlob is called for all restored parts of files.
+func (r *Restore) CompleteBlob(location string, bytes uint64) {
+	r.summary.Lock()
+	r.summary.Bytes += bytes
+	r.summary.Unlock()
+
+	select {
+	case r.processedCh <- counter{Bytes: bytes}:
+	case <-r.closed:
+	}
+}
+
+// CompleteItem is the status callback function for the restorer when an item
+// has been restored successfully.
+func (r *Restore) CompleteItem(location string, node *restic.Node) {
+	var c counter
+	switch node.Type {
+	case "file":
+		c.Files = 1
+	case "dir":
+		c.Dirs = 1
+	}
+
+	r.summary.Lock()
+	r.summary.Files += c.Files
+	r.summary.Dirs += c.Dirs
+	r.summary.Unlock()
+
+	if r.v >= 3 {
+		r.print(verboseUpdate{
+			MessageType: "verbose_status",
+			Action:      "restored",
+			Item:        location,
+			DataSize:    node.Size,
+		})
+	}
+
+	select {
+	case r.processedCh <- c:
+	case <-r.closed:
+	}
+}
+
+// Finish prints the summary message.
+func (r *Restore) Finish(snapshotIDs restic.IDs) {
+	select {
+	case r.finished <- struct{}{}:
+	case <-r.closed:
+	}
+
+	r.summary.Lock()
+	defer r.summary.Unlock()
+
+	var ids []string
+	if len(snapshotIDs) > 1 {
+		for _, id := range snapshotIDs {
+			ids = append(ids, id.Str())
+		}
+	}
+
+	r.print(restoreSummaryOutput{
+		MessageType:   "summary",
+		TotalFiles:    r.summary.TotalFiles,
+		FilesRestored: r.summary.Files,
+		DirsRestored:  r.summary.Dirs,
+		TotalBytes:    r.summary.TotalBytes,
+		BytesRestored: r.summary.Bytes,
+		ErrorCount:    r.summary.Errors,
+		DamagedFiles:  uint(len(r.summary.Damaged)),
+		TotalDuration: time.Since(r.start).Seconds(),
+		SnapshotID:    snapshotIDs[0].Str(),
+		SnapshotIDs:   ids,
+	})
+}
+
+// SetMinUpdatePause sets r.MinUpdatePause.
+func (r *Restore) SetMinUpdatePause(d time.Duration) {
+	r.MinUpdatePause = d
+}
+
+type restoreStatusUpdate struct {
+	MessageType      string   `json:"message_type"` // "status"
+	SecondsElapsed   uint64   `json:"seconds_elapsed,omitempty"`
+	SecondsRemaining uint64   `json:"seconds_remaining,omitempty"`
+	PercentDone      float64  `json:"percent_done"`
+	TotalFiles       uint64   `json:"total_files,omitempty"`
+	FilesRestored    uint64   `json:"files_restored,omitempty"`
+	TotalBytes       uint64   `json:"total_bytes,omitempty"`
+	BytesRestored    uint64   `json:"bytes_restored,omitempty"`
+	ErrorCount       uint     `json:"error_count,omitempty"`
+	CurrentPacks     []string `json:"current_packs,omitempty"`
+}
+
+type restoreSummaryOutput struct {
+	MessageType   string   `json:"message_type"` // "summary"
+	TotalFiles    uint64   `json:"total_files"`
+	FilesRestored uint64   `json:"files_restored"`
+	DirsRestored  uint64   `json:"dirs_restored"`
+	TotalBytes    uint64   `json:"total_bytes"`
+	BytesRestored uint64   `json:"bytes_restored"`
+	ErrorCount    uint     `json:"error_count"`
+	DamagedFiles  uint     `json:"damaged_files,omitempty"`
+	TotalDuration float64  `json:"total_duration"` // in seconds
+	SnapshotID    string   `json:"snapshot_id"`
+	SnapshotIDs   []string `json:"snapshot_ids,omitempty"`
+}
+
+type restoreDamageOutput struct {
+	MessageType string `json:"message_type"` // "damaged"
+	Item        string `json:"item"`
+	Offset      int64  `json:"offset"`
+	Length      int64  `json:"length"`
+	Error       string `json:"error"`
+}
+
+type restoreWarningOutput struct {
+	MessageType string `json:"message_type"` // "warning"
+	Item        string `json:"item"`
+	Error       string `json:"error"`
+}
+
+type restoreMismatchOutput struct {
+	MessageType string   `json:"message_type"` // "metadata_mismatch"
+	Item        string   `json:"item"`
+	Differences []string `json:"differences"`
+}
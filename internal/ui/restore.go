@@ -0,0 +1,315 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/signals"
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+type packWorkerMessage struct {
+	packID restic.ID
+	done   bool
+}
+
+// Restore reports progress for the `restore` command.
+type Restore struct {
+	*Message
+	*StdioWrapper
+
+	MinUpdatePause time.Duration
+
+	term  *termstatus.Terminal
+	start time.Time
+
+	totalCh     chan counter
+	processedCh chan counter
+	errCh       chan struct{}
+	packCh      chan packWorkerMessage
+	closed      chan struct{}
+
+	summary struct {
+		sync.Mutex
+		Files, Dirs uint
+		Bytes       uint64
+		TotalFiles  uint
+		TotalBytes  uint64
+		Errors      uint
+		Damaged     map[string]struct{}
+	}
+}
+
+// NewRestore returns a new restore progress reporter.
+func NewRestore(term *termstatus.Terminal, verbosity uint) *Restore {
+	return &Restore{
+		Message:      NewMessage(term, verbosity),
+		StdioWrapper: NewStdioWrapper(term),
+		term:         term,
+		start:        time.Now(),
+
+		// limit to 60fps by default
+		MinUpdatePause: time.Second / 60,
+
+		totalCh:     make(chan counter),
+		processedCh: make(chan counter),
+		errCh:       make(chan struct{}),
+		packCh:      make(chan packWorkerMessage),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (r *Restore) Run(ctx context.Context) error {
+	var (
+		lastUpdate       time.Time
+		total, processed counter
+		errors           uint
+		started          bool
+		currentPacks     = make(map[restic.ID]struct{})
+		secondsRemaining uint64
+	)
+
+	t := time.NewTicker(time.Second)
+	signalsCh := signals.GetProgressChannel()
+	defer t.Stop()
+	defer close(r.closed)
+	// Reset status when finished
+	defer func() {
+		if r.term.CanUpdateStatus() {
+			r.term.SetStatus([]string{""})
+		}
+	}()
+
+	for {
+		forceUpdate := false
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case t := <-r.totalCh:
+			total = t
+			started = true
+		case s := <-r.processedCh:
+			processed.Files += s.Files
+			processed.Dirs += s.Dirs
+			processed.Bytes += s.Bytes
+			started = true
+		case <-r.errCh:
+			errors++
+			started = true
+		case m := <-r.packCh:
+			if m.done {
+				delete(currentPacks, m.packID)
+			} else {
+				currentPacks[m.packID] = struct{}{}
+			}
+		case <-t.C:
+			if !started {
+				continue
+			}
+
+			if total.Bytes > 0 && processed.Bytes > 0 && processed.Bytes < total.Bytes {
+				secs := float64(time.Since(r.start) / time.Second)
+				todo := float64(total.Bytes - processed.Bytes)
+				secondsRemaining = uint64(secs / float64(processed.Bytes) * todo)
+			}
+		case <-signalsCh:
+			forceUpdate = true
+		}
+
+		// limit update frequency
+		if !forceUpdate && (time.Since(lastUpdate) < r.MinUpdatePause || r.MinUpdatePause == 0) {
+			continue
+		}
+		lastUpdate = time.Now()
+
+		r.update(total, processed, errors, currentPacks, secondsRemaining)
+	}
+}
+
+// update updates the status lines.
+func (r *Restore) update(total, processed counter, errors uint, currentPacks map[restic.ID]struct{}, secs uint64) {
+	var eta, percent string
+
+	if secs > 0 && processed.Bytes < total.Bytes {
+		eta = fmt.Sprintf(" ETA %s", formatSeconds(secs))
+		percent = formatPercent(processed.Bytes, total.Bytes)
+		percent += "  "
+	}
+
+	status := fmt.Sprintf("[%s] %s%v files %s, total %v files %v, %d errors%s",
+		formatDuration(time.Since(r.start)),
+		percent,
+		processed.Files,
+		formatBytes(processed.Bytes),
+		total.Files,
+		formatBytes(total.Bytes),
+		errors,
+		eta,
+	)
+
+	lines := make([]string, 0, len(currentPacks)+1)
+	for packID := range currentPacks {
+		lines = append(lines, fmt.Sprintf("pack %v", packID.Str()))
+	}
+	sort.Strings(lines)
+	lines = append([]string{status}, lines...)
+
+	r.term.SetStatus(lines)
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (r *Restore) Error(location string, err error) error {
+	r.E("ignoring error for %s: %s\n", location, err)
+	r.summary.Lock()
+	r.summary.Errors++
+	r.summary.Unlock()
+	select {
+	case r.errCh <- struct{}{}:
+	case <-r.closed:
+	}
+	return nil
+}
+
+// Warn reports a problem which did not prevent restoring the item at location.
+func (r *Restore) Warn(location string, err error) {
+	r.E("warning for %s: %v\n", location, err)
+}
+
+// ErrorCount returns the number of errors reported so far.
+func (r *Restore) ErrorCount() uint {
+	r.summary.Lock()
+	defer r.summary.Unlock()
+	return r.summary.Errors
+}
+
+// ReportDamage is called for each part of a file which could not be
+// restored and was filled with zeros instead.
+func (r *Restore) ReportDamage(location string, offset, length int64, err error) {
+	r.E("damaged %s: %s at offset %d filled with zeros: %v\n", location, formatBytes(uint64(length)), offset, err)
+	r.summary.Lock()
+	if r.summary.Damaged == nil {
+		r.summary.Damaged = make(map[string]struct{})
+	}
+	r.summary.Damaged[location] = struct{}{}
+	r.summary.Unlock()
+}
+
+// ReportMismatch is called for each item whose metadata differs from the
+// snapshot in a metadata-only restore.
+func (r *Restore) ReportMismatch(location string, differences []string) {
+	if len(differences) == 1 && differences[0] == "missing" {
+		r.P("missing %s\n", location)
+		return
+	}
+	r.P("metadata differs for %s: %s\n", location, strings.Join(differences, ", "))
+}
+
+// DamagedFiles returns the number of files which could not be restored
+// completely.
+func (r *Restore) DamagedFiles() uint {
+	r.summary.Lock()
+	defer r.summary.Unlock()
+	return uint(len(r.summary.Damaged))
+}
+
+// ReportTotal sets the number of files and bytes to restore.
+func (r *Restore) ReportTotal(files, bytes uint64) {
+	r.summary.Lock()
+	r.summary.TotalFiles = uint(files)
+	r.summary.TotalBytes = bytes
+	r.summary.Unlock()
+
+	r.V("restoring %v files, %s\n", files, formatBytes(bytes))
+
+	select {
+	case r.totalCh <- counter{Files: uint(files), Bytes: bytes}:
+	case <-r.closed:
+	}
+}
+
+// StartPack is called when a pack file is being downloaded by a worker.
+func (r *Restore) StartPack(packID restic.ID) {
+	select {
+	case r.packCh <- packWorkerMessage{packID: packID}:
+	case <-r.closed:
+	}
+}
+
+// CompletePack is called when a pack file has been processed.
+func (r *Restore) CompletePack(packID restic.ID) {
+	select {
+	case r.packCh <- packWorkerMessage{packID: packID, done: true}:
+	case <-r.closed:
+	}
+}
+
+// CompleteBlob is called for all restored parts of files.
+func (r *Restore) CompleteBlob(location string, bytes uint64) {
+	r.summary.Lock()
+	r.summary.Bytes += bytes
+	r.summary.Unlock()
+
+	select {
+	case r.processedCh <- counter{Bytes: bytes}:
+	case <-r.closed:
+	}
+}
+
+// CompleteItem is the status callback function for the restorer when an item
+// has been restored successfully.
+func (r *Restore) CompleteItem(location string, node *restic.Node) {
+	var c counter
+	switch node.Type {
+	case "file":
+		c.Files = 1
+	case "dir":
+		c.Dirs = 1
+	}
+
+	r.summary.Lock()
+	r.summary.Files += c.Files
+	r.summary.Dirs += c.Dirs
+	r.summary.Unlock()
+
+	r.VV("restored  %v", location)
+
+	select {
+	case r.processedCh <- c:
+	case <-r.closed:
+	}
+}
+
+// Finish prints the finishing messages.
+func (r *Restore) Finish(snapshotIDs restic.IDs) {
+	// wait for the status update goroutine to shut down
+	<-r.closed
+
+	r.summary.Lock()
+	defer r.summary.Unlock()
+
+	r.P("restored %v files, %v dirs, %v of %v in %s, %d errors\n",
+		r.summary.Files,
+		r.summary.Dirs,
+		formatBytes(r.summary.Bytes),
+		formatBytes(r.summary.TotalBytes),
+		formatDuration(time.Since(r.start)),
+		r.summary.Errors,
+	)
+	if len(r.summary.Damaged) > 0 {
+		r.P("%d files could not be restored completely\n", len(r.summary.Damaged))
+	}
+}
+
+// SetMinUpdatePause sets r.MinUpdatePause.
+func (r *Restore) SetMinUpdatePause(d time.Duration) {
+	r.MinUpdatePause = d
+}
@@ -0,0 +1,137 @@
+package walker
+
+import (
+	"context"
+	"path"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// NodeRewriteFunc is called for each node in a tree. It returns the node which
+// should be stored in the new tree, or nil to remove the node.
+type NodeRewriteFunc func(node *restic.Node, path string) *restic.Node
+
+// FailedTreeRewriteFunc is called when the tree with ID nodeID could not be
+// loaded. It returns the ID of a tree that should be used instead, or the null
+// ID to remove the node from its parent. If an error is returned, the rewrite
+// is aborted.
+type FailedTreeRewriteFunc func(nodeID restic.ID, path string, err error) (restic.ID, error)
+
+// RewriteOpts configures a TreeRewriter.
+type RewriteOpts struct {
+	// RewriteNode is called for every node. By default all nodes are kept
+	// unmodified.
+	RewriteNode NodeRewriteFunc
+
+	// RewriteFailedTree decides what to do with a tree that could not be
+	// loaded. By default the load error is returned, which aborts the rewrite.
+	RewriteFailedTree FailedTreeRewriteFunc
+
+	// DisableNodeCache must be set if the result of RewriteNode depends on
+	// the path of a node. Otherwise a subtree which is referenced at several
+	// paths is only rewritten once.
+	DisableNodeCache bool
+}
+
+// TreeLoadSaver loads and saves trees.
+type TreeLoadSaver interface {
+	restic.TreeLoader
+	SaveTree(context.Context, *restic.Tree) (restic.ID, error)
+}
+
+// TreeRewriter creates modified copies of trees. Unless disabled, trees which
+// have already been rewritten are cached, so shared subtrees are only
+// processed once.
+type TreeRewriter struct {
+	opts RewriteOpts
+
+	replaces map[restic.ID]restic.ID
+}
+
+// NewTreeRewriter returns a TreeRewriter using the given options.
+func NewTreeRewriter(opts RewriteOpts) *TreeRewriter {
+	rw := &TreeRewriter{
+		opts: opts,
+	}
+	if !opts.DisableNodeCache {
+		rw.replaces = make(map[restic.ID]restic.ID)
+	}
+
+	if rw.opts.RewriteNode == nil {
+		rw.opts.RewriteNode = func(node *restic.Node, path string) *restic.Node {
+			return node
+		}
+	}
+	if rw.opts.RewriteFailedTree == nil {
+		rw.opts.RewriteFailedTree = func(nodeID restic.ID, path string, err error) (restic.ID, error) {
+			return restic.ID{}, err
+		}
+	}
+
+	return rw
+}
+
+// RewriteTree rewrites the tree nodeID located at nodepath and all of its
+// subtrees, and returns the ID of the new tree. If no node was modified, the
+// returned ID is equal to nodeID.
+func (t *TreeRewriter) RewriteTree(ctx context.Context, repo TreeLoadSaver, nodepath string, nodeID restic.ID) (restic.ID, error) {
+	if newID, ok := t.replaces[nodeID]; ok {
+		return newID, nil
+	}
+
+	// a null ID leads to a load error, which is handled by RewriteFailedTree
+	curTree, err := repo.LoadTree(ctx, nodeID)
+	if err != nil {
+		return t.opts.RewriteFailedTree(nodeID, nodepath, err)
+	}
+
+	debug.Log("rewrite tree %v at %v", nodeID.Str(), nodepath)
+
+	tree := restic.NewTree()
+	for _, node := range curTree.Nodes {
+		if ctx.Err() != nil {
+			return restic.ID{}, ctx.Err()
+		}
+
+		p := path.Join(nodepath, node.Name)
+		node = t.opts.RewriteNode(node, p)
+		if node == nil {
+			continue
+		}
+
+		if node.Type == "dir" {
+			var subtree restic.ID
+			if node.Subtree != nil {
+				subtree = *node.Subtree
+			}
+
+			newID, err := t.RewriteTree(ctx, repo, p, subtree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+			if newID.IsNull() {
+				continue
+			}
+			node.Subtree = &newID
+		}
+
+		// keep the original order of the nodes, so that the ID of an
+		// unmodified tree does not change
+		tree.Nodes = append(tree.Nodes, node)
+	}
+
+	newTreeID, err := repo.SaveTree(ctx, tree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	if t.replaces != nil {
+		t.replaces[nodeID] = newTreeID
+	}
+	if !newTreeID.Equal(nodeID) {
+		debug.Log("saved rewritten tree for %v as %v", nodepath, newTreeID.Str())
+	}
+
+	return newTreeID, nil
+}
@@ -0,0 +1,186 @@
+package walker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// WritableTreeMap also support saving
+type WritableTreeMap struct {
+	TreeMap
+}
+
+func (t WritableTreeMap) SaveTree(ctx context.Context, tree *restic.Tree) (restic.ID, error) {
+	buf, err := json.Marshal(tree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	id := restic.Hash(buf)
+	if _, ok := t.TreeMap[id]; !ok {
+		t.TreeMap[id] = tree
+	}
+	return id, nil
+}
+
+func (t WritableTreeMap) Dump(test testing.TB) {
+	for k, v := range t.TreeMap {
+		test.Logf("%v: %v", k, v)
+	}
+}
+
+func checkRewriteItemOrder(want []string) NodeRewriteFunc {
+	pos := 0
+	return func(node *restic.Node, path string) *restic.Node {
+		if pos >= len(want) {
+			panic("additional unexpected path found: " + path)
+		}
+
+		if path != want[pos] {
+			panic("wrong path found, want " + want[pos] + ", got " + path)
+		}
+		pos++
+		return node
+	}
+}
+
+func checkRewriteSkips(skipFor map[string]struct{}) NodeRewriteFunc {
+	return func(node *restic.Node, path string) *restic.Node {
+		if _, ok := skipFor[path]; ok {
+			return nil
+		}
+		return node
+	}
+}
+
+func TestRewriter(t *testing.T) {
+	var tests = []struct {
+		tree    TestTree
+		newTree TestTree
+		fn      NodeRewriteFunc
+	}{
+		{ // unmodified
+			tree: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile": TestFile{},
+				},
+			},
+			fn: checkRewriteItemOrder([]string{
+				"/foo",
+				"/subdir",
+				"/subdir/subfile",
+			}),
+		},
+		{ // remove file
+			tree: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile": TestFile{},
+				},
+			},
+			newTree: TestTree{
+				"subdir": TestTree{},
+			},
+			fn: checkRewriteSkips(map[string]struct{}{
+				"/foo":            {},
+				"/subdir/subfile": {},
+			}),
+		},
+		{ // remove dir
+			tree: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile": TestFile{},
+				},
+			},
+			newTree: TestTree{
+				"foo": TestFile{},
+			},
+			fn: checkRewriteSkips(map[string]struct{}{
+				"/subdir": {},
+			}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			repo, root := BuildTreeMap(test.tree)
+			if test.newTree == nil {
+				test.newTree = test.tree
+			}
+			expRepo, expRoot := BuildTreeMap(test.newTree)
+			modrepo := WritableTreeMap{repo}
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+
+			rewriter := NewTreeRewriter(RewriteOpts{RewriteNode: test.fn})
+			newRoot, err := rewriter.RewriteTree(ctx, modrepo, "/", root)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if newRoot != expRoot {
+				t.Error("hash mismatch")
+				t.Log("Got")
+				modrepo.Dump(t)
+				t.Log("Expected")
+				WritableTreeMap{expRepo}.Dump(t)
+			}
+		})
+	}
+}
+
+func TestRewriterFailOnUnknownTree(t *testing.T) {
+	tm := WritableTreeMap{TreeMap{}}
+	node := &restic.Node{
+		Name:    "subdir",
+		Type:    "dir",
+		Subtree: &restic.ID{1},
+	}
+
+	tree := &restic.Tree{Nodes: []*restic.Node{node}}
+	root, err := tm.SaveTree(context.TODO(), tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	rewriter := NewTreeRewriter(RewriteOpts{})
+	_, err = rewriter.RewriteTree(ctx, tm, "/", root)
+	if err == nil {
+		t.Error("missing error on unknown tree")
+	}
+
+	replacementID := restic.ID{2}
+	rewriter = NewTreeRewriter(RewriteOpts{
+		RewriteFailedTree: func(nodeID restic.ID, path string, err error) (restic.ID, error) {
+			if nodeID != (restic.ID{1}) {
+				return restic.ID{}, errors.Errorf("unexpected node ID %v", nodeID)
+			}
+			if path != "/subdir" {
+				return restic.ID{}, errors.Errorf("unexpected path %v", path)
+			}
+			return replacementID, nil
+		},
+	})
+	newRoot, err := rewriter.RewriteTree(ctx, tm, "/", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTree, err := tm.LoadTree(ctx, newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *newTree.Nodes[0].Subtree != replacementID {
+		t.Errorf("subtree was not replaced, got %v", newTree.Nodes[0].Subtree)
+	}
+}